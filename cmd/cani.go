@@ -0,0 +1,69 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+)
+
+const (
+	flagVerbs = "verbs"
+)
+
+func init() {
+	RootCmd.AddCommand(canICmd)
+	canICmd.PersistentFlags().StringSlice(flagVerbs, kubecfg.DefaultCanIVerbs, "Verbs to check for each object")
+}
+
+var canICmd = &cobra.Command{
+	Use:   "can-i",
+	Short: "Check that the current user is allowed to update all resources in local config",
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		var err error
+
+		c := kubecfg.CanICmd{}
+
+		c.Verbs, err = flags.GetStringSlice(flagVerbs)
+		if err != nil {
+			return err
+		}
+
+		c.ClientPool, c.Discovery, err = restClientPool(cmd)
+		if err != nil {
+			return err
+		}
+
+		c.DefaultNamespace, err = defaultNamespace(clientConfig)
+		if err != nil {
+			return err
+		}
+
+		objs, err := readObjs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+			return err
+		}
+
+		return c.Run(objs, cmd.OutOrStdout())
+	},
+}
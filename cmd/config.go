@@ -0,0 +1,75 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configViewCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the connection settings used by kubecfg",
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print the effective connection settings, with secrets redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		c := kubecfg.ConfigViewCmd{}
+
+		// Same loading path as restClientPool
+		c.Config, err = restConfig(cmd, clientConfig)
+		if err != nil {
+			return err
+		}
+
+		c.Context, err = currentContext(clientConfig)
+		if err != nil {
+			return err
+		}
+
+		raw, err := clientConfig.RawConfig()
+		if err != nil {
+			return err
+		}
+		if ctx, ok := raw.Contexts[c.Context]; ok {
+			c.Cluster = ctx.Cluster
+			c.User = ctx.AuthInfo
+		}
+		if overrides.Context.Cluster != "" {
+			c.Cluster = overrides.Context.Cluster
+		}
+		if overrides.Context.AuthInfo != "" {
+			c.User = overrides.Context.AuthInfo
+		}
+
+		c.Namespace, err = defaultNamespace(clientConfig)
+		if err != nil {
+			return err
+		}
+
+		return c.Run(cmd.OutOrStdout())
+	},
+}
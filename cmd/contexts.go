@@ -0,0 +1,169 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// targetContexts returns the kubeconfig contexts given by
+// --contexts or --all-contexts, or nil for just the current one.
+func targetContexts(cmd *cobra.Command) ([]string, error) {
+	flags := cmd.Flags()
+	names, err := flags.GetStringSlice(flagContexts)
+	if err != nil {
+		return nil, err
+	}
+	all, err := flags.GetBool(flagAllContexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 && !all {
+		return nil, nil
+	}
+	if all && len(names) > 0 {
+		return nil, fmt.Errorf("--%s and --%s are mutually exclusive", flagContexts, flagAllContexts)
+	}
+	if overrides.CurrentContext != "" {
+		return nil, fmt.Errorf("--context can't be combined with --%s or --%s", flagContexts, flagAllContexts)
+	}
+
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read kubectl config: %v", err)
+	}
+	if all {
+		for name := range raw.Contexts {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("No contexts found in kubectl config")
+		}
+		sort.Strings(names)
+	}
+	// Before anything is changed
+	for _, name := range names {
+		if _, ok := raw.Contexts[name]; !ok {
+			return nil, fmt.Errorf("Context %q not found in kubectl config", name)
+		}
+	}
+	return names, nil
+}
+
+// contextClientConfig returns the kubectl config for context name,
+// with the other kubectl flags (eg: --namespace) applied.
+func contextClientConfig(name string) clientcmd.ClientConfig {
+	o := overrides
+	o.CurrentContext = name
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &o)
+}
+
+// contextRenderer evaluates config for each context in turn.  The
+// previous evaluation is reused unless it depended on the context
+// (eg: through currentNamespace() or contextExtVar).
+type contextRenderer struct {
+	cmd   *cobra.Command
+	paths []string
+
+	// The last evaluation, before finishObjs, if reusable
+	objs []*unstructured.Unstructured
+	// evaluations counts evaluations, for tests
+	evaluations int
+}
+
+func (r *contextRenderer) render(target *evalTarget) ([]*unstructured.Unstructured, error) {
+	if r.objs == nil {
+		log.Debugf("Evaluating config for context %s", target.context)
+		objs, err := renderObjs(r.cmd, r.paths, nil, target)
+		if err != nil {
+			return nil, err
+		}
+		r.evaluations++
+		if target.used {
+			log.Debugf("Config depends on the context, so will be evaluated for each")
+		} else {
+			// finishObjs and the update modify objs
+			r.objs = make([]*unstructured.Unstructured, len(objs))
+			for i, obj := range objs {
+				r.objs[i] = obj.DeepCopy()
+			}
+		}
+		if err := finishObjs(r.cmd, objs, target); err != nil {
+			return nil, err
+		}
+		return objs, nil
+	}
+
+	// Objects are modified as they are updated
+	objs := make([]*unstructured.Unstructured, len(r.objs))
+	for i, obj := range r.objs {
+		objs[i] = obj.DeepCopy()
+	}
+	if err := finishObjs(r.cmd, objs, target); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// updateContexts updates each of contexts in turn.  Unless
+// --fail-fast is given, a failure in one context doesn't stop the
+// others, and the error summarises every failure.
+func updateContexts(cmd *cobra.Command, args []string, contexts []string) error {
+	failFast, err := cmd.Flags().GetBool(flagFailFast)
+	if err != nil {
+		return err
+	}
+
+	r := &contextRenderer{cmd: cmd, paths: args}
+	results := make([]string, 0, len(contexts))
+	var failed []string
+	updated := 0
+	for i, name := range contexts {
+		log.Infof("Updating context %s (%d of %d)", name, i+1, len(contexts))
+		cc := contextClientConfig(name)
+		err := runUpdate(cmd, cc, func(disco discovery.DiscoveryInterface) ([]*unstructured.Unstructured, error) {
+			return r.render(&evalTarget{clientConfig: cc, context: name, disco: disco})
+		})
+		if err != nil {
+			log.Errorf("Error updating context %s: %v", name, err)
+			results = append(results, fmt.Sprintf("%s: failed: %v", name, err))
+			failed = append(failed, name)
+			if failFast {
+				for _, skipped := range contexts[i+1:] {
+					results = append(results, skipped+": skipped")
+				}
+				break
+			}
+			continue
+		}
+		results = append(results, name+": updated")
+		updated++
+	}
+
+	log.Infof("Updated %d of %d contexts:\n  %s", updated, len(contexts), strings.Join(results, "\n  "))
+	if len(failed) > 0 {
+		return fmt.Errorf("Update failed in %d of %d contexts: %s", len(failed), len(contexts), strings.Join(failed, ", "))
+	}
+	return nil
+}
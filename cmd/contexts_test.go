@@ -0,0 +1,170 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestContextRenderer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubecfg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{
+		"static.jsonnet":    `{apiVersion: "v1", kind: "ConfigMap", metadata: {name: "foo"}}`,
+		"dependent.jsonnet": `{apiVersion: "v1", kind: "ConfigMap", metadata: {name: std.extVar("__ksonnet/context")}}`,
+	}
+	for name, src := range sources {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Merges the root command's flags
+	if err := updateCmd.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, evaluations := range map[string]int{"static.jsonnet": 1, "dependent.jsonnet": 2} {
+		r := &contextRenderer{cmd: updateCmd, paths: []string{filepath.Join(dir, name)}}
+		for _, context := range []string{"a", "b"} {
+			objs, err := r.render(&evalTarget{context: context})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(objs) != 1 {
+				t.Fatalf("Expected one object, got %v", objs)
+			}
+			if name == "dependent.jsonnet" && objs[0].GetName() != context {
+				t.Errorf("%s evaluated for the wrong context: %s", context, objs[0].GetName())
+			}
+			if l, ok := objs[0].GetLabels()["updated"]; ok {
+				t.Errorf("%s has the labels of context %s", context, l)
+			}
+			// Must not affect other contexts
+			objs[0].SetLabels(map[string]string{"updated": context})
+		}
+		if r.evaluations != evaluations {
+			t.Errorf("%s evaluated %d times, expected %d", name, r.evaluations, evaluations)
+		}
+	}
+}
+
+func TestUpdateContexts(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	servers := map[string]*httptest.Server{}
+	for _, name := range []string{"a", "b"} {
+		name := name
+		servers[name] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			requests[name]++
+			lock.Unlock()
+			// The server has nothing to offer
+			http.NotFound(w, r)
+		}))
+		defer servers[name].Close()
+	}
+
+	dir, err := ioutil.TempDir("", "kubecfg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: a
+  cluster: {server: %q}
+- name: b
+  cluster: {server: %q}
+users:
+- name: u
+  user: {}
+contexts:
+- name: a
+  context: {cluster: a, user: u}
+- name: b
+  context: {cluster: b, user: u}
+current-context: a
+`, servers["a"].URL, servers["b"].URL)
+	if err := ioutil.WriteFile(kubeconfig, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	RootCmd.SetOutput(&buf)
+	defer RootCmd.SetOutput(nil)
+	defer func() {
+		// clientConfig keeps the kubeconfig it loaded
+		loadingRules.ExplicitPath = ""
+		clientConfig = clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
+
+		flags := updateCmd.PersistentFlags()
+		flags.Set(flagFailFast, "false")
+		flags.Set(flagAllContexts, "false")
+		// Set would append to the list
+		empty := pflag.NewFlagSet("", pflag.ContinueOnError)
+		empty.StringSlice(flagContexts, nil, "")
+		flags.Lookup(flagContexts).Value = empty.Lookup(flagContexts).Value
+	}()
+
+	args := []string{"update", "--kubeconfig", kubeconfig, "--cache-dir", "", "--validate=false", "../testdata/test.yaml"}
+
+	RootCmd.SetArgs(append(args, "--all-contexts"))
+	err = RootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "failed in 2 of 2 contexts: a, b") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if requests["a"] == 0 || requests["b"] == 0 {
+		t.Errorf("Expected requests to both contexts, got %v", requests)
+	}
+
+	requests = map[string]int{}
+	updateCmd.PersistentFlags().Set(flagAllContexts, "false")
+	RootCmd.SetArgs(append(args, "--contexts", "a,b", "--fail-fast"))
+	err = RootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "failed in 1 of 2 contexts: a") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if requests["b"] != 0 {
+		t.Errorf("Context b was updated after a failed with --fail-fast")
+	}
+	if !strings.Contains(buf.String(), "b: skipped") {
+		t.Errorf("Summary doesn't list the skipped context:\n%s", buf.String())
+	}
+
+	updateCmd.PersistentFlags().Set(flagFailFast, "false")
+	RootCmd.SetArgs(append(args, "--contexts", "a,c"))
+	if err := RootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `Context "c" not found`) {
+		t.Errorf("Unexpected error for a missing context %v", err)
+	}
+}
@@ -16,18 +16,35 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/ksonnet/kubecfg/pkg/kubecfg"
 )
 
 const (
 	flagGracePeriod = "grace-period"
+	flagPropagation = "delete-propagation"
 )
 
+var propagationPolicies = map[string]metav1.DeletionPropagation{
+	"foreground": metav1.DeletePropagationForeground,
+	"background": metav1.DeletePropagationBackground,
+	"orphan":     metav1.DeletePropagationOrphan,
+}
+
 func init() {
 	RootCmd.AddCommand(deleteCmd)
 	deleteCmd.PersistentFlags().Int64(flagGracePeriod, -1, "Number of seconds given to resources to terminate gracefully. A negative value is ignored")
+	deleteCmd.PersistentFlags().StringP(flagOutput, "o", "text", "Output format.  Supported values are: text, ndjson (a line of JSON on stdout as each object is deleted)")
+	deleteCmd.PersistentFlags().String(flagPropagation, "foreground", "What happens to dependents (eg: a Deployment's ReplicaSets). One of: foreground (deleted first, before the object), background (deleted after the object), orphan (left behind)")
+	addDryRunFlag(deleteCmd, "List the objects that would be deleted, including dependents the server would garbage collect")
+	deleteCmd.PersistentFlags().Bool(flagWait, false, "Wait for each group of objects (eg: namespaces) to be gone before deleting those they depend on (eg: CRDs)")
+	deleteCmd.PersistentFlags().Duration(flagWaitTimeout, 5*time.Minute, "With --"+flagWait+", fail if objects still exist after this long. Zero means wait forever")
 }
 
 var deleteCmd = &cobra.Command{
@@ -45,10 +62,41 @@ var deleteCmd = &cobra.Command{
 			return err
 		}
 
+		propagation, err := flags.GetString(flagPropagation)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if c.PropagationPolicy, ok = propagationPolicies[strings.ToLower(propagation)]; !ok {
+			return fmt.Errorf("Unknown --%s %q, expected foreground, background or orphan", flagPropagation, propagation)
+		}
+
+		dryRun, err := dryRunMode(cmd)
+		if err != nil {
+			return err
+		}
+		c.DryRun, c.ServerDryRun = dryRun == "client", dryRun == "server"
+
+		c.Wait, err = flags.GetBool(flagWait)
+		if err != nil {
+			return err
+		}
+
+		c.WaitTimeout, err = flags.GetDuration(flagWaitTimeout)
+		if err != nil {
+			return err
+		}
+
+		c.Events, err = eventsOutput(cmd)
+		if err != nil {
+			return err
+		}
+
 		c.ClientPool, c.Discovery, err = restClientPool(cmd)
 		if err != nil {
 			return err
 		}
+		c.Impersonate = impersonatingClientPools(cmd, clientConfig, c.Discovery)
 
 		c.DefaultNamespace, err = defaultNamespace(clientConfig)
 		if err != nil {
@@ -60,6 +108,10 @@ var deleteCmd = &cobra.Command{
 			return err
 		}
 
+		if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+			return err
+		}
+
 		return c.Run(objs)
 	},
 }
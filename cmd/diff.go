@@ -16,16 +16,99 @@
 package cmd
 
 import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 
 	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+	"github.com/ksonnet/kubecfg/utils"
 )
 
-const flagDiffStrategy = "diff-strategy"
+const (
+	flagDiffStrategy = "diff-strategy"
+	flagOutput       = "output"
+	flagMergeKey     = "merge-key"
+	flagCompare      = "compare-config"
+	flagIgnorePath   = "ignore-path"
+)
 
 func init() {
 	diffCmd.PersistentFlags().String(flagDiffStrategy, "all", "Diff strategy, all or subset.")
+	diffCmd.PersistentFlags().StringP(flagOutput, "o", "text", "Output format.  Supported values are: text, markdown, unified, json")
+	diffCmd.PersistentFlags().StringArray(flagMergeKey, nil, "Fields identifying elements of a custom resource list, as Kind.group:path=key[,key...].  Used by the subset diff strategy when the CRD declares none.  May be repeated")
+	diffCmd.PersistentFlags().String(flagCompare, "", "File listing the fields to include or exclude when comparing objects of each kind")
+	diffCmd.PersistentFlags().StringArray(flagIgnorePath, nil, "Field (eg: spec.replicas) to ignore when comparing objects of every kind, including everything below it.  May be repeated")
 	RootCmd.AddCommand(diffCmd)
+	shareRunFlags(diffCmd)
+}
+
+// compareConfig reads the --compare-config file, if any, warning
+// about kinds the server doesn't know, and adds --ignore-path.
+func compareConfig(cmd *cobra.Command, disco discovery.ServerResourcesInterface) (utils.CompareConfig, error) {
+	path, err := cmd.Flags().GetString(flagCompare)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := cmd.Flags().GetStringArray(flagIgnorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config utils.CompareConfig
+	if path != "" {
+		config, err = utils.ReadCompareConfig(path)
+		if err != nil {
+			return nil, err
+		}
+
+		unknown, err := config.UnknownKinds(disco)
+		if err != nil {
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			log.Warnf("Unknown kinds in %s: %s", path, strings.Join(unknown, ", "))
+		}
+	}
+	return utils.IgnorePaths(config, ignored)
+}
+
+// diffFlags returns a DiffCmd configured from cmd's flags
+func diffFlags(cmd *cobra.Command) (kubecfg.DiffCmd, error) {
+	flags := cmd.Flags()
+	var err error
+
+	c := kubecfg.DiffCmd{}
+
+	c.DiffStrategy, err = flags.GetString(flagDiffStrategy)
+	if err != nil {
+		return c, err
+	}
+
+	c.OutputFormat, err = flags.GetString(flagOutput)
+	if err != nil {
+		return c, err
+	}
+
+	mergeKeys, err := flags.GetStringArray(flagMergeKey)
+	if err != nil {
+		return c, err
+	}
+	c.MergeKeys = map[schema.GroupKind]utils.MergeKeys{}
+	for _, mk := range mergeKeys {
+		gk, path, keys, err := utils.ParseMergeKey(mk)
+		if err != nil {
+			return c, err
+		}
+		if c.MergeKeys[gk] == nil {
+			c.MergeKeys[gk] = utils.MergeKeys{}
+		}
+		c.MergeKeys[gk][path] = keys
+	}
+
+	return c, nil
 }
 
 var diffCmd = &cobra.Command{
@@ -33,12 +116,7 @@ var diffCmd = &cobra.Command{
 	Short: "Display differences between server and local config",
 	Args:  cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flags := cmd.Flags()
-		var err error
-
-		c := kubecfg.DiffCmd{}
-
-		c.DiffStrategy, err = flags.GetString(flagDiffStrategy)
+		c, err := diffFlags(cmd)
 		if err != nil {
 			return err
 		}
@@ -48,6 +126,11 @@ var diffCmd = &cobra.Command{
 			return err
 		}
 
+		c.Fields, err = compareConfig(cmd, c.Discovery)
+		if err != nil {
+			return err
+		}
+
 		c.DefaultNamespace, err = defaultNamespace(clientConfig)
 		if err != nil {
 			return err
@@ -58,6 +141,10 @@ var diffCmd = &cobra.Command{
 			return err
 		}
 
+		if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+			return err
+		}
+
 		return c.Run(objs, cmd.OutOrStdout())
 	},
 }
@@ -26,18 +26,27 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/genuinetools/reg/registry"
 
 	jsonnet "github.com/google/go-jsonnet"
+	jsonnetAst "github.com/google/go-jsonnet/ast"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh/terminal"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/homedir"
 
+	"github.com/ksonnet/kubecfg/pkg/kubecfg"
 	"github.com/ksonnet/kubecfg/utils"
 
 	// Register auth plugins
@@ -54,10 +63,80 @@ const (
 	flagTlaVarFile = "tla-str-file"
 	flagResolver   = "resolve-images"
 	flagResolvFail = "resolve-images-error"
+	flagDiscoConc  = "discovery-concurrency"
+	flagDiscoTime  = "discovery-timeout"
+	flagLabel      = "label"
+	flagAnnotation = "annotation"
+	flagOverwrite  = "overwrite-labels"
+	flagResources  = "default-resources"
+	flagCacheDir   = "cache-dir"
+	flagCacheTTL   = "discovery-cache-ttl"
+	flagAsExtra    = "as-user-extra"
+	flagQPS        = "client-qps"
+	flagBurst      = "client-burst"
+	flagDiscoRetry = "discovery-retries"
+)
+
+// Defaults for flagQPS and flagBurst, well above client-go's (5 and
+// 10), since kubecfg makes many requests in quick succession.
+const (
+	defaultQPS   = 50
+	defaultBurst = 100
+)
+
+const (
+	// kubeVersionExtVar is the jsonnet external variable holding
+	// the server's version, as an object of numbers, eg:
+	//
+	//   std.extVar("__ksonnet/kubeVersion") == {major: 1, minor: 13}
+	//
+	// Commands that don't contact the server (eg: show), or that
+	// can't fetch its version, give the default version instead
+	// (currently 1.8; see utils.GetDefaultVersion).
+	kubeVersionExtVar = "__ksonnet/kubeVersion"
+
+	// contextExtVar is the jsonnet external variable holding the
+	// name of the kubeconfig context, as for currentContext().
+	contextExtVar = "__ksonnet/context"
 )
 
 var clientConfig clientcmd.ClientConfig
 var overrides clientcmd.ConfigOverrides
+var loadingRules *clientcmd.ClientConfigLoadingRules
+
+// serverDisco is set by restClientPool, for kubeVersionExtVar
+var serverDisco discovery.DiscoveryInterface
+
+// rateLimiter is shared by every client restConfig configures, so
+// --client-qps limits kubecfg as a whole, rather than each client
+// (one per API group version) separately.  Set by RootCmd.
+var rateLimiter flowcontrol.RateLimiter
+
+// evalTarget is the cluster that config is evaluated for.  The
+// native functions and external variables that depend on it are
+// only evaluated when used, and then set used, so that config that
+// doesn't depend on the cluster can be evaluated once for many.
+type evalTarget struct {
+	clientConfig clientcmd.ClientConfig
+	// context replaces --context, if set
+	context string
+	// disco is nil for commands that don't contact the server
+	disco discovery.DiscoveryInterface
+	used  bool
+}
+
+// defaultTarget is the target of commands acting on a single
+// cluster, as given by the kubectl flags.
+func defaultTarget() *evalTarget {
+	return &evalTarget{clientConfig: clientConfig, disco: serverDisco}
+}
+
+func (t *evalTarget) currentContext() (string, error) {
+	if t.context != "" {
+		return t.context, nil
+	}
+	return currentContext(t.clientConfig)
+}
 
 func init() {
 	RootCmd.PersistentFlags().CountP(flagVerbose, "v", "Increase verbosity. May be given multiple times.")
@@ -72,14 +151,27 @@ func init() {
 	RootCmd.MarkPersistentFlagFilename(flagTlaVarFile)
 	RootCmd.PersistentFlags().String(flagResolver, "noop", "Change implementation of resolveImage native function. One of: noop, registry")
 	RootCmd.PersistentFlags().String(flagResolvFail, "warn", "Action when resolveImage fails. One of ignore,warn,error")
+	RootCmd.PersistentFlags().StringArray(flagLabel, nil, "Add this label (key=value) to every object. May be repeated.")
+	RootCmd.PersistentFlags().StringArray(flagAnnotation, nil, "Add this annotation (key=value) to every object. May be repeated.")
+	RootCmd.PersistentFlags().Bool(flagOverwrite, false, "Let --"+flagLabel+" and --"+flagAnnotation+" replace values already set in config")
+	RootCmd.PersistentFlags().String(flagResources, "", "File of default resource requests and limits, set on containers that don't specify their own")
+	RootCmd.MarkPersistentFlagFilename(flagResources)
+	RootCmd.PersistentFlags().Int(flagDiscoConc, utils.DefaultDiscoveryConcurrency, "Maximum number of concurrent API discovery requests made while warming the discovery cache")
+	RootCmd.PersistentFlags().String(flagCacheDir, filepath.Join(homedir.HomeDir(), ".kube", "cache"), "Directory for cached API discovery results, shared with kubectl. Empty disables the cache")
+	RootCmd.PersistentFlags().Duration(flagCacheTTL, 10*time.Minute, "Maximum age of cached API discovery results. Zero disables the cache")
+	RootCmd.PersistentFlags().Duration(flagDiscoTime, 0, "Maximum time spent warming the discovery cache, after which remaining lookups are made as needed. Zero means no limit")
+	RootCmd.PersistentFlags().Int(flagDiscoRetry, utils.DefaultDiscoveryRetries, "Number of times an API discovery request is retried after a transient error (eg: 503), with exponential backoff")
+	RootCmd.PersistentFlags().Float32(flagQPS, defaultQPS, "Maximum sustained rate of requests per second to the server, across all clients")
+	RootCmd.PersistentFlags().Int(flagBurst, defaultBurst, "Maximum burst of requests to the server above --"+flagQPS)
 
 	// The "usual" clientcmd/kubectl flags
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
 	kflags := clientcmd.RecommendedConfigOverrideFlags("")
 	RootCmd.PersistentFlags().StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to a kube config. Only required if out-of-cluster")
 	RootCmd.MarkPersistentFlagFilename("kubeconfig")
 	clientcmd.BindOverrideFlags(&overrides, RootCmd.PersistentFlags(), kflags)
+	RootCmd.PersistentFlags().StringArray(flagAsExtra, nil, "Extra user info (key=value) to impersonate with --"+clientcmd.FlagImpersonate+". May be repeated, including for the same key")
 	clientConfig = clientcmd.NewInteractiveDeferredLoadingClientConfig(loadingRules, &overrides, os.Stdin)
 
 	RootCmd.PersistentFlags().Set("logtostderr", "true")
@@ -106,10 +198,42 @@ var RootCmd = &cobra.Command{
 		}
 		log.SetLevel(logLevel(verbosity))
 
+		rateLimiter, err = clientRateLimiter(cmd)
+		if err != nil {
+			return err
+		}
+
+		// Left over from an earlier Execute, in tests
+		serverDisco = nil
 		return nil
 	},
 }
 
+// clientRateLimiter returns a rate limiter for requests to the
+// server, as given by --client-qps and --client-burst.
+func clientRateLimiter(cmd *cobra.Command) (flowcontrol.RateLimiter, error) {
+	flags := cmd.Flags()
+	qps, err := flags.GetFloat32(flagQPS)
+	if err != nil {
+		return nil, err
+	}
+	burst, err := flags.GetInt(flagBurst)
+	if err != nil {
+		return nil, err
+	}
+	if qps <= 0 {
+		return nil, fmt.Errorf("--%s must be positive, not %v", flagQPS, qps)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("--%s must be at least 1, not %d", flagBurst, burst)
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(qps, burst), nil
+}
+
+// defaultNamespace returns the namespace for objects that don't set
+// their own: --namespace, else the namespace of c's context, else
+// "default".  Every command goes through here, so they all agree.
+//
 // clientConfig.Namespace() is broken in client-go 3.0:
 // namespace in config erroneously overrides explicit --namespace
 func defaultNamespace(c clientcmd.ClientConfig) (string, error) {
@@ -117,7 +241,14 @@ func defaultNamespace(c clientcmd.ClientConfig) (string, error) {
 		return overrides.Context.Namespace, nil
 	}
 	ns, _, err := c.Namespace()
-	return ns, err
+	if err != nil {
+		return "", err
+	}
+	if ns == "" {
+		// eg: in-cluster config without a service account namespace
+		ns = metav1.NamespaceDefault
+	}
+	return ns, nil
 }
 
 func logLevel(verbosity int) log.Level {
@@ -182,6 +313,11 @@ func dirURL(path string) *url.URL {
 // JsonnetVM constructs a new jsonnet.VM, according to command line
 // flags
 func JsonnetVM(cmd *cobra.Command) (*jsonnet.VM, error) {
+	return jsonnetVMFor(cmd, defaultTarget())
+}
+
+// jsonnetVMFor is JsonnetVM, evaluating config for target
+func jsonnetVMFor(cmd *cobra.Command, target *evalTarget) (*jsonnet.VM, error) {
 	vm := jsonnet.MakeVM()
 	flags := cmd.Flags()
 
@@ -228,6 +364,11 @@ func JsonnetVM(cmd *cobra.Command) (*jsonnet.VM, error) {
 
 	vm.Importer(utils.MakeUniversalImporter(searchUrls))
 
+	// Before --ext-str, so that they can be overridden.  These
+	// are only evaluated if used.
+	vm.ExtCode(kubeVersionExtVar, `std.native("kubeVersion")()`)
+	vm.ExtCode(contextExtVar, `std.native("currentContext")()`)
+
 	extvars, err := flags.GetStringSlice(flagExtVar)
 	if err != nil {
 		return nil, err
@@ -303,10 +444,74 @@ func JsonnetVM(cmd *cobra.Command) (*jsonnet.VM, error) {
 		return nil, err
 	}
 	utils.RegisterNativeFuncs(vm, resolver)
+	registerClientConfigNativeFuncs(vm, target)
 
 	return vm, nil
 }
 
+// kubeVersion returns the value of kubeVersionExtVar for the server
+// behind disco, if any.
+func kubeVersion(disco discovery.ServerVersionInterface) map[string]interface{} {
+	version := utils.GetDefaultVersion()
+	if disco != nil {
+		v, err := utils.FetchVersion(disco)
+		if err != nil {
+			log.Warnf("Unable to parse server version. Received %v. Using default %s for %s", err, version, kubeVersionExtVar)
+		} else {
+			version = v
+		}
+	}
+	return map[string]interface{}{
+		"major": float64(version.Major),
+		"minor": float64(version.Minor),
+	}
+}
+
+// registerClientConfigNativeFuncs adds native functions that expose
+// the resolved kubeconfig (and server) of target to jsonnet.  They
+// are only evaluated when called, so configs that don't use them
+// don't need a kubeconfig.
+func registerClientConfigNativeFuncs(vm *jsonnet.VM, target *evalTarget) {
+	vm.NativeFunction(&jsonnet.NativeFunction{
+		Name:   "currentNamespace",
+		Params: []jsonnetAst.Identifier{},
+		Func: func(args []interface{}) (res interface{}, err error) {
+			target.used = true
+			return defaultNamespace(target.clientConfig)
+		},
+	})
+
+	vm.NativeFunction(&jsonnet.NativeFunction{
+		Name:   "currentContext",
+		Params: []jsonnetAst.Identifier{},
+		Func: func(args []interface{}) (res interface{}, err error) {
+			target.used = true
+			return target.currentContext()
+		},
+	})
+
+	vm.NativeFunction(&jsonnet.NativeFunction{
+		Name:   "kubeVersion",
+		Params: []jsonnetAst.Identifier{},
+		Func: func(args []interface{}) (res interface{}, err error) {
+			target.used = true
+			return kubeVersion(target.disco), nil
+		},
+	})
+}
+
+// currentContext returns the name of the kubeconfig context in use
+func currentContext(c clientcmd.ClientConfig) (string, error) {
+	if overrides.CurrentContext != "" {
+		return overrides.CurrentContext, nil
+	}
+	raw, err := c.RawConfig()
+	if err != nil {
+		return "", err
+	}
+	return raw.CurrentContext, nil
+}
+
 func buildResolver(cmd *cobra.Command) (utils.Resolver, error) {
 	flags := cmd.Flags()
 	resolver, err := flags.GetString(flagResolver)
@@ -360,22 +565,173 @@ func (r *resolverErrorWrapper) Resolve(image *utils.ImageName) error {
 }
 
 func readObjs(cmd *cobra.Command, paths []string) ([]*unstructured.Unstructured, error) {
-	vm, err := JsonnetVM(cmd)
+	return readObjsWith(cmd, paths, nil)
+}
+
+// readObjsWith is like readObjs, but if failed is non-nil then files
+// (or top-level jsonnet entries) that fail to render are recorded in
+// failed and skipped, rather than aborting.  The result is then
+// incomplete, so this must never be used to update the cluster.
+func readObjsWith(cmd *cobra.Command, paths []string, failed *[]utils.RenderError) ([]*unstructured.Unstructured, error) {
+	target := defaultTarget()
+	objs, err := renderObjs(cmd, paths, failed, target)
+	if err != nil {
+		return nil, err
+	}
+	if err := finishObjs(cmd, objs, target); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// renderObjs evaluates paths for target, as for readObjsWith, but
+// without the additions made by finishObjs.
+func renderObjs(cmd *cobra.Command, paths []string, failed *[]utils.RenderError, target *evalTarget) ([]*unstructured.Unstructured, error) {
+	vm, err := jsonnetVMFor(cmd, target)
 	if err != nil {
 		return nil, err
 	}
 
 	res := []*unstructured.Unstructured{}
 	for _, path := range paths {
-		objs, err := utils.Read(vm, path)
+		var objs []runtime.Object
+		if failed != nil {
+			var errs []utils.RenderError
+			objs, errs = utils.ReadBestEffort(vm, path)
+			*failed = append(*failed, errs...)
+		} else {
+			objs, err = utils.Read(vm, path)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading %s: %v", path, err)
+			}
+		}
+		flattened, err := utils.FlattenToV1(objs)
 		if err != nil {
 			return nil, fmt.Errorf("Error reading %s: %v", path, err)
 		}
-		res = append(res, utils.FlattenToV1(objs)...)
+		res = append(res, flattened...)
 	}
 	return res, nil
 }
 
+// finishObjs adds the --label, --annotation and --default-resources
+// values for target to objs.
+func finishObjs(cmd *cobra.Command, objs []*unstructured.Unstructured, target *evalTarget) error {
+	if err := addGlobalMetadata(cmd, objs); err != nil {
+		return err
+	}
+	return addResourceDefaults(cmd, objs, target.clientConfig)
+}
+
+// addResourceDefaults sets the --default-resources requests and
+// limits on containers that don't have their own.
+func addResourceDefaults(cmd *cobra.Command, objs []*unstructured.Unstructured, cc clientcmd.ClientConfig) error {
+	path, err := cmd.Flags().GetString(flagResources)
+	if err != nil || path == "" {
+		return err
+	}
+	defaults, err := utils.ReadResourceDefaults(path)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", path, err)
+	}
+
+	// Best-effort: show may run without a usable kubeconfig
+	defaultNs, err := defaultNamespace(cc)
+	if err != nil {
+		log.Debugf("Unable to find default namespace for --%s: %v", flagResources, err)
+	}
+
+	for _, obj := range objs {
+		if err := defaults.Apply(obj, defaultNs); err != nil {
+			return fmt.Errorf("Error setting default resources on %s: %v", utils.FqName(obj), err)
+		}
+	}
+	return nil
+}
+
+// addGlobalMetadata adds the --label and --annotation values to
+// every object.
+func addGlobalMetadata(cmd *cobra.Command, objs []*unstructured.Unstructured) error {
+	flags := cmd.Flags()
+
+	labels, err := globalLabels(cmd)
+	if err != nil {
+		return err
+	}
+
+	annotationArgs, err := flags.GetStringArray(flagAnnotation)
+	if err != nil {
+		return err
+	}
+	annotations, err := parseKeyValues(flagAnnotation, annotationArgs)
+	if err != nil {
+		return err
+	}
+
+	overwrite, err := flags.GetBool(flagOverwrite)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		utils.MergeMetaDataLabels(obj, labels, overwrite)
+		utils.MergeMetaDataAnnotations(obj, annotations, overwrite)
+	}
+	return nil
+}
+
+// globalLabels returns the --label values.  These are only added to
+// object metadata, never to (immutable) label selectors.
+func globalLabels(cmd *cobra.Command) (map[string]string, error) {
+	labelArgs, err := cmd.Flags().GetStringArray(flagLabel)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseKeyValues(flagLabel, labelArgs)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range labels {
+		if k == kubecfg.LabelGcTag {
+			return nil, fmt.Errorf("Failed to parse %s: use --gc-tag to set %s", flagLabel, k)
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return nil, fmt.Errorf("Failed to parse %s: invalid value %q: %s", flagLabel, v, strings.Join(errs, "; "))
+		}
+	}
+	return labels, nil
+}
+
+func parseKeyValues(flag string, args []string) (map[string]string, error) {
+	ret := make(map[string]string, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Failed to parse %s: missing '=' in %s", flag, arg)
+		}
+		if errs := validation.IsQualifiedName(kv[0]); len(errs) > 0 {
+			return nil, fmt.Errorf("Failed to parse %s: invalid key %q: %s", flag, kv[0], strings.Join(errs, "; "))
+		}
+		ret[kv[0]] = kv[1]
+	}
+	return ret, nil
+}
+
+// prefetchDiscovery warms the discovery cache for the GroupVersions
+// used by objs, before the objects are processed one by one.
+func prefetchDiscovery(cmd *cobra.Command, disco discovery.DiscoveryInterface, objs []*unstructured.Unstructured) error {
+	concurrency, err := cmd.Flags().GetInt(flagDiscoConc)
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration(flagDiscoTime)
+	if err != nil {
+		return err
+	}
+	utils.PrefetchResources(disco, objs, concurrency, timeout)
+	return nil
+}
+
 // For debugging
 func dumpJSON(v interface{}) string {
 	buf := bytes.NewBuffer(nil)
@@ -387,10 +743,76 @@ func dumpJSON(v interface{}) string {
 	return string(buf.Bytes())
 }
 
+// restConfig returns the kubectl config from cc, impersonating as
+// given by --as, --as-group and --as-user-extra.  clientcmd has no
+// flag for the extra user info.  With --dry-run=server, every write
+// is a server-side dry run.
+func restConfig(cmd *cobra.Command, cc clientcmd.ClientConfig) (*rest.Config, error) {
+	conf, err := cc.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read kubectl config: %v", err)
+	}
+
+	extraArgs, err := cmd.Flags().GetStringArray(flagAsExtra)
+	if err != nil {
+		return nil, err
+	}
+	conf.Impersonate, err = impersonationConfig(conf.Impersonate, overrides.AuthInfo.ImpersonateGroups, extraArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if rateLimiter != nil {
+		conf.RateLimiter = rateLimiter
+	}
+
+	dryRun, err := dryRunMode(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun == "server" {
+		utils.WithServerDryRun(conf)
+	}
+	return conf, nil
+}
+
+// impersonationConfig adds groups and extraArgs (key=value) to imp.
+// clientcmd silently drops groups when there is no user, which would
+// run as the real user instead.
+func impersonationConfig(imp rest.ImpersonationConfig, groups, extraArgs []string) (rest.ImpersonationConfig, error) {
+	if imp.UserName == "" {
+		if len(groups) > 0 || len(extraArgs) > 0 {
+			return imp, fmt.Errorf("--%s and --%s need --%s", clientcmd.FlagImpersonateGroup, flagAsExtra, clientcmd.FlagImpersonate)
+		}
+		return imp, nil
+	}
+	for _, arg := range extraArgs {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return imp, fmt.Errorf("Failed to parse %s: missing '=' in %s", flagAsExtra, arg)
+		}
+		if imp.Extra == nil {
+			imp.Extra = map[string][]string{}
+		}
+		imp.Extra[kv[0]] = append(imp.Extra[kv[0]], kv[1])
+	}
+	return imp, nil
+}
+
 func restClientPool(cmd *cobra.Command) (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
-	conf, err := clientConfig.ClientConfig()
+	pool, disco, err := restClientPoolFor(cmd, clientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverDisco = disco
+	return pool, disco, nil
+}
+
+// restClientPoolFor is restClientPool, for the cluster of cc
+func restClientPoolFor(cmd *cobra.Command, cc clientcmd.ClientConfig) (dynamic.ClientPool, discovery.DiscoveryInterface, error) {
+	conf, err := restConfig(cmd, cc)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Unable to read kubectl config: %v", err)
+		return nil, nil, err
 	}
 
 	disco, err := discovery.NewDiscoveryClientForConfig(conf)
@@ -398,10 +820,47 @@ func restClientPool(cmd *cobra.Command) (dynamic.ClientPool, discovery.Discovery
 		return nil, nil, err
 	}
 
-	discoCache := utils.NewMemcachedDiscoveryClient(disco)
-	mapper := discovery.NewDeferredDiscoveryRESTMapper(discoCache, dynamic.VersionInterfaces)
-	pathresolver := dynamic.LegacyAPIPathResolverFunc
+	cacheDir, err := cmd.Flags().GetString(flagCacheDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	ttl, err := cmd.Flags().GetDuration(flagCacheTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+	retries, err := cmd.Flags().GetInt(flagDiscoRetry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var discoCache discovery.CachedDiscoveryInterface
+	if cacheDir != "" && ttl > 0 {
+		dir := utils.DiscoveryCacheDir(filepath.Join(cacheDir, "discovery"), conf.Host)
+		log.Debugf("Caching discovery results in %s", dir)
+		discoCache = utils.NewCachedDiscoveryClient(disco, dir, ttl)
+	} else {
+		discoCache = utils.NewMemcachedDiscoveryClient(disco, ttl)
+	}
+	utils.SetDiscoveryRetries(discoCache, retries)
+	return utils.NewClientPool(conf, discoCache), discoCache, nil
+}
+
+// impersonatingClientPools returns a factory for client pools that
+// act as another user on the cluster of cc, sharing disco (from
+// restClientPool).
+func impersonatingClientPools(cmd *cobra.Command, cc clientcmd.ClientConfig, disco discovery.DiscoveryInterface) kubecfg.ClientPoolFactory {
+	return func(user string) (dynamic.ClientPool, error) {
+		conf, err := restConfig(cmd, cc)
+		if err != nil {
+			return nil, err
+		}
+		// Replaces any --as given on the command line
+		conf.Impersonate = rest.ImpersonationConfig{UserName: user}
 
-	pool := dynamic.NewClientPool(conf, mapper, pathresolver)
-	return pool, discoCache, nil
+		discoCache, ok := disco.(discovery.CachedDiscoveryInterface)
+		if !ok {
+			discoCache = utils.NewMemcachedDiscoveryClient(disco, 0)
+		}
+		return utils.NewClientPool(conf, discoCache), nil
+	}
 }
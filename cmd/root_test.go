@@ -0,0 +1,173 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/rest"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestImpersonationConfig(t *testing.T) {
+	imp, err := impersonationConfig(rest.ImpersonationConfig{UserName: "jane", Groups: []string{"devs"}}, []string{"devs"}, []string{"reason=testing", "scopes=a", "scopes=b=c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"reason": {"testing"}, "scopes": {"a", "b=c"}}
+	if imp.UserName != "jane" || !reflect.DeepEqual(imp.Extra, expected) {
+		t.Errorf("Unexpected impersonation %#v", imp)
+	}
+
+	if _, err := impersonationConfig(rest.ImpersonationConfig{UserName: "jane"}, nil, []string{"reason"}); err == nil {
+		t.Error("Extra user info without '=' was accepted")
+	}
+	if _, err := impersonationConfig(rest.ImpersonationConfig{}, []string{"devs"}, nil); err == nil {
+		t.Error("--as-group without --as was accepted")
+	}
+	if _, err := impersonationConfig(rest.ImpersonationConfig{}, nil, []string{"reason=testing"}); err == nil {
+		t.Error("--as-user-extra without --as was accepted")
+	}
+}
+
+func TestKubeVersion(t *testing.T) {
+	disco := &fakedisco.FakeDiscovery{Fake: &ktesting.Fake{}}
+	disco.FakedServerVersion = &version.Info{Major: "1", Minor: "13+"}
+	expected := map[string]interface{}{"major": float64(1), "minor": float64(13)}
+	if v := kubeVersion(disco); !reflect.DeepEqual(v, expected) {
+		t.Errorf("Unexpected version %v", v)
+	}
+	expected = map[string]interface{}{"major": float64(1), "minor": float64(8)}
+	if v := kubeVersion(nil); !reflect.DeepEqual(v, expected) {
+		t.Errorf("Unexpected default %v", v)
+	}
+}
+
+func TestDefaultNamespace(t *testing.T) {
+	defer func() { overrides = clientcmd.ConfigOverrides{} }()
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters["c"] = &clientcmdapi.Cluster{Server: "https://example.com"}
+	config.AuthInfos["u"] = &clientcmdapi.AuthInfo{}
+	config.Contexts["pinned"] = &clientcmdapi.Context{Cluster: "c", AuthInfo: "u", Namespace: "team"}
+	config.Contexts["unpinned"] = &clientcmdapi.Context{Cluster: "c", AuthInfo: "u"}
+
+	for _, test := range []struct {
+		context, flag, expected string
+	}{
+		{"pinned", "", "team"},
+		{"pinned", "other", "other"},
+		{"unpinned", "", "default"},
+		{"unpinned", "other", "other"},
+	} {
+		overrides = clientcmd.ConfigOverrides{
+			CurrentContext: test.context,
+			Context:        clientcmdapi.Context{Namespace: test.flag},
+		}
+		cc := clientcmd.NewDefaultClientConfig(*config, &overrides)
+		ns, err := defaultNamespace(cc)
+		if err != nil {
+			t.Errorf("context %s, --namespace %q: %v", test.context, test.flag, err)
+		} else if ns != test.expected {
+			t.Errorf("context %s, --namespace %q: expected %q, got %q", test.context, test.flag, test.expected, ns)
+		}
+	}
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	var buf bytes.Buffer
+	RootCmd.SetOutput(&buf)
+	defer RootCmd.SetOutput(nil)
+	defer func() {
+		RootCmd.PersistentFlags().Set(flagQPS, fmt.Sprint(defaultQPS))
+		RootCmd.PersistentFlags().Set(flagBurst, fmt.Sprint(defaultBurst))
+	}()
+
+	RootCmd.SetArgs([]string{"show", "--client-qps", "0", "../testdata/test.yaml"})
+	if err := RootCmd.Execute(); err == nil {
+		t.Error("--client-qps 0 was accepted")
+	}
+
+	RootCmd.SetArgs([]string{"show", "--client-qps", "20", "--client-burst", "40", "../testdata/test.yaml"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if rateLimiter == nil || rateLimiter.QPS() != 20 {
+		t.Fatalf("Unexpected rate limiter %v", rateLimiter)
+	}
+
+	// Every client shares the one limiter
+	cc := clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		ClusterInfo: clientcmdapi.Cluster{Server: "https://example.com"},
+	})
+	conf, err := restConfig(showCmd, cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.RateLimiter != rateLimiter {
+		t.Errorf("Config has its own rate limiter")
+	}
+	_, disco, err := restClientPoolFor(showCmd, cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disco.RESTClient().GetRateLimiter() != rateLimiter {
+		t.Errorf("Discovery client has its own rate limiter")
+	}
+}
+
+func TestImpersonationHeaders(t *testing.T) {
+	var lock sync.Mutex
+	var requests []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.Header)
+		lock.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	RootCmd.SetOutput(&buf)
+	defer RootCmd.SetOutput(nil)
+	defer func() { overrides = clientcmd.ConfigOverrides{} }()
+
+	for _, subcmd := range []string{"diff", "update"} {
+		requests = nil
+		RootCmd.SetArgs([]string{subcmd, "--server", srv.URL, "--cache-dir", "", "--as", "jane", "--as-group", "devs", "../testdata/test.yaml"})
+		// The server has nothing to offer
+		RootCmd.Execute()
+
+		if len(requests) == 0 {
+			t.Errorf("%s made no requests", subcmd)
+		}
+		for _, h := range requests {
+			if h.Get("Impersonate-User") != "jane" || h.Get("Impersonate-Group") != "devs" {
+				t.Errorf("%s request lacks impersonation headers: %v", subcmd, h)
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+)
+
+const (
+	flagRunValidate = "validate"
+	flagRunDiff     = "diff"
+	flagRunUpdate   = "update"
+)
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+	runCmd.PersistentFlags().Bool(flagRunValidate, false, "Validate objects against the server schema, stopping if they are invalid")
+	runCmd.PersistentFlags().Bool(flagRunDiff, false, "Display differences between server and local config")
+	runCmd.PersistentFlags().Bool(flagRunUpdate, false, "Update Kubernetes resources with local config")
+}
+
+// shareRunFlags makes the flags of phase available to run, except
+// for those in skip.
+func shareRunFlags(phase *cobra.Command, skip ...string) {
+	phase.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		for _, s := range skip {
+			if f.Name == s {
+				return
+			}
+		}
+		if runCmd.PersistentFlags().Lookup(f.Name) == nil {
+			runCmd.PersistentFlags().AddFlag(f)
+		}
+	})
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Validate, diff and/or update, rendering and discovering only once",
+	Long: `Run the requested phases in order (validate, diff, then update), using
+the same rendered objects and discovery results for each.  A validation
+failure stops before anything is changed.  Each phase accepts the same
+flags as the corresponding subcommand.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		validate, err := flags.GetBool(flagRunValidate)
+		if err != nil {
+			return err
+		}
+		diff, err := flags.GetBool(flagRunDiff)
+		if err != nil {
+			return err
+		}
+		update, err := flags.GetBool(flagRunUpdate)
+		if err != nil {
+			return err
+		}
+		if !validate && !diff && !update {
+			return fmt.Errorf("Nothing to do: give at least one of --%s, --%s or --%s", flagRunValidate, flagRunDiff, flagRunUpdate)
+		}
+
+		// Read all the flags up front, so that a typo doesn't
+		// fail after earlier phases have run.
+		v, err := validateFlags(cmd)
+		if err != nil {
+			return err
+		}
+		d, err := diffFlags(cmd)
+		if err != nil {
+			return err
+		}
+		u, err := updateFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		pool, disco, err := restClientPool(cmd)
+		if err != nil {
+			return err
+		}
+
+		namespace, err := defaultNamespace(clientConfig)
+		if err != nil {
+			return err
+		}
+
+		if diff || update {
+			fields, err := compareConfig(cmd, disco)
+			if err != nil {
+				return err
+			}
+			d.Fields, u.Fields = fields, fields
+		}
+
+		objs, err := readObjs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		if err := prefetchDiscovery(cmd, disco, objs); err != nil {
+			return err
+		}
+
+		if validate {
+			v.Discovery = disco
+			if offline, err := schemaFileDiscovery(cmd); err != nil {
+				return err
+			} else if offline != nil {
+				v.Discovery, v.Offline = offline, true
+			}
+			if err := v.Run(objs, cmd.OutOrStdout()); err != nil {
+				return err
+			}
+		}
+
+		diffFound := false
+		if diff {
+			d.ClientPool, d.Discovery, d.DefaultNamespace = pool, disco, namespace
+			err := d.Run(objs, cmd.OutOrStdout())
+			if err == kubecfg.ErrDiffFound {
+				diffFound = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if update {
+			u.ClientPool, u.Discovery, u.DefaultNamespace = pool, disco, namespace
+			u.Impersonate = impersonatingClientPools(cmd, clientConfig, disco)
+			u.ServerSide, err = serverSideApplier(cmd, clientConfig, disco)
+			if err != nil {
+				return err
+			}
+			// Any differences are resolved by the update
+			return u.Run(objs)
+		}
+
+		if diffFound {
+			return kubecfg.ErrDiffFound
+		}
+		return nil
+	},
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRunFlags(t *testing.T) {
+	flags := runCmd.PersistentFlags()
+
+	// Each phase's flags are available
+	for _, name := range []string{flagStrictWarnings, flagDiffStrategy, flagMergeKey, flagIgnorePath, flagGcTag, flagOnlyChanged} {
+		if flags.Lookup(name) == nil {
+			t.Errorf("run is missing --%s", name)
+		}
+	}
+
+	// These belong to run itself, or to validate and diff
+	if f := flags.Lookup(flagRunValidate); f == nil || f.DefValue != "false" {
+		t.Errorf("Unexpected --%s: %v", flagRunValidate, f)
+	}
+	if f := flags.Lookup(flagIgnoreUnknown); f == nil || f != validateCmd.PersistentFlags().Lookup(flagIgnoreUnknown) {
+		t.Errorf("Unexpected --%s: %v", flagIgnoreUnknown, f)
+	}
+	if f := flags.Lookup(flagOutput); f == nil || f != diffCmd.PersistentFlags().Lookup(flagOutput) {
+		t.Errorf("Unexpected --%s: %v", flagOutput, f)
+	}
+}
+
+func TestRunNothing(t *testing.T) {
+	var buf bytes.Buffer
+	RootCmd.SetOutput(&buf)
+	defer RootCmd.SetOutput(nil)
+
+	RootCmd.SetArgs([]string{"run"})
+	if err := RootCmd.Execute(); err == nil {
+		t.Errorf("run without any phases succeeded")
+	}
+}
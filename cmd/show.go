@@ -16,18 +16,24 @@
 package cmd
 
 import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+	"github.com/ksonnet/kubecfg/utils"
 )
 
 const (
-	flagFormat = "format"
+	flagFormat     = "format"
+	flagBestEffort = "best-effort"
 )
 
 func init() {
 	RootCmd.AddCommand(showCmd)
 	showCmd.PersistentFlags().StringP(flagFormat, "o", "yaml", "Output format.  Supported values are: json, yaml")
+	showCmd.PersistentFlags().Bool(flagBestEffort, false, "Show the files and top-level entries that render, and report those that fail.  The output is incomplete, and the command still fails")
 }
 
 var showCmd = &cobra.Command{
@@ -45,11 +51,32 @@ var showCmd = &cobra.Command{
 			return err
 		}
 
-		objs, err := readObjs(cmd, args)
+		bestEffort, err := flags.GetBool(flagBestEffort)
 		if err != nil {
 			return err
 		}
+		if !bestEffort {
+			objs, err := readObjs(cmd, args)
+			if err != nil {
+				return err
+			}
+			return c.Run(objs, cmd.OutOrStdout())
+		}
 
-		return c.Run(objs, cmd.OutOrStdout())
+		var failed []utils.RenderError
+		objs, err := readObjsWith(cmd, args, &failed)
+		if err != nil {
+			return err
+		}
+		if err := c.Run(objs, cmd.OutOrStdout()); err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			for _, f := range failed {
+				log.Errorf("Failed to render %v", f)
+			}
+			return fmt.Errorf("Output is incomplete: %d entries failed to render", len(failed))
+		}
+		return nil
 	},
 }
@@ -18,6 +18,7 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -96,3 +97,56 @@ func TestShow(t *testing.T) {
 		}
 	}
 }
+
+func TestShowCurrentNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubecfg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "context.jsonnet")
+	src := `
+local kubecfg = import "kubecfg.libsonnet";
+{
+  apiVersion: "v0alpha1",
+  kind: "TestObject",
+  namespace: kubecfg.currentNamespace(),
+  context: kubecfg.currentContext(),
+  contextVar: std.extVar("__ksonnet/context"),
+  // show doesn't contact the server
+  kubeVersion: std.extVar("__ksonnet/kubeVersion"),
+}
+`
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags persist across tests sharing RootCmd, including
+	// TestShow's `-V anVar`
+	os.Setenv("anVar", "aVal2")
+	defer os.Unsetenv("anVar")
+
+	defer RootCmd.PersistentFlags().Set("namespace", "")
+	defer RootCmd.PersistentFlags().Set("context", "")
+	output := cmdOutput(t, []string{"show",
+		"-o", "json",
+		"--namespace", "myns",
+		"--context", "myctx",
+		path,
+	})
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &actual); err != nil {
+		t.Fatalf("error parsing output: %v", err)
+	}
+	if actual["namespace"] != "myns" {
+		t.Errorf("Wrong namespace %q", actual["namespace"])
+	}
+	if actual["context"] != "myctx" || actual["contextVar"] != "myctx" {
+		t.Errorf("Wrong context %q, %q", actual["context"], actual["contextVar"])
+	}
+	if v := actual["kubeVersion"]; !reflect.DeepEqual(v, map[string]interface{}{"major": float64(1), "minor": float64(8)}) {
+		t.Errorf("Wrong kubeVersion %v", v)
+	}
+}
@@ -16,17 +16,45 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+	"github.com/ksonnet/kubecfg/utils"
 )
 
 const (
-	flagCreate   = "create"
-	flagSkipGc   = "skip-gc"
-	flagGcTag    = "gc-tag"
-	flagDryRun   = "dry-run"
-	flagValidate = "validate"
+	flagCreate          = "create"
+	flagSkipGc          = "skip-gc"
+	flagGcTag           = "gc-tag"
+	flagPruneTag        = "prune-tag"
+	flagDryRun          = "dry-run"
+	flagValidate        = "validate"
+	flagRecreate        = "recreate-immutable"
+	flagRefuseDowngrade = "refuse-downgrade"
+	flagOnlyChanged     = "only-changed"
+	flagSkipConversions = "skip-unavailable-conversions"
+	flagSkipUnknown     = "skip-unknown"
+	flagLabelSelectors  = "add-labels-to-new-selectors"
+	flagAdoptFromHelm   = "adopt-from-helm"
+	flagServerSide      = "server-side"
+	flagFieldManager    = "field-manager"
+	flagForceConflicts  = "force-conflicts"
+	flagConflicts       = "conflict-attempts"
+	flagParallelism     = "parallelism"
+	flagFailFast        = "fail-fast"
+	flagWait            = "wait"
+	flagWaitTimeout     = "wait-timeout"
+	flagContexts        = "contexts"
+	flagAllContexts     = "all-contexts"
 )
 
 func init() {
@@ -34,9 +62,219 @@ func init() {
 	updateCmd.PersistentFlags().Bool(flagCreate, true, "Create missing resources")
 	updateCmd.PersistentFlags().Bool(flagSkipGc, false, "Don't perform garbage collection, even with --"+flagGcTag)
 	updateCmd.PersistentFlags().String(flagGcTag, "", "Add this tag to updated objects, and garbage collect existing objects with this tag and not in config")
-	updateCmd.PersistentFlags().Bool(flagDryRun, false, "Perform only read-only operations")
+	updateCmd.PersistentFlags().String(flagPruneTag, "", "Garbage collect existing objects with this tag and not in config, instead of the --"+flagGcTag+" value. Defaults to --"+flagGcTag)
+	addDryRunFlag(updateCmd, "Perform only read-only operations")
 	updateCmd.PersistentFlags().Bool(flagValidate, true, "Validate input against server schema")
+	updateCmd.PersistentFlags().Bool(flagRecreate, false, "Delete and recreate immutable ConfigMaps and Secrets whose data has changed")
+	updateCmd.PersistentFlags().Bool(flagRefuseDowngrade, false, "Refuse to update objects last updated by a newer kubecfg release, instead of warning")
+	updateCmd.PersistentFlags().Bool(flagOnlyChanged, false, "Compare objects with the server first, and only update those that differ")
+	updateCmd.PersistentFlags().String(flagCompare, "", "With --"+flagOnlyChanged+", file listing the fields to include or exclude when comparing objects of each kind")
+	updateCmd.PersistentFlags().StringArray(flagIgnorePath, nil, "With --"+flagOnlyChanged+", field (eg: spec.replicas) to ignore when comparing objects of every kind, including everything below it.  May be repeated")
+	updateCmd.PersistentFlags().Bool(flagSkipUnknown, false, "Skip objects of kinds the server doesn't serve, with a warning, instead of failing before updating anything")
+	updateCmd.PersistentFlags().Bool(flagSkipConversions, false, "Skip custom resources whose CRD conversion webhook is unavailable, instead of failing")
+	updateCmd.PersistentFlags().Bool(flagLabelSelectors, false, "Also add --"+flagLabel+" values to the label selectors of objects being created.  Existing selectors are never changed")
+	updateCmd.PersistentFlags().Bool(flagAdoptFromHelm, false, "Take over objects managed by Helm, removing Helm's labels and annotations")
+	updateCmd.PersistentFlags().Bool(flagServerSide, false, "Write objects with server-side apply, rather than a merge patch. Needs Kubernetes 1.16 or later")
+	updateCmd.PersistentFlags().String(flagFieldManager, "kubecfg", "Name of the field manager that owns fields written with --"+flagServerSide)
+	updateCmd.PersistentFlags().Bool(flagForceConflicts, false, "With --"+flagServerSide+", take ownership of fields owned by other field managers, rather than failing")
+	updateCmd.PersistentFlags().Int(flagConflicts, kubecfg.DefaultConflictAttempts, "Number of times to try writing an object that is being modified concurrently")
+	updateCmd.PersistentFlags().Int(flagParallelism, 4, "Number of objects to update at once. Objects that others may depend on (eg: namespaces and CRDs) are still updated first")
+	updateCmd.PersistentFlags().Bool(flagFailFast, false, "Stop at the first failed object, rather than attempting the rest of its dependency tier and reporting all failures")
+	updateCmd.PersistentFlags().Bool(flagWait, false, "Wait for updated objects to become ready (eg: Deployments rolled out, Jobs complete)")
+	updateCmd.PersistentFlags().Duration(flagWaitTimeout, 5*time.Minute, "With --"+flagWait+", fail if objects are not ready after this long. Zero means wait forever")
+	updateCmd.PersistentFlags().StringP(flagOutput, "o", "text", "Output format.  Supported values are: text, ndjson (a line of JSON on stdout as each object is updated)")
 	updateCmd.PersistentFlags().Bool(flagIgnoreUnknown, false, "Don't fail validation if the schema for a given resource type is not found")
+	updateCmd.PersistentFlags().StringSlice(flagContexts, nil, "Update each of these kubeconfig contexts in turn, instead of the current one")
+	updateCmd.PersistentFlags().Bool(flagAllContexts, false, "Update every kubeconfig context in turn, instead of the current one")
+	// run has its own --validate phase, which uses validate's
+	// flags, and --output is diff's.  It acts on a single context.
+	shareRunFlags(updateCmd, flagValidate, flagIgnoreUnknown, flagOutput, flagContexts, flagAllContexts)
+}
+
+// eventsOutput returns where to stream per-object events for
+// --output, if anywhere.  Logs still go to stderr.
+func eventsOutput(cmd *cobra.Command) (io.Writer, error) {
+	output, err := cmd.Flags().GetString(flagOutput)
+	if err != nil {
+		return nil, err
+	}
+	switch output {
+	case "", "text":
+		return nil, nil
+	case "ndjson":
+		return cmd.OutOrStdout(), nil
+	default:
+		return nil, fmt.Errorf("Unknown --output: %s", output)
+	}
+}
+
+// logObserver logs the outcome for each object, in verbose mode.
+// Failures are also reported in the command's error.
+type logObserver struct{}
+
+func (logObserver) OnObject(gvk schema.GroupVersionKind, namespace, name string, action kubecfg.Action, err error) {
+	if namespace != "" {
+		name = namespace + "/" + name
+	}
+	if err != nil {
+		log.Debugf(" %s %s: %s: %v", gvk.Kind, name, action, err)
+	} else {
+		log.Debugf(" %s %s: %s", gvk.Kind, name, action)
+	}
+}
+
+// addDryRunFlag adds --dry-run to cmd.  A bare --dry-run means
+// --dry-run=client, as it did when the flag was a bool.
+func addDryRunFlag(cmd *cobra.Command, usage string) {
+	cmd.PersistentFlags().String(flagDryRun, "none", usage+". One of: none, client (kubecfg only reads from the server), server (the server runs admission and defaulting without persisting anything; needs Kubernetes 1.13 or later)")
+	cmd.PersistentFlags().Lookup(flagDryRun).NoOptDefVal = "client"
+}
+
+// dryRunMode returns the --dry-run mode: none, client or server.
+// Commands without --dry-run never dry run.
+func dryRunMode(cmd *cobra.Command) (string, error) {
+	f := cmd.Flags().Lookup(flagDryRun)
+	if f == nil {
+		return "none", nil
+	}
+	switch mode := f.Value.String(); mode {
+	case "", "none", "false":
+		return "none", nil
+	case "client", "true":
+		return "client", nil
+	case "server":
+		return "server", nil
+	default:
+		return "", fmt.Errorf("Unknown --%s %q, expected none, client or server", flagDryRun, mode)
+	}
+}
+
+// updateFlags returns an UpdateCmd configured from cmd's flags,
+// other than --validate and --output.
+func updateFlags(cmd *cobra.Command) (kubecfg.UpdateCmd, error) {
+	flags := cmd.Flags()
+	var err error
+
+	c := kubecfg.UpdateCmd{}
+
+	c.Create, err = flags.GetBool(flagCreate)
+	if err != nil {
+		return c, err
+	}
+
+	c.GcTag, err = flags.GetString(flagGcTag)
+	if err != nil {
+		return c, err
+	}
+
+	c.PruneTag, err = flags.GetString(flagPruneTag)
+	if err != nil {
+		return c, err
+	}
+
+	c.SkipGc, err = flags.GetBool(flagSkipGc)
+	if err != nil {
+		return c, err
+	}
+
+	dryRun, err := dryRunMode(cmd)
+	if err != nil {
+		return c, err
+	}
+	c.DryRun, c.ServerDryRun = dryRun == "client", dryRun == "server"
+
+	c.RecreateImmutable, err = flags.GetBool(flagRecreate)
+	if err != nil {
+		return c, err
+	}
+
+	c.RefuseDowngrade, err = flags.GetBool(flagRefuseDowngrade)
+	if err != nil {
+		return c, err
+	}
+
+	c.OnlyChanged, err = flags.GetBool(flagOnlyChanged)
+	if err != nil {
+		return c, err
+	}
+
+	c.SkipUnknown, err = flags.GetBool(flagSkipUnknown)
+	if err != nil {
+		return c, err
+	}
+
+	c.SkipUnavailableConversions, err = flags.GetBool(flagSkipConversions)
+	if err != nil {
+		return c, err
+	}
+
+	c.AdoptFromHelm, err = flags.GetBool(flagAdoptFromHelm)
+	if err != nil {
+		return c, err
+	}
+	labelSelectors, err := flags.GetBool(flagLabelSelectors)
+	if err != nil {
+		return c, err
+	}
+	if labelSelectors {
+		c.SelectorLabels, err = globalLabels(cmd)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	c.FieldManager, err = flags.GetString(flagFieldManager)
+	if err != nil {
+		return c, err
+	}
+
+	c.ForceConflicts, err = flags.GetBool(flagForceConflicts)
+	if err != nil {
+		return c, err
+	}
+
+	c.ConflictAttempts, err = flags.GetInt(flagConflicts)
+	if err != nil {
+		return c, err
+	}
+
+	c.Parallelism, err = flags.GetInt(flagParallelism)
+	if err != nil {
+		return c, err
+	}
+
+	c.FailFast, err = flags.GetBool(flagFailFast)
+	if err != nil {
+		return c, err
+	}
+
+	c.Wait, err = flags.GetBool(flagWait)
+	if err != nil {
+		return c, err
+	}
+
+	c.WaitTimeout, err = flags.GetDuration(flagWaitTimeout)
+	if err != nil {
+		return c, err
+	}
+
+	c.Version = Version
+
+	return c, nil
+}
+
+// serverSideApplier returns the Applier for --server-side, if given,
+// for the cluster of cc, sharing disco (from restClientPool).
+func serverSideApplier(cmd *cobra.Command, cc clientcmd.ClientConfig, disco discovery.DiscoveryInterface) (kubecfg.Applier, error) {
+	serverSide, err := cmd.Flags().GetBool(flagServerSide)
+	if err != nil || !serverSide {
+		return nil, err
+	}
+	conf, err := restConfig(cmd, cc)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewApplier(conf, disco), nil
 }
 
 var updateCmd = &cobra.Command{
@@ -44,65 +282,87 @@ var updateCmd = &cobra.Command{
 	Short: "Update Kubernetes resources with local config",
 	Args:  cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flags := cmd.Flags()
-		var err error
-		c := kubecfg.UpdateCmd{}
-
-		validate, err := flags.GetBool(flagValidate)
+		contexts, err := targetContexts(cmd)
 		if err != nil {
 			return err
 		}
-
-		c.Create, err = flags.GetBool(flagCreate)
-		if err != nil {
-			return err
+		if len(contexts) > 0 {
+			return updateContexts(cmd, args, contexts)
 		}
 
-		c.GcTag, err = flags.GetString(flagGcTag)
-		if err != nil {
-			return err
-		}
+		return runUpdate(cmd, clientConfig, func(disco discovery.DiscoveryInterface) ([]*unstructured.Unstructured, error) {
+			// For kubeVersionExtVar
+			serverDisco = disco
+			return readObjs(cmd, args)
+		})
+	},
+}
 
-		c.SkipGc, err = flags.GetBool(flagSkipGc)
-		if err != nil {
-			return err
-		}
+// runUpdate updates the cluster of cc with the objects returned by
+// read, which is given that cluster's discovery client.
+func runUpdate(cmd *cobra.Command, cc clientcmd.ClientConfig, read func(discovery.DiscoveryInterface) ([]*unstructured.Unstructured, error)) error {
+	flags := cmd.Flags()
 
-		c.DryRun, err = flags.GetBool(flagDryRun)
-		if err != nil {
-			return err
-		}
+	validate, err := flags.GetBool(flagValidate)
+	if err != nil {
+		return err
+	}
 
-		c.ClientPool, c.Discovery, err = restClientPool(cmd)
-		if err != nil {
-			return err
-		}
+	c, err := updateFlags(cmd)
+	if err != nil {
+		return err
+	}
 
-		c.DefaultNamespace, err = defaultNamespace(clientConfig)
-		if err != nil {
-			return err
+	c.Events, err = eventsOutput(cmd)
+	if err != nil {
+		return err
+	}
+	c.Observer = logObserver{}
+
+	c.ClientPool, c.Discovery, err = restClientPoolFor(cmd, cc)
+	if err != nil {
+		return err
+	}
+	c.Impersonate = impersonatingClientPools(cmd, cc, c.Discovery)
+
+	c.ServerSide, err = serverSideApplier(cmd, cc, c.Discovery)
+	if err != nil {
+		return err
+	}
+
+	c.Fields, err = compareConfig(cmd, c.Discovery)
+	if err != nil {
+		return err
+	}
+
+	c.DefaultNamespace, err = defaultNamespace(cc)
+	if err != nil {
+		return err
+	}
+
+	objs, err := read(c.Discovery)
+	if err != nil {
+		return err
+	}
+
+	if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+		return err
+	}
+
+	if validate {
+		v := kubecfg.ValidateCmd{
+			Discovery: c.Discovery,
 		}
 
-		objs, err := readObjs(cmd, args)
+		v.IgnoreUnknown, err = flags.GetBool(flagIgnoreUnknown)
 		if err != nil {
 			return err
 		}
 
-		if validate {
-			v := kubecfg.ValidateCmd{
-				Discovery: c.Discovery,
-			}
-
-			v.IgnoreUnknown, err = flags.GetBool(flagIgnoreUnknown)
-			if err != nil {
-				return err
-			}
-
-			if err := v.Run(objs, cmd.OutOrStdout()); err != nil {
-				return err
-			}
+		if err := v.Run(objs, cmd.OutOrStdout()); err != nil {
+			return err
 		}
+	}
 
-		return c.Run(objs)
-	},
+	return c.Run(objs)
 }
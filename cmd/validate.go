@@ -17,17 +17,58 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/discovery"
 
 	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+	"github.com/ksonnet/kubecfg/utils"
 )
 
 const (
-	flagIgnoreUnknown = "ignore-unknown"
+	flagIgnoreUnknown  = "ignore-unknown"
+	flagStrictWarnings = "strict-warnings"
+	flagSchemaFile     = "schema-file"
 )
 
 func init() {
 	RootCmd.AddCommand(validateCmd)
 	validateCmd.PersistentFlags().Bool(flagIgnoreUnknown, true, "Don't fail if the schema for a given resource type is not found")
+	validateCmd.PersistentFlags().Bool(flagStrictWarnings, false, "Treat validation warnings as errors")
+	validateCmd.PersistentFlags().String(flagSchemaFile, "", "Validate against this saved OpenAPI document (JSON or protobuf), without contacting the server")
+	shareRunFlags(validateCmd)
+}
+
+// validateFlags returns a ValidateCmd configured from cmd's flags
+func validateFlags(cmd *cobra.Command) (kubecfg.ValidateCmd, error) {
+	flags := cmd.Flags()
+	var err error
+
+	c := kubecfg.ValidateCmd{}
+
+	c.IgnoreUnknown, err = flags.GetBool(flagIgnoreUnknown)
+	if err != nil {
+		return c, err
+	}
+
+	c.WarningsAsErrors, err = flags.GetBool(flagStrictWarnings)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// schemaFileDiscovery returns a discovery client serving the
+// --schema-file document, if given.
+func schemaFileDiscovery(cmd *cobra.Command) (discovery.DiscoveryInterface, error) {
+	path, err := cmd.Flags().GetString(flagSchemaFile)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	doc, err := utils.ReadOpenAPIDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewOfflineDiscoveryClient(doc), nil
 }
 
 var validateCmd = &cobra.Command{
@@ -35,26 +76,34 @@ var validateCmd = &cobra.Command{
 	Short: "Compare generated manifest against server OpenAPI spec",
 	Args:  cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flags := cmd.Flags()
-		var err error
-
-		c := kubecfg.ValidateCmd{}
-
-		_, c.Discovery, err = restClientPool(cmd)
+		c, err := validateFlags(cmd)
 		if err != nil {
 			return err
 		}
 
-		c.IgnoreUnknown, err = flags.GetBool(flagIgnoreUnknown)
+		c.Discovery, err = schemaFileDiscovery(cmd)
 		if err != nil {
 			return err
 		}
+		c.Offline = c.Discovery != nil
+		if !c.Offline {
+			_, c.Discovery, err = restClientPool(cmd)
+			if err != nil {
+				return err
+			}
+		}
 
 		objs, err := readObjs(cmd, args)
 		if err != nil {
 			return err
 		}
 
+		if !c.Offline {
+			if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+				return err
+			}
+		}
+
 		return c.Run(objs, cmd.OutOrStdout())
 	},
 }
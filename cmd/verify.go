@@ -0,0 +1,78 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ksonnet/kubecfg/pkg/kubecfg"
+)
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.PersistentFlags().String(flagGcTag, "", "Also fail on existing objects with this tag that are not in config")
+	verifyCmd.PersistentFlags().String(flagCompare, "", "File listing the fields to include or exclude when comparing objects of each kind")
+	verifyCmd.PersistentFlags().StringArray(flagIgnorePath, nil, "Field (eg: spec.replicas) to ignore when comparing objects of every kind, including everything below it.  May be repeated")
+	verifyCmd.PersistentFlags().StringP(flagOutput, "o", "text", "Output format.  Supported values are: text, json")
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the server matches local config, without changing anything",
+	Args:  cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		var err error
+
+		c := kubecfg.VerifyCmd{}
+
+		c.GcTag, err = flags.GetString(flagGcTag)
+		if err != nil {
+			return err
+		}
+
+		c.OutputFormat, err = flags.GetString(flagOutput)
+		if err != nil {
+			return err
+		}
+
+		c.ClientPool, c.Discovery, err = restClientPool(cmd)
+		if err != nil {
+			return err
+		}
+
+		c.Fields, err = compareConfig(cmd, c.Discovery)
+		if err != nil {
+			return err
+		}
+
+		c.DefaultNamespace, err = defaultNamespace(clientConfig)
+		if err != nil {
+			return err
+		}
+
+		objs, err := readObjs(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		if err := prefetchDiscovery(cmd, c.Discovery, objs); err != nil {
+			return err
+		}
+
+		return c.Run(objs, cmd.OutOrStdout())
+	},
+}
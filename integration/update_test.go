@@ -32,7 +32,7 @@ func restClientPool(conf *restclient.Config) (dynamic.ClientPool, discovery.Disc
 		return nil, nil, err
 	}
 
-	discoCache := utils.NewMemcachedDiscoveryClient(disco)
+	discoCache := utils.NewMemcachedDiscoveryClient(disco, 0)
 	mapper := discovery.NewDeferredDiscoveryRESTMapper(discoCache, dynamic.VersionInterfaces)
 	pathresolver := dynamic.LegacyAPIPathResolverFunc
 
@@ -56,4 +56,32 @@
   // to refer to submatches.  Regex is as implemented in golang regexp
   // package (python-ish).
   regexSubst:: std.native("regexSubst"),
+
+  // currentNamespace(): Returns the namespace that objects without
+  // an explicit namespace will be sent to, from --namespace or the
+  // current kubeconfig context.  Note that using this makes the
+  // output of `kubecfg show` depend on the local kubeconfig.
+  currentNamespace:: std.native("currentNamespace"),
+
+  // currentContext(): Returns the name of the kubeconfig context in
+  // use, from --context or the kubeconfig.  Note that using this
+  // makes the output of `kubecfg show` depend on the local
+  // kubeconfig.
+  currentContext:: std.native("currentContext"),
+
+  // hashObject(obj): Returns a hex SHA-256 hash of the JSON encoding
+  // of obj, which doesn't depend on field order.  Appending (a
+  // prefix of) the hash of a ConfigMap or Secret's data to its name
+  // makes consuming Deployments roll out whenever the data changes:
+  //
+  //   local data = {"app.conf": importstr "app.conf"},
+  //   configMap: {
+  //     metadata: {
+  //       name: "app-" + std.substr(kubecfg.hashObject(data), 0, 10),
+  //     },
+  //     data: data,
+  //   },
+  //
+  // ..with the Deployment referring to $.configMap.metadata.name.
+  hashObject:: std.native("hashObject"),
 }
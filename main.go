@@ -38,7 +38,7 @@ func main() {
 		log.Error(err.Error())
 
 		switch err {
-		case kubecfg.ErrDiffFound:
+		case kubecfg.ErrDiffFound, kubecfg.ErrVerifyFailed:
 			os.Exit(10)
 		default:
 			os.Exit(1)
@@ -0,0 +1,70 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"regexp"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationAppliedVersion records the version of kubecfg that last
+// updated an object.
+const AnnotationAppliedVersion = "kubecfg.ksonnet.io/applied-version"
+
+var releaseVersionRe = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)\.([0-9]+)`)
+
+// parseReleaseVersion parses a "vX.Y.Z" release version.  Development
+// builds don't have a meaningful order, and are reported as !ok.
+func parseReleaseVersion(v string) (ret [3]int, ok bool) {
+	m := releaseVersionRe.FindStringSubmatch(v)
+	if m == nil {
+		return ret, false
+	}
+	for i := range ret {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return ret, false
+		}
+		ret[i] = n
+	}
+	return ret, true
+}
+
+// newerAppliedVersion returns the version recorded on live if it is
+// newer than running.  It returns "" if either version is not a
+// release version.
+func newerAppliedVersion(live metav1.Object, running string) string {
+	applied := live.GetAnnotations()[AnnotationAppliedVersion]
+	a, ok := parseReleaseVersion(applied)
+	if !ok {
+		return ""
+	}
+	r, ok := parseReleaseVersion(running)
+	if !ok {
+		return ""
+	}
+	for i := range a {
+		if a[i] != r[i] {
+			if a[i] > r[i] {
+				return applied
+			}
+			return ""
+		}
+	}
+	return ""
+}
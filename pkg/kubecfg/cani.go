@@ -0,0 +1,127 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+// DefaultCanIVerbs are the verbs that update may use on each object
+var DefaultCanIVerbs = []string{"get", "create", "patch"}
+
+var (
+	gvkSelfSubjectAccessReview  = schema.GroupVersionKind{Group: "authorization.k8s.io", Version: "v1", Kind: "SelfSubjectAccessReview"}
+	rsrcSelfSubjectAccessReview = metav1.APIResource{Name: "selfsubjectaccessreviews", Kind: "SelfSubjectAccessReview"}
+)
+
+// CanICmd represents the can-i subcommand
+type CanICmd struct {
+	ClientPool       dynamic.ClientPool
+	Discovery        discovery.DiscoveryInterface
+	DefaultNamespace string
+
+	Verbs []string
+}
+
+func (c CanICmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
+	client, err := c.ClientPool.ClientForGroupVersionKind(gvkSelfSubjectAccessReview)
+	if err != nil {
+		return err
+	}
+	rc := client.Resource(&rsrcSelfSubjectAccessReview, metav1.NamespaceNone)
+
+	denied := 0
+	for _, obj := range apiObjects {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		log.Debug("Checking permissions for ", desc)
+
+		rsrc, err := utils.ResourceFor(c.Discovery, obj)
+		if err != nil {
+			return err
+		}
+
+		namespace := ""
+		if rsrc.Namespaced {
+			namespace = obj.GetNamespace()
+			if namespace == "" {
+				namespace = c.DefaultNamespace
+			}
+		}
+
+		var deniedVerbs []string
+		for _, verb := range c.Verbs {
+			attrs := map[string]interface{}{
+				"verb":     verb,
+				"group":    obj.GroupVersionKind().Group,
+				"resource": rsrc.Name,
+			}
+			if namespace != "" {
+				attrs["namespace"] = namespace
+			}
+			if verb != "create" {
+				// RBAC can't restrict create by name
+				attrs["name"] = obj.GetName()
+			}
+			review := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": gvkSelfSubjectAccessReview.GroupVersion().String(),
+					"kind":       gvkSelfSubjectAccessReview.Kind,
+					"spec": map[string]interface{}{
+						"resourceAttributes": attrs,
+					},
+				},
+			}
+
+			result, err := rc.Create(review)
+			if err != nil {
+				return fmt.Errorf("Error checking permission to %s %s: %v", verb, desc, err)
+			}
+
+			allowed, _, _ := unstructured.NestedBool(result.Object, "status", "allowed")
+			if !allowed {
+				reason, _, _ := unstructured.NestedString(result.Object, "status", "reason")
+				if reason != "" {
+					verb = fmt.Sprintf("%s (%s)", verb, reason)
+				}
+				deniedVerbs = append(deniedVerbs, verb)
+			}
+		}
+
+		if len(deniedVerbs) == 0 {
+			fmt.Fprintf(out, "%s: allowed\n", desc)
+		} else {
+			denied++
+			fmt.Fprintf(out, "%s: denied %s\n", desc, strings.Join(deniedVerbs, ", "))
+		}
+	}
+
+	fmt.Fprintf(out, "%d objects allowed, %d denied\n", len(apiObjects)-denied, denied)
+	if denied > 0 {
+		return fmt.Errorf("Permission denied for %d objects", denied)
+	}
+	return nil
+}
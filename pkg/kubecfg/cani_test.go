@@ -0,0 +1,103 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestCanI(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				{Name: "namespaces", Kind: "Namespace"},
+			},
+		},
+	}
+
+	var attrs []map[string]interface{}
+	fake.AddReactor("create", "selfsubjectaccessreviews", func(action ktesting.Action) (bool, runtime.Object, error) {
+		review := action.(ktesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		a, _, _ := unstructured.NestedMap(review.Object, "spec", "resourceAttributes")
+		attrs = append(attrs, a)
+
+		// Deny patching configmaps only
+		allowed := !(a["resource"] == "configmaps" && a["verb"] == "patch")
+		review.Object["status"] = map[string]interface{}{
+			"allowed": allowed,
+			"reason":  "test policy",
+		}
+		return true, review, nil
+	})
+
+	c := CanICmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "defns",
+		Verbs:            []string{"create", "patch"},
+	}
+
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "myns"},
+		}},
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "mycm"},
+		}},
+	}
+
+	var out bytes.Buffer
+	if err := c.Run(objs, &out); err == nil {
+		t.Errorf("Run succeeded despite a denied verb")
+	}
+
+	expected := `namespaces myns: allowed
+configmaps mycm: denied patch (test policy)
+1 objects allowed, 1 denied
+`
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+
+	if len(attrs) != 4 {
+		t.Fatalf("Expected 4 access reviews, got %d", len(attrs))
+	}
+	if _, ok := attrs[0]["namespace"]; ok {
+		t.Errorf("Cluster-scoped review has a namespace: %v", attrs[0])
+	}
+	if _, ok := attrs[0]["name"]; ok {
+		t.Errorf("Create review has a name: %v", attrs[0])
+	}
+	if attrs[3]["namespace"] != "defns" || attrs[3]["name"] != "mycm" {
+		t.Errorf("Unexpected attributes for configmap patch review: %v", attrs[3])
+	}
+}
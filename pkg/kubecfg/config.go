@@ -0,0 +1,122 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// ConfigViewCmd represents the config view subcommand
+type ConfigViewCmd struct {
+	Context   string
+	Cluster   string
+	User      string
+	Namespace string
+
+	// Config is the resolved connection config.  Secrets in it
+	// are never printed.
+	Config *rest.Config
+}
+
+func (c ConfigViewCmd) Run(out io.Writer) error {
+	conf := c.Config
+	tls := conf.TLSClientConfig
+
+	fields := []struct{ name, value string }{
+		{"context", c.Context},
+		{"cluster", c.Cluster},
+		{"user", c.User},
+		{"namespace", c.Namespace},
+		{"server", conf.Host},
+		{"auth", describeAuth(conf)},
+		{"impersonate", describeImpersonation(conf.Impersonate)},
+		{"tls insecure", fmt.Sprintf("%v", tls.Insecure)},
+		{"tls server name", tls.ServerName},
+		{"certificate authority", describeTLSSource(tls.CAFile, tls.CAData, "system roots")},
+		{"client certificate", describeTLSSource(tls.CertFile, tls.CertData, "")},
+		{"client key", describeTLSSource(tls.KeyFile, tls.KeyData, "")},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			f.value = "(none)"
+		}
+		if _, err := fmt.Fprintf(out, "%s: %s\n", f.name, f.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeAuth(conf *rest.Config) string {
+	var methods []string
+	if conf.BearerToken != "" {
+		methods = append(methods, "bearer token (redacted)")
+	}
+	if conf.Username != "" {
+		methods = append(methods, fmt.Sprintf("basic auth as %s (password redacted)", conf.Username))
+	}
+	if conf.AuthProvider != nil {
+		methods = append(methods, fmt.Sprintf("auth provider %s", conf.AuthProvider.Name))
+	}
+	if conf.ExecProvider != nil {
+		methods = append(methods, fmt.Sprintf("exec plugin %s", conf.ExecProvider.Command))
+	}
+	if len(conf.TLSClientConfig.CertData) > 0 || conf.TLSClientConfig.CertFile != "" {
+		methods = append(methods, "client certificate")
+	}
+	return strings.Join(methods, ", ")
+}
+
+func describeImpersonation(imp rest.ImpersonationConfig) string {
+	if imp.UserName == "" {
+		return ""
+	}
+	var details []string
+	if len(imp.Groups) > 0 {
+		details = append(details, "groups "+strings.Join(imp.Groups, ", "))
+	}
+	if len(imp.Extra) > 0 {
+		// Keys only, since values may be sensitive
+		keys := make([]string, 0, len(imp.Extra))
+		for k := range imp.Extra {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		details = append(details, "extra "+strings.Join(keys, ", "))
+	}
+	if len(details) == 0 {
+		return imp.UserName
+	}
+	return fmt.Sprintf("%s (%s)", imp.UserName, strings.Join(details, "; "))
+}
+
+// describeTLSSource says where TLS material comes from, without
+// including the material itself.
+func describeTLSSource(file string, data []byte, fallback string) string {
+	switch {
+	case len(data) > 0:
+		return fmt.Sprintf("inline data (%d bytes, redacted)", len(data))
+	case file != "":
+		return file
+	default:
+		return fallback
+	}
+}
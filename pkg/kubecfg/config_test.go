@@ -0,0 +1,70 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigViewRedacts(t *testing.T) {
+	c := ConfigViewCmd{
+		Context:   "myctx",
+		Cluster:   "mycluster",
+		User:      "myuser",
+		Namespace: "myns",
+		Config: &rest.Config{
+			Host:        "https://example.com:6443",
+			BearerToken: "s3cr3t-token",
+			Username:    "admin",
+			Password:    "s3cr3t-password",
+			TLSClientConfig: rest.TLSClientConfig{
+				CAFile:   "/etc/ca.crt",
+				CertData: []byte("s3cr3t-cert"),
+				KeyData:  []byte("s3cr3t-key"),
+			},
+			Impersonate: rest.ImpersonationConfig{
+				UserName: "jane",
+				Groups:   []string{"devs"},
+				Extra:    map[string][]string{"reason": {"s3cr3t-reason"}},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := c.Run(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("Output contains a secret:\n%s", out.String())
+	}
+	for _, line := range []string{
+		"context: myctx\n",
+		"server: https://example.com:6443\n",
+		"auth: bearer token (redacted), basic auth as admin (password redacted), client certificate\n",
+		"certificate authority: /etc/ca.crt\n",
+		"client key: inline data (10 bytes, redacted)\n",
+		"impersonate: jane (groups devs; extra reason)\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Output lacks %q:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// isCustomResourceDefinition reports whether obj defines a new
+// kind, in any version of the apiextensions API.
+func isCustomResourceDefinition(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind().GroupKind() == gvkCustomResourceDefinition.GroupKind()
+}
+
+// isConversionWebhookError reports whether err came from a failure
+// to call a CRD's conversion webhook.  The server reports these as
+// internal errors, so they can only be recognised by message.
+func isConversionWebhookError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "conversion webhook for")
+}
+
+// describeConversionError names the CRD and webhook behind a
+// conversion webhook failure for resource in gvk's group.
+func describeConversionError(pool dynamic.ClientPool, resource string, gvk schema.GroupVersionKind, err error) error {
+	name := resource + "." + gvk.Group
+	webhook := "(unknown)"
+
+	client, cerr := pool.ClientForGroupVersionKind(gvkCustomResourceDefinition)
+	if cerr == nil {
+		var crd *unstructured.Unstructured
+		crd, cerr = client.Resource(&rsrcCustomResourceDefinition, metav1.NamespaceNone).Get(name, metav1.GetOptions{})
+		if cerr == nil {
+			webhook = conversionWebhookFor(crd)
+		}
+	}
+	if cerr != nil {
+		log.Debugf("Unable to fetch CustomResourceDefinition %s: %v", name, cerr)
+	}
+
+	return fmt.Errorf("conversion webhook %s for CustomResourceDefinition %s is unavailable: %v", webhook, name, err)
+}
+
+// conversionWebhookFor describes where crd's conversion webhook is
+// served.
+func conversionWebhookFor(crd *unstructured.Unstructured) string {
+	// apiextensions.k8s.io/v1beta1 and v1 respectively
+	config, found, _ := unstructured.NestedMap(crd.Object, "spec", "conversion", "webhookClientConfig")
+	if !found {
+		config, found, _ = unstructured.NestedMap(crd.Object, "spec", "conversion", "webhook", "clientConfig")
+	}
+	if !found {
+		return "(unknown)"
+	}
+
+	if url, ok := config["url"].(string); ok && url != "" {
+		return url
+	}
+	if svc, ok := config["service"].(map[string]interface{}); ok {
+		return fmt.Sprintf("service %v/%v", svc["namespace"], svc["name"])
+	}
+	return "(unknown)"
+}
@@ -17,12 +17,17 @@ package kubecfg
 
 import (
 	"fmt"
+	"io"
 	"sort"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 
@@ -36,9 +41,46 @@ type DeleteCmd struct {
 	DefaultNamespace string
 
 	GracePeriod int64
+	// PropagationPolicy says what happens to dependents (eg: the
+	// Pods of a Job).  It defaults to Foreground, which deletes
+	// dependents before the object itself.
+	PropagationPolicy metav1.DeletionPropagation
+	// DryRun lists the objects that would be deleted, including
+	// dependents that the server would garbage collect, without
+	// deleting anything.
+	DryRun bool
+	// ServerDryRun sends the deletes to the server as dry runs,
+	// so admission webhooks run without anything being deleted.
+	// ClientPool (and Impersonate) must already add dryRun to
+	// writes.
+	ServerDryRun bool
+
+	// Events, if set, receives a line of JSON as each object is
+	// deleted, and a summary at the end.
+	Events io.Writer
+
+	// Impersonate creates the client pools for objects with
+	// AnnotationImpersonate.  Other objects use ClientPool.
+	Impersonate ClientPoolFactory
+
+	// Wait, if set, waits for each dependency tier to be gone
+	// before deleting the next (eg: a Namespace, and so the
+	// custom resources in it, before their CRD).  WaitTimeout
+	// bounds the whole delete (or not, if zero).
+	Wait        bool
+	WaitTimeout time.Duration
 }
 
-func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) error {
+func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) (err error) {
+	events := newEventWriter(c.Events, nil, c.DryRun || c.ServerDryRun)
+	defer func() { events.summary(err) }()
+
+	if c.ServerDryRun {
+		if err := utils.CheckServerDryRun(c.Discovery); err != nil {
+			return err
+		}
+	}
+
 	version, err := utils.FetchVersion(c.Discovery)
 	if err != nil {
 		version = utils.GetDefaultVersion()
@@ -50,38 +92,190 @@ func (c DeleteCmd) Run(apiObjects []*unstructured.Unstructured) error {
 	if err != nil {
 		return err
 	}
+	// Delete dependents before the objects they depend on
 	sort.Sort(sort.Reverse(depOrder))
+	tiers, err := utils.DependencyTiers(c.Discovery, apiObjects)
+	if err != nil {
+		return err
+	}
 
-	deleteOpts := metav1.DeleteOptions{}
-	if version.Compare(1, 6) < 0 {
-		// 1.5.x option
-		boolFalse := false
-		deleteOpts.OrphanDependents = &boolFalse
-	} else {
-		// 1.6.x option (NB: Background is broken)
-		fg := metav1.DeletePropagationForeground
-		deleteOpts.PropagationPolicy = &fg
+	deleteOpts, err := deleteOptions(version, c.PropagationPolicy)
+	if err != nil {
+		return err
 	}
 	if c.GracePeriod >= 0 {
 		deleteOpts.GracePeriodSeconds = &c.GracePeriod
 	}
 
-	for _, obj := range apiObjects {
-		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
-		log.Info("Deleting ", desc)
+	dryRunText := ""
+	if c.DryRun {
+		dryRunText = " (dry-run)"
+	} else if c.ServerDryRun {
+		dryRunText = " (server dry-run)"
+	}
+	owners := sets.NewString()
+	pools := newClientPools(c.ClientPool, c.Impersonate, c.Discovery, c.DefaultNamespace)
+
+	deadline := waitDeadline(c.WaitTimeout)
+	for _, tier := range tiers {
+		var waitItems []waitItem
+		for _, obj := range tier {
+			desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+			start := time.Now()
+
+			pool, user, err := pools.forObject(obj)
+			if err != nil {
+				err = fmt.Errorf("Error deleting %s: %v", desc, err)
+				events.object(obj, Failed, time.Since(start), err)
+				return err
+			}
+			if user != "" {
+				desc = fmt.Sprintf("%s (as %s)", desc, user)
+			}
+			log.Info("Deleting ", desc, dryRunText)
+
+			client, err := utils.ClientForResource(pool, c.Discovery, obj, c.DefaultNamespace)
+			if err != nil {
+				err = fmt.Errorf("Error deleting %s: %v", desc, err)
+				events.object(obj, Failed, time.Since(start), err)
+				return err
+			}
+
+			if c.DryRun {
+				live, err := client.Get(obj.GetName(), metav1.GetOptions{})
+				if err != nil && !errors.IsNotFound(err) {
+					err = fmt.Errorf("Error fetching %s: %s", desc, err)
+					events.object(obj, Failed, time.Since(start), err)
+					return err
+				} else if err == nil {
+					owners.Insert(string(live.GetUID()))
+					events.object(live, Deleted, time.Since(start), nil)
+				} else {
+					events.object(obj, NotFound, time.Since(start), nil)
+				}
+				continue
+			}
+
+			err = client.Delete(obj.GetName(), &deleteOpts)
+			if errors.IsNotFound(err) {
+				events.object(obj, NotFound, time.Since(start), nil)
+			} else if err != nil {
+				err = fmt.Errorf("Error deleting %s: %s", desc, err)
+				events.object(obj, Failed, time.Since(start), err)
+				return err
+			} else {
+				events.object(obj, Deleted, time.Since(start), nil)
+				if c.Wait && !c.ServerDryRun {
+					waitItems = append(waitItems, waitItem{desc: desc, name: obj.GetName(), rc: client})
+				}
+			}
+
+			log.Debug("Deleted object: ", obj)
+		}
+
+		if err := waitForDeletion(waitItems, deadline); err != nil {
+			return err
+		}
+	}
 
-		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.DefaultNamespace)
+	if c.DryRun && owners.Len() > 0 && c.PropagationPolicy != metav1.DeletePropagationOrphan {
+		dependents, err := c.dependents(owners)
 		if err != nil {
 			return err
 		}
+		for _, d := range dependents {
+			log.Info(" Cascade-deleting ", d.desc, dryRunText)
+			events.object(d.obj, CascadeDeleted, 0, nil)
+		}
+	}
+
+	return nil
+}
+
+// deleteOptions returns the options for deleting with policy (by
+// default, Foreground) on a server of the given version.
+func deleteOptions(version utils.ServerVersion, policy metav1.DeletionPropagation) (metav1.DeleteOptions, error) {
+	opts := metav1.DeleteOptions{}
+	switch policy {
+	case "":
+		policy = metav1.DeletePropagationForeground
+	case metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+	default:
+		return opts, fmt.Errorf("Unknown propagation policy %q, expected one of %s, %s or %s", policy,
+			metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan)
+	}
+
+	if version.Compare(1, 6) < 0 {
+		// 1.5.x option, which can only orphan or not
+		orphan := policy == metav1.DeletePropagationOrphan
+		opts.OrphanDependents = &orphan
+	} else {
+		// 1.6.x option (NB: Background is broken in 1.6)
+		opts.PropagationPolicy = &policy
+	}
+	return opts, nil
+}
 
-		err = client.Delete(obj.GetName(), &deleteOpts)
-		if err != nil && !errors.IsNotFound(err) {
-			return fmt.Errorf("Error deleting %s: %s", desc, err)
+// dependent is an object that would be garbage collected
+type dependent struct {
+	desc string
+	obj  runtime.Object
+}
+
+// dependents finds the objects that the server would garbage
+// collect after owners are deleted, by scanning the ownerReferences
+// of every object.
+func (c DeleteCmd) dependents(owners sets.String) ([]dependent, error) {
+	objs := map[string]dependent{}
+	ownersOf := map[string][]string{}
+	err := walkObjects(c.ClientPool, c.Discovery, metav1.ListOptions{}, false, func(o runtime.Object) error {
+		m, err := meta.Accessor(o)
+		if err != nil {
+			return err
+		}
+		uid := string(m.GetUID())
+		if _, seen := objs[uid]; seen {
+			// Same object, listed under another GroupVersion
+			return nil
+		}
+		objs[uid] = dependent{
+			desc: fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, o), utils.FqName(m)),
+			obj:  o,
+		}
+		for _, ref := range m.GetOwnerReferences() {
+			ownersOf[uid] = append(ownersOf[uid], string(ref.UID))
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		log.Debug("Deleted object: ", obj)
+	deleted := cascadeDeleted(owners, ownersOf)
+	ret := make([]dependent, 0, deleted.Len())
+	for _, uid := range deleted.List() {
+		ret = append(ret, objs[uid])
 	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].desc < ret[j].desc })
+	return ret, nil
+}
 
-	return nil
+// cascadeDeleted returns the UIDs of objects (other than owners)
+// that are deleted along with owners.  An object is only deleted
+// once all of its owners are gone.
+func cascadeDeleted(owners sets.String, ownersOf map[string][]string) sets.String {
+	gone := sets.NewString(owners.List()...)
+	ret := sets.NewString()
+	for changed := true; changed; {
+		changed = false
+		for uid, refs := range ownersOf {
+			if gone.Has(uid) || !gone.HasAll(refs...) {
+				continue
+			}
+			gone.Insert(uid)
+			ret.Insert(uid)
+			changed = true
+		}
+	}
+	return ret
 }
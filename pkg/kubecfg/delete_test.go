@@ -0,0 +1,262 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+func TestCascadeDeleted(t *testing.T) {
+	ownersOf := map[string][]string{
+		// deployment -> replicaset -> pods
+		"rs":    {"deploy"},
+		"pod1":  {"rs"},
+		"pod2":  {"rs"},
+		"other": {"unrelated"},
+		// Still owned by something that isn't being deleted
+		"shared": {"deploy", "unrelated"},
+	}
+
+	deleted := cascadeDeleted(sets.NewString("deploy"), ownersOf)
+	expected := []string{"pod1", "pod2", "rs"}
+	if !reflect.DeepEqual(deleted.List(), expected) {
+		t.Errorf("Expected %v, got %v", expected, deleted.List())
+	}
+
+	deleted = cascadeDeleted(sets.NewString("deploy", "unrelated"), ownersOf)
+	expected = []string{"other", "pod1", "pod2", "rs", "shared"}
+	if !reflect.DeepEqual(deleted.List(), expected) {
+		t.Errorf("Expected %v, got %v", expected, deleted.List())
+	}
+}
+
+func TestDeleteWait(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Verbs: []string{"get", "delete"}},
+			},
+		},
+		{
+			GroupVersion: "apiextensions.k8s.io/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition", Verbs: []string{"get", "delete"}},
+			},
+		},
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "widgets", Kind: "Widget", Namespaced: true, Verbs: []string{"get", "delete"}},
+			},
+		},
+	}
+	var actions []string
+	terminating := 0
+	fake.AddReactor("*", "*", func(action ktesting.Action) (bool, runtime.Object, error) {
+		resource := action.GetResource().Resource
+		if !strings.HasSuffix(resource, "s") {
+			// Discovery
+			return false, nil, nil
+		}
+		actions = append(actions, action.GetVerb()+" "+resource)
+		if action.GetVerb() != "get" {
+			return true, nil, nil
+		}
+		name := action.(ktesting.GetAction).GetName()
+		if resource == "namespaces" && terminating > 0 {
+			terminating--
+			obj := &unstructured.Unstructured{}
+			obj.SetName(name)
+			now := metav1.Now()
+			obj.SetDeletionTimestamp(&now)
+			obj.SetFinalizers([]string{"kubernetes"})
+			return true, obj, nil
+		}
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: resource}, name)
+	})
+
+	objs := func() []*unstructured.Unstructured {
+		var ret []*unstructured.Unstructured
+		for _, o := range []struct{ apiVersion, kind, namespace, name string }{
+			{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "widgets.example.com"},
+			{"v1", "Namespace", "", "myns"},
+			{"example.com/v1", "Widget", "myns", "mywidget"},
+		} {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(o.apiVersion)
+			obj.SetKind(o.kind)
+			obj.SetNamespace(o.namespace)
+			obj.SetName(o.name)
+			ret = append(ret, obj)
+		}
+		return ret
+	}
+
+	c := DeleteCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+		GracePeriod:      -1,
+		Wait:             true,
+	}
+
+	terminating = 2
+	if err := c.Run(objs()); err != nil {
+		t.Fatal(err)
+	}
+	// Each tier is gone before the next is deleted
+	expected := []string{
+		"delete widgets", "get widgets",
+		"delete namespaces", "get namespaces", "get namespaces", "get namespaces",
+		"delete customresourcedefinitions", "get customresourcedefinitions",
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected %v, got %v", expected, actions)
+	}
+
+	c.WaitTimeout = 10 * time.Millisecond
+	terminating = 1000
+	err := c.Run(objs())
+	if err == nil || !strings.Contains(err.Error(), "namespaces myns (waiting for finalizers kubernetes)") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestDeleteOptions(t *testing.T) {
+	v16 := utils.ServerVersion{Major: 1, Minor: 6}
+	v15 := utils.ServerVersion{Major: 1, Minor: 5}
+
+	opts, err := deleteOptions(v16, "")
+	if err != nil || opts.PropagationPolicy == nil || *opts.PropagationPolicy != metav1.DeletePropagationForeground {
+		t.Errorf("Expected Foreground by default, got %v, %v", opts, err)
+	}
+	opts, err = deleteOptions(v16, metav1.DeletePropagationOrphan)
+	if err != nil || opts.PropagationPolicy == nil || *opts.PropagationPolicy != metav1.DeletePropagationOrphan {
+		t.Errorf("Expected Orphan, got %v, %v", opts, err)
+	}
+	opts, err = deleteOptions(v15, metav1.DeletePropagationOrphan)
+	if err != nil || opts.PropagationPolicy != nil || opts.OrphanDependents == nil || !*opts.OrphanDependents {
+		t.Errorf("Expected OrphanDependents for 1.5, got %v, %v", opts, err)
+	}
+	opts, err = deleteOptions(v15, metav1.DeletePropagationBackground)
+	if err != nil || opts.OrphanDependents == nil || *opts.OrphanDependents {
+		t.Errorf("Expected no orphans for 1.5, got %v, %v", opts, err)
+	}
+	if _, err := deleteOptions(v16, "Sideways"); err == nil {
+		t.Error("Unknown propagation policy was accepted")
+	}
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "delete"}},
+			},
+		},
+	}
+	deletes := 0
+	fake.AddReactor("delete", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		deletes++
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "cm")
+	})
+
+	var events bytes.Buffer
+	c := DeleteCmd{
+		ClientPool:        pool,
+		Discovery:         &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace:  "default",
+		GracePeriod:       -1,
+		PropagationPolicy: metav1.DeletePropagationBackground,
+		Events:            &events,
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName("cm")
+
+	// Deleting again is not an error
+	if err := c.Run([]*unstructured.Unstructured{obj}); err != nil {
+		t.Errorf("Deleting a missing object failed: %v", err)
+	}
+	if deletes != 1 {
+		t.Errorf("Expected 1 delete, got %d", deletes)
+	}
+	if !strings.Contains(events.String(), `"action":"not-found"`) {
+		t.Errorf("Expected a not-found event, got %s", events.String())
+	}
+}
+
+func TestDeleteReportsEarlyFailures(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Verbs: []string{"get", "delete"}},
+			},
+		},
+	}
+
+	var events bytes.Buffer
+	c := DeleteCmd{
+		ClientPool:        pool,
+		Discovery:         &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace:  "default",
+		GracePeriod:       -1,
+		PropagationPolicy: metav1.DeletePropagationBackground,
+		Events:            &events,
+	}
+	// Rejected before any request is made
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName("team")
+	obj.SetNamespace("other")
+
+	if err := c.Run([]*unstructured.Unstructured{obj}); err == nil {
+		t.Fatal("Cluster-scoped object with a namespace was deleted")
+	}
+	if !strings.Contains(events.String(), `"action":"failed"`) || !strings.Contains(events.String(), "cluster-scoped") {
+		t.Errorf("Expected a failed event, got %s", events.String())
+	}
+}
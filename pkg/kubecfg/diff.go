@@ -17,19 +17,22 @@ package kubecfg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"sort"
 	"regexp"
+	"sort"
+	"strings"
 
 	isatty "github.com/mattn/go-isatty"
-	log "github.com/sirupsen/logrus"
 	"github.com/sergi/go-diff/diffmatchpatch"
+	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 
@@ -38,6 +41,11 @@ import (
 
 var ErrDiffFound = fmt.Errorf("Differences found.")
 
+var (
+	gvkCustomResourceDefinition  = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1beta1", Kind: "CustomResourceDefinition"}
+	rsrcCustomResourceDefinition = metav1.APIResource{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition"}
+)
+
 // Matches all the line starts on a diff text, which is where we put diff markers and indent
 var DiffLineStart = regexp.MustCompile("(^|\n)(.)")
 
@@ -48,20 +56,109 @@ type DiffCmd struct {
 	DefaultNamespace string
 
 	DiffStrategy string
+	// MergeKeys identify the elements of custom resource lists
+	// when comparing the "subset" of live fields that are in
+	// config.  Keys declared in a CRD's schema take precedence.
+	MergeKeys map[schema.GroupKind]utils.MergeKeys
+	// Fields limits which fields of each kind are compared
+	Fields utils.CompareConfig
+	// OutputFormat is one of "text" (the default), "markdown",
+	// "unified" or "json"
+	OutputFormat string
+}
+
+// diffResult is the outcome of comparing one object with the server
+type diffResult struct {
+	desc string
+	obj  *unstructured.Unstructured
+	// namespace is where obj is (or would be) on the server
+	namespace string
+	// live is nil if the object doesn't exist on the server
+	live *unstructured.Unstructured
+	diff []diffmatchpatch.Diff
+}
+
+func (r diffResult) changed() bool {
+	return r.live == nil ||
+		len(r.diff) != 1 || r.diff[0].Type != diffmatchpatch.DiffEqual
+}
+
+// action is what update would do to the object
+func (r diffResult) action() string {
+	switch {
+	case r.live == nil:
+		return "created"
+	case r.changed():
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+// entry returns r as a DiffEntry
+func (r diffResult) entry() DiffEntry {
+	e := DiffEntry{
+		APIVersion: r.obj.GetAPIVersion(),
+		Kind:       r.obj.GetKind(),
+		Namespace:  r.namespace,
+		Name:       r.obj.GetName(),
+		Action:     r.action(),
+	}
+	if r.changed() {
+		e.Diff = unifiedHunks(r.diff, unifiedContext)
+	}
+	return e
 }
 
 func (c DiffCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
+	results, err := c.compare(context.Background(), apiObjects)
+	if err != nil {
+		return err
+	}
+
+	switch c.OutputFormat {
+	case "", "text":
+		err = c.writeText(results, out)
+	case "markdown":
+		err = c.writeMarkdown(results, out)
+	case "unified":
+		err = c.writeUnified(results, out)
+	case "json":
+		err = c.writeJSON(results, out)
+	default:
+		return fmt.Errorf("Unknown --output: %s", c.OutputFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.changed() {
+			return ErrDiffFound
+		}
+	}
+	return nil
+}
+
+// compare fetches each of apiObjects from the server, and compares
+// it with config, in alphabetical order.
+func (c DiffCmd) compare(ctx context.Context, apiObjects []*unstructured.Unstructured) ([]diffResult, error) {
 	sort.Sort(utils.AlphabeticalOrder(apiObjects))
 
 	dmp := diffmatchpatch.New()
-	diffFound := false
+	results := make([]diffResult, 0, len(apiObjects))
+	crdKeys := map[schema.GroupVersionKind]utils.MergeKeys{}
 	for _, obj := range apiObjects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
 		log.Debug("Fetching ", desc)
 
 		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.DefaultNamespace)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		liveObj, err := client.Get(obj.GetName(), metav1.GetOptions{})
@@ -69,24 +166,30 @@ func (c DiffCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) err
 			log.Debugf("%s doesn't exist on the server", desc)
 			liveObj = nil
 		} else if err != nil {
-			return fmt.Errorf("Error fetching %s: %v", desc, err)
+			return nil, fmt.Errorf("Error fetching %s: %v", desc, err)
 		}
 
-		fmt.Fprintln(out, "---")
-		fmt.Fprintf(out, "- live %s\n+ config %s\n", desc, desc)
-		if liveObj == nil {
-			fmt.Fprintf(out, "%s doesn't exist on server\n", desc)
-			diffFound = true
-			continue
+		result := diffResult{desc: desc, obj: obj, live: liveObj, namespace: obj.GetNamespace()}
+		if liveObj != nil {
+			result.namespace = liveObj.GetNamespace()
+		} else if result.namespace == "" {
+			if rsrc, err := utils.ResourceFor(c.Discovery, obj); err == nil && rsrc.Namespaced {
+				result.namespace = c.DefaultNamespace
+			}
 		}
 
-		liveObjObject := liveObj.Object
-		if c.DiffStrategy == "subset" {
-			liveObjObject = removeMapFields(obj.Object, liveObjObject)
-		}
+		fields := c.Fields.For(obj.GroupVersionKind().GroupKind())
 
-		liveObjText, _ := json.MarshalIndent(liveObjObject, "", "  ")
-		objText, _ := json.MarshalIndent(obj.Object, "", "  ")
+		var liveObjText []byte
+		if liveObj != nil {
+			liveObjObject := liveObj.Object
+			if c.DiffStrategy == "subset" {
+				keys := c.mergeKeysFor(obj, crdKeys)
+				liveObjObject = removeMapFields(obj.Object, liveObjObject, "", keys)
+			}
+			liveObjText, _ = json.MarshalIndent(filterFields(liveObjObject, "", fields), "", "  ")
+		}
+		objText, _ := json.MarshalIndent(filterFields(obj.Object, "", fields), "", "  ")
 
 		liveObjTextLines, objTextLines, lines := dmp.DiffLinesToChars(string(liveObjText), string(objText))
 
@@ -95,22 +198,230 @@ func (c DiffCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) err
 			string(objTextLines),
 			false)
 
-		diff = dmp.DiffCharsToLines(diff, lines)
-		if (len(diff) == 1) && (diff[0].Type == diffmatchpatch.DiffEqual) {
-			fmt.Fprintf(out, "%s unchanged\n", desc)
+		result.diff = dmp.DiffCharsToLines(diff, lines)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// mergeKeysFor returns the list merge keys for obj, caching those
+// declared by CRDs in crdKeys.
+func (c DiffCmd) mergeKeysFor(obj *unstructured.Unstructured, crdKeys map[schema.GroupVersionKind]utils.MergeKeys) utils.MergeKeys {
+	gvk := obj.GroupVersionKind()
+	fromCRD, ok := crdKeys[gvk]
+	if !ok {
+		fromCRD = c.fetchCRDMergeKeys(obj)
+		crdKeys[gvk] = fromCRD
+	}
+
+	keys := utils.MergeKeys{}
+	for path, k := range c.MergeKeys[gvk.GroupKind()] {
+		keys[path] = k
+	}
+	for path, k := range fromCRD {
+		keys[path] = k
+	}
+	return keys
+}
+
+func (c DiffCmd) fetchCRDMergeKeys(obj *unstructured.Unstructured) utils.MergeKeys {
+	gvk := obj.GroupVersionKind()
+	// CRDs must be in a group with a dot, which rules out
+	// the core and most built-in groups without a lookup.
+	if !strings.Contains(gvk.Group, ".") {
+		return nil
+	}
+
+	rsrc, err := utils.ResourceFor(c.Discovery, obj)
+	if err != nil {
+		log.Debugf("Unable to find resource for %s: %v", gvk, err)
+		return nil
+	}
+
+	client, err := c.ClientPool.ClientForGroupVersionKind(gvkCustomResourceDefinition)
+	if err != nil {
+		log.Debugf("Unable to fetch CustomResourceDefinitions: %v", err)
+		return nil
+	}
+	name := rsrc.Name + "." + gvk.Group
+	crd, err := client.Resource(&rsrcCustomResourceDefinition, metav1.NamespaceNone).Get(name, metav1.GetOptions{})
+	if err != nil {
+		// Most likely a built-in type
+		log.Debugf("Unable to fetch CustomResourceDefinition %s: %v", name, err)
+		return nil
+	}
+
+	return utils.CRDMergeKeys(crd, gvk.Version)
+}
+
+func (c DiffCmd) writeText(results []diffResult, out io.Writer) error {
+	for _, r := range results {
+		fmt.Fprintln(out, "---")
+		fmt.Fprintf(out, "- live %s\n+ config %s\n", r.desc, r.desc)
+		if r.live == nil {
+			fmt.Fprintf(out, "%s doesn't exist on server\n", r.desc)
+		} else if !r.changed() {
+			fmt.Fprintf(out, "%s unchanged\n", r.desc)
 		} else {
-			diffFound = true
-			text := c.formatDiff(diff, isatty.IsTerminal(os.Stdout.Fd()))
+			text := c.formatDiff(r.diff, istty(out))
 			fmt.Fprintf(out, "%s\n", text)
 		}
 	}
+	return nil
+}
+
+// writeMarkdown formats results for posting as a code review
+// comment: a summary line, then one collapsible section per changed
+// object.
+func (c DiffCmd) writeMarkdown(results []diffResult, out io.Writer) error {
+	count := map[string]int{}
+	for _, r := range results {
+		count[r.action()]++
+	}
+	fmt.Fprintf(out, "**%d to create, %d to update, %d unchanged**\n", count["created"], count["updated"], count["unchanged"])
+
+	for _, r := range results {
+		if !r.changed() {
+			continue
+		}
+		action := "update"
+		if r.live == nil {
+			action = "create"
+		}
+		fmt.Fprintf(out, "\n<details>\n<summary>%s: %s</summary>\n\n", action, r.desc)
+		text := strings.TrimSuffix(c.formatDiff(r.diff, false), "\n")
+		fmt.Fprintf(out, "```diff\n%s\n```\n\n</details>\n", text)
+	}
+	return nil
+}
 
-	if diffFound {
-		return ErrDiffFound
+// writeUnified writes a standard unified diff (as from `diff -u`)
+// of each changed object, for patch tools and diff viewers.
+func (c DiffCmd) writeUnified(results []diffResult, out io.Writer) error {
+	for _, r := range results {
+		if !r.changed() {
+			continue
+		}
+		path := strings.Replace(r.desc, " ", "/", 1)
+		if r.live == nil {
+			fmt.Fprintln(out, "--- /dev/null")
+		} else {
+			fmt.Fprintf(out, "--- live/%s\n", path)
+		}
+		fmt.Fprintf(out, "+++ config/%s\n", path)
+		fmt.Fprint(out, unifiedHunks(r.diff, unifiedContext))
 	}
 	return nil
 }
 
+// DiffEntry is an object in `diff --output json`
+type DiffEntry struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Action is one of "created", "updated" or "unchanged"
+	Action string `json:"action"`
+	// Diff is the unified diff hunks, if changed
+	Diff string `json:"diff,omitempty"`
+}
+
+// writeJSON writes a DiffEntry per object, as a JSON array.
+func (c DiffCmd) writeJSON(results []diffResult, out io.Writer) error {
+	entries := make([]DiffEntry, len(results))
+	for i, r := range results {
+		entries[i] = r.entry()
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", b)
+	return err
+}
+
+// unifiedContext is the number of unchanged lines around each hunk
+const unifiedContext = 3
+
+// unifiedHunks formats line diffs as unified diff hunks, with
+// context unchanged lines around each change.
+func unifiedHunks(diffs []diffmatchpatch.Diff, context int) string {
+	type line struct {
+		op   diffmatchpatch.Operation
+		text string
+	}
+	var lines []line
+	for _, d := range diffs {
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, line{d.Type, strings.TrimSuffix(text, "\n")})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	// Lines of each side before lines[i]
+	oldLine, newLine := 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffmatchpatch.DiffEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// A hunk runs from context lines before this change to
+		// context lines after the last change that is no more
+		// than 2*context unchanged lines from the previous one
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j-end-1 <= 2*context; j++ {
+			if lines[j].op != diffmatchpatch.DiffEqual {
+				end = j
+			}
+		}
+		end += context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		var hunk bytes.Buffer
+		for _, l := range lines[start:end] {
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				oldCount++
+				newCount++
+				fmt.Fprintf(&hunk, " %s\n", l.text)
+			case diffmatchpatch.DiffDelete:
+				oldCount++
+				fmt.Fprintf(&hunk, "-%s\n", l.text)
+			case diffmatchpatch.DiffInsert:
+				newCount++
+				fmt.Fprintf(&hunk, "+%s\n", l.text)
+			}
+		}
+		// Empty ranges start at the line before
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		buf.Write(hunk.Bytes())
+
+		oldLine += oldCount - (i - start)
+		newLine += newCount - (i - start)
+		i = end
+	}
+	return buf.String()
+}
+
 // Formats the supplied Diff as a unified-diff-like text with infinite context and optionally colorizes it.
 func (c DiffCmd) formatDiff(diffs []diffmatchpatch.Diff, color bool) string {
 	var buff bytes.Buffer
@@ -120,13 +431,21 @@ func (c DiffCmd) formatDiff(diffs []diffmatchpatch.Diff, color bool) string {
 
 		switch diff.Type {
 		case diffmatchpatch.DiffInsert:
-			if color { _, _ = buff.WriteString("\x1b[32m") }
+			if color {
+				_, _ = buff.WriteString("\x1b[32m")
+			}
 			_, _ = buff.WriteString(DiffLineStart.ReplaceAllString(text, "$1+ $2"))
-			if color { _, _ = buff.WriteString("\x1b[0m") }
+			if color {
+				_, _ = buff.WriteString("\x1b[0m")
+			}
 		case diffmatchpatch.DiffDelete:
-			if color { _, _ = buff.WriteString("\x1b[31m") }
+			if color {
+				_, _ = buff.WriteString("\x1b[31m")
+			}
 			_, _ = buff.WriteString(DiffLineStart.ReplaceAllString(text, "$1- $2"))
-			if color { _, _ = buff.WriteString("\x1b[0m") }
+			if color {
+				_, _ = buff.WriteString("\x1b[0m")
+			}
 		case diffmatchpatch.DiffEqual:
 			_, _ = buff.WriteString(DiffLineStart.ReplaceAllString(text, "$1  $2"))
 		}
@@ -159,18 +478,18 @@ func isEmptyValue(i interface{}) bool {
 	}
 }
 
-func removeFields(config, live interface{}) interface{} {
+func removeFields(config, live interface{}, path string, keys utils.MergeKeys) interface{} {
 	switch c := config.(type) {
 	case map[string]interface{}:
-		return removeMapFields(c, live.(map[string]interface{}))
+		return removeMapFields(c, live.(map[string]interface{}), path, keys)
 	case []interface{}:
-		return removeListFields(c, live.([]interface{}))
+		return removeListFields(c, live.([]interface{}), path, keys)
 	default:
 		return live
 	}
 }
 
-func removeMapFields(config, live map[string]interface{}) map[string]interface{} {
+func removeMapFields(config, live map[string]interface{}, path string, keys utils.MergeKeys) map[string]interface{} {
 	result := map[string]interface{}{}
 	for k, v1 := range config {
 		v2, ok := live[k]
@@ -182,18 +501,47 @@ func removeMapFields(config, live map[string]interface{}) map[string]interface{}
 			}
 			continue
 		}
-		result[k] = removeFields(v1, v2)
+		result[k] = removeFields(v1, v2, utils.FieldPath(path, k), keys)
 	}
 	return result
 }
 
-func removeListFields(config, live []interface{}) []interface{} {
+// filterFields returns a copy of v without the fields that fields
+// excludes from comparison.
+func filterFields(v interface{}, path string, fields utils.CompareFields) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, v2 := range v {
+			p := utils.FieldPath(path, k)
+			if fields.Excludes(p) {
+				continue
+			}
+			result[k] = filterFields(v2, p, fields)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, v2 := range v {
+			result[i] = filterFields(v2, path, fields)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func removeListFields(config, live []interface{}, path string, keys utils.MergeKeys) []interface{} {
+	if mergeKey, ok := keys[path]; ok {
+		return removeKeyedListFields(config, live, mergeKey, path, keys)
+	}
+
 	// If live is longer than config, then the extra elements at the end of the
 	// list will be returned as is so they appear in the diff.
 	result := make([]interface{}, 0, len(live))
 	for i, v2 := range live {
 		if len(config) > i {
-			result = append(result, removeFields(config[i], v2))
+			result = append(result, removeFields(config[i], v2, path, keys))
 		} else {
 			result = append(result, v2)
 		}
@@ -201,6 +549,45 @@ func removeListFields(config, live []interface{}) []interface{} {
 	return result
 }
 
+// removeKeyedListFields matches live elements to config elements by
+// mergeKey rather than by position, and orders them as in config.
+func removeKeyedListFields(config, live []interface{}, mergeKey []string, path string, keys utils.MergeKeys) []interface{} {
+	result := make([]interface{}, 0, len(live))
+	matched := make([]bool, len(live))
+	for _, v1 := range config {
+		k1, ok := listElementKey(v1, mergeKey)
+		if !ok {
+			continue
+		}
+		for i, v2 := range live {
+			if k2, ok := listElementKey(v2, mergeKey); ok && !matched[i] && k1 == k2 {
+				matched[i] = true
+				result = append(result, removeFields(v1, v2, path, keys))
+				break
+			}
+		}
+	}
+	// Unmatched live elements are returned as is so they appear in the diff.
+	for i, v2 := range live {
+		if !matched[i] {
+			result = append(result, v2)
+		}
+	}
+	return result
+}
+
+func listElementKey(v interface{}, mergeKey []string) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	parts := make([]string, len(mergeKey))
+	for i, k := range mergeKey {
+		parts[i] = fmt.Sprintf("%v", m[k])
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
 func istty(w io.Writer) bool {
 	if f, ok := w.(*os.File); ok {
 		return isatty.IsTerminal(f.Fd())
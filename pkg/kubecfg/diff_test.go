@@ -16,9 +16,16 @@
 package kubecfg
 
 import (
+	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/sergi/go-diff/diffmatchpatch"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/kubecfg/utils"
 )
 
 func TestRemoveListFields(t *testing.T) {
@@ -45,7 +52,7 @@ func TestRemoveListFields(t *testing.T) {
 			expected: []interface{}{"a", "b"},
 		},
 	} {
-		require.EqualValues(t, tc.expected, removeListFields(tc.config, tc.live))
+		require.EqualValues(t, tc.expected, removeListFields(tc.config, tc.live, "", nil))
 	}
 }
 
@@ -71,7 +78,7 @@ func TestRemoveMapFields(t *testing.T) {
 			expected: map[string]interface{}{"foo": "bar"},
 		},
 	} {
-		require.Equal(t, tc.expected, removeMapFields(tc.config, tc.live))
+		require.Equal(t, tc.expected, removeMapFields(tc.config, tc.live, "", nil))
 	}
 }
 
@@ -182,6 +189,223 @@ func TestRemoveFields(t *testing.T) {
 			},
 		},
 	} {
-		require.Equal(t, tc.expected, removeFields(tc.config, tc.live))
+		require.Equal(t, tc.expected, removeFields(tc.config, tc.live, "", nil))
+	}
+}
+
+func TestRemoveKeyedListFields(t *testing.T) {
+	port := func(name string, port int64, extra ...string) map[string]interface{} {
+		ret := map[string]interface{}{"name": name, "port": port}
+		for _, e := range extra {
+			ret[e] = "live"
+		}
+		return ret
+	}
+	config := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{port("a", 1), port("b", 2)},
+		},
+	}
+	// Reordered by the server, with defaulted fields and an extra element
+	live := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{port("c", 3), port("b", 2, "protocol"), port("a", 1, "protocol")},
+		},
 	}
+
+	expected := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{port("a", 1), port("b", 2), port("c", 3)},
+		},
+	}
+	keys := utils.MergeKeys{"spec.ports": {"name"}}
+	require.Equal(t, expected, removeMapFields(config, live, "", keys))
+
+	// Without merge keys, elements are matched by position
+	expected = map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ports": []interface{}{port("c", 3), port("b", 2), port("a", 1, "protocol")},
+		},
+	}
+	require.Equal(t, expected, removeMapFields(config, live, "", nil))
+}
+
+func lineDiff(a, b string) []diffmatchpatch.Diff {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(a, b)
+	return dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	results := []diffResult{
+		{
+			desc: "configmaps default.created",
+			diff: lineDiff("", "{}\n"),
+		},
+		{
+			desc: "configmaps default.updated",
+			live: &unstructured.Unstructured{},
+			diff: lineDiff("a\n", "b\n"),
+		},
+		{
+			desc: "configmaps default.unchanged",
+			live: &unstructured.Unstructured{},
+			diff: lineDiff("a\n", "a\n"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (DiffCmd{}).writeMarkdown(results, &buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	t.Log(text)
+
+	if !strings.HasPrefix(text, "**1 to create, 1 to update, 1 unchanged**\n") {
+		t.Errorf("Missing summary line")
+	}
+	if !strings.Contains(text, "<summary>create: configmaps default.created</summary>") {
+		t.Errorf("Missing created object")
+	}
+	if !strings.Contains(text, "<summary>update: configmaps default.updated</summary>\n\n```diff\n- a\n+ b\n```\n") {
+		t.Errorf("Missing updated object diff")
+	}
+	if strings.Contains(text, "default.unchanged") {
+		t.Errorf("Unchanged object should be omitted")
+	}
+	if strings.Contains(text, "\x1b[") {
+		t.Errorf("Markdown output contains terminal escapes")
+	}
+}
+
+func TestUnifiedHunks(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	new := "1\nTWO\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n"
+	expected := `@@ -1,5 +1,5 @@
+ 1
+-2
++TWO
+ 3
+ 4
+ 5
+@@ -14,3 +14,4 @@
+ 14
+ 15
+ 16
++17
+`
+	if got := unifiedHunks(lineDiff(old, new), 3); got != expected {
+		t.Errorf("Unexpected hunks:\n%s", got)
+	}
+
+	// Changes with no more than 2*context lines between them share
+	// a hunk
+	new = "1\n2\n3\n4\nFIVE\n6\n7\n8\n9\n10\n11\nTWELVE\n13\n14\n15\n16\n"
+	if got := unifiedHunks(lineDiff(old, new), 3); !strings.HasPrefix(got, "@@ -2,14 +2,14 @@\n") || strings.Count(got, "@@") != 2 {
+		t.Errorf("Unexpected hunks:\n%s", got)
+	}
+
+	if got := unifiedHunks(lineDiff("", "a\nb\n"), 3); got != "@@ -0,0 +1,2 @@\n+a\n+b\n" {
+		t.Errorf("Unexpected hunks for a new object:\n%s", got)
+	}
+}
+
+func TestWriteUnifiedAndJSON(t *testing.T) {
+	obj := func(name string) *unstructured.Unstructured {
+		o := &unstructured.Unstructured{}
+		o.SetAPIVersion("v1")
+		o.SetKind("ConfigMap")
+		o.SetName(name)
+		return o
+	}
+	results := []diffResult{
+		{
+			desc:      "configmaps default.created",
+			obj:       obj("created"),
+			namespace: "default",
+			diff:      lineDiff("", "{}\n"),
+		},
+		{
+			desc:      "configmaps default.updated",
+			obj:       obj("updated"),
+			namespace: "default",
+			live:      &unstructured.Unstructured{},
+			diff:      lineDiff("a\n", "b\n"),
+		},
+		{
+			desc:      "configmaps default.unchanged",
+			obj:       obj("unchanged"),
+			namespace: "default",
+			live:      &unstructured.Unstructured{},
+			diff:      lineDiff("a\n", "a\n"),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := (DiffCmd{}).writeUnified(results, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- /dev/null
++++ config/configmaps/default.created
+@@ -0,0 +1,1 @@
++{}
+--- live/configmaps/default.updated
++++ config/configmaps/default.updated
+@@ -1,1 +1,1 @@
+-a
++b
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected unified diff:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := (DiffCmd{}).writeJSON(results, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var entries []DiffEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, []DiffEntry{
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "created", Action: "created", Diff: "@@ -0,0 +1,1 @@\n+{}\n"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "updated", Action: "updated", Diff: "@@ -1,1 +1,1 @@\n-a\n+b\n"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "unchanged", Action: "unchanged"},
+	}, entries)
+}
+
+func TestFilterFields(t *testing.T) {
+	obj := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": 3,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "c", "image": "foo:1"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{"replicas": 3},
+	}
+
+	fields := utils.CompareFields{
+		Include: []string{"spec"},
+		Exclude: []string{"spec.replicas", "spec.template.spec.containers.image"},
+	}
+	expected := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "c"},
+					},
+				},
+			},
+		},
+	}
+	require.Equal(t, expected, filterFields(obj, "", fields))
+
+	// Without a config, everything is compared
+	require.Equal(t, obj, filterFields(obj, "", utils.CompareFields{}))
 }
@@ -0,0 +1,187 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Action is what update or delete did with an object
+type Action string
+
+// The outcomes of update
+const (
+	Created   Action = "created"
+	Updated   Action = "updated"
+	Unchanged Action = "unchanged"
+	Failed    Action = "failed"
+	// Skipped objects weren't updated, eg: because their kind's
+	// conversion webhook was unavailable
+	Skipped          Action = "skipped"
+	Recreated        Action = "recreated"
+	GarbageCollected Action = "garbage-collected"
+)
+
+// The outcomes of delete, as well as Failed
+const (
+	Deleted        Action = "deleted"
+	NotFound       Action = "not-found"
+	CascadeDeleted Action = "cascade-deleted"
+)
+
+// Observer is told as update finishes with each object, eg: to show
+// progress.  Calls are never concurrent.  err is set for Failed and
+// Skipped objects.
+type Observer interface {
+	OnObject(gvk schema.GroupVersionKind, namespace, name string, action Action, err error)
+}
+
+// ObjectEvent is written (as one line of JSON) when update or delete
+// finishes with an object.
+type ObjectEvent struct {
+	APIVersion      string  `json:"apiVersion"`
+	Kind            string  `json:"kind"`
+	Namespace       string  `json:"namespace,omitempty"`
+	Name            string  `json:"name"`
+	Action          Action  `json:"action"`
+	DryRun          bool    `json:"dryRun,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// RunSummary is written as the last line of events, counting the
+// objects by action.  For update, Latency describes the time taken
+// to update each object.
+type RunSummary struct {
+	Summary         map[string]int  `json:"summary"`
+	DryRun          bool            `json:"dryRun,omitempty"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	Latency         *LatencySeconds `json:"latency,omitempty"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// eventWriter streams ObjectEvents as newline-delimited JSON, and
+// passes them to an Observer.  A nil eventWriter ignores events.
+type eventWriter struct {
+	// Guards everything below, since objects may be updated
+	// concurrently
+	lock     sync.Mutex
+	enc      *json.Encoder
+	observer Observer
+	dryRun   bool
+	start    time.Time
+	counts   map[string]int
+	stats    *latencyStats
+}
+
+// newEventWriter returns an eventWriter writing to out and/or
+// telling observer, or nil if both are nil.
+func newEventWriter(out io.Writer, observer Observer, dryRun bool) *eventWriter {
+	if out == nil && observer == nil {
+		return nil
+	}
+	w := &eventWriter{
+		observer: observer,
+		dryRun:   dryRun,
+		start:    time.Now(),
+		counts:   map[string]int{},
+	}
+	if out != nil {
+		w.enc = json.NewEncoder(out)
+	}
+	return w
+}
+
+func (w *eventWriter) write(v interface{}) {
+	if w.enc == nil {
+		return
+	}
+	if err := w.enc.Encode(v); err != nil {
+		// Don't fail the update just because the consumer went away
+		log.Debugf("Error writing event: %v", err)
+	}
+}
+
+// object records the outcome of an action on o.
+func (w *eventWriter) object(o runtime.Object, action Action, d time.Duration, err error) {
+	if w == nil {
+		return
+	}
+	gvk := o.GetObjectKind().GroupVersionKind()
+	ev := ObjectEvent{
+		APIVersion:      gvk.GroupVersion().String(),
+		Kind:            gvk.Kind,
+		Action:          action,
+		DryRun:          w.dryRun,
+		DurationSeconds: d.Seconds(),
+	}
+	if m, merr := meta.Accessor(o); merr == nil {
+		ev.Namespace = m.GetNamespace()
+		ev.Name = m.GetName()
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.counts[string(action)]++
+	w.write(ev)
+	if w.observer != nil {
+		w.observer.OnObject(gvk, ev.Namespace, ev.Name, action, err)
+	}
+}
+
+// recordLatency includes the latency of stats in the summary.
+func (w *eventWriter) recordLatency(stats *latencyStats) {
+	if w == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.stats = stats
+}
+
+// summary records the end of the run, which failed if err is set.
+func (w *eventWriter) summary(err error) {
+	if w == nil {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	s := RunSummary{
+		Summary:         w.counts,
+		DryRun:          w.dryRun,
+		DurationSeconds: time.Since(w.start).Seconds(),
+	}
+	if w.stats != nil {
+		latency := w.stats.summary().Seconds()
+		s.Latency = &latency
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	w.write(s)
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestEventWriter(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "ns"},
+	}}
+
+	// A nil writer ignores events
+	none := newEventWriter(nil, nil, false)
+	none.object(obj, "updated", time.Second, nil)
+	none.summary(nil)
+
+	var out bytes.Buffer
+	w := newEventWriter(&out, nil, true)
+	w.object(obj, "created", 1500*time.Millisecond, nil)
+	w.object(obj, "failed", 0, fmt.Errorf("boom"))
+	w.object(obj, "created", 0, nil)
+	stats := newLatencyStats()
+	stats.record(500 * time.Millisecond)
+	stats.record(1500 * time.Millisecond)
+	w.recordLatency(stats)
+	w.summary(fmt.Errorf("boom"))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %q", out.String())
+	}
+
+	var ev ObjectEvent
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil {
+		t.Fatalf("Error parsing %q: %v", lines[0], err)
+	}
+	expected := ObjectEvent{
+		APIVersion:      "apps/v1",
+		Kind:            "Deployment",
+		Namespace:       "ns",
+		Name:            "web",
+		Action:          "created",
+		DryRun:          true,
+		DurationSeconds: 1.5,
+	}
+	if ev != expected {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+
+	ev = ObjectEvent{}
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatalf("Error parsing %q: %v", lines[1], err)
+	}
+	if ev.Action != "failed" || ev.Error != "boom" {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+
+	var s RunSummary
+	if err := json.Unmarshal([]byte(lines[3]), &s); err != nil {
+		t.Fatalf("Error parsing %q: %v", lines[3], err)
+	}
+	if !reflect.DeepEqual(s.Summary, map[string]int{"created": 2, "failed": 1}) {
+		t.Errorf("Unexpected summary %v", s.Summary)
+	}
+	if s.Error != "boom" || !s.DryRun {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+	if l := s.Latency; l == nil || l.Count != 2 || l.MinSeconds != 0.5 || l.MedianSeconds != 0.5 || l.P95Seconds != 1.5 || l.MaxSeconds != 1.5 || l.WallSeconds <= 0 {
+		t.Errorf("Unexpected latency %+v", s.Latency)
+	}
+	if !strings.Contains(lines[3], `"p95Seconds":1.5`) {
+		t.Errorf("Latency not in seconds: %s", lines[3])
+	}
+}
+
+type recordingObserver []string
+
+func (r *recordingObserver) OnObject(gvk schema.GroupVersionKind, namespace, name string, action Action, err error) {
+	*r = append(*r, fmt.Sprintf("%s %s/%s %s %v", gvk.Kind, namespace, name, action, err))
+}
+
+func TestEventWriterObserver(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "ns"},
+	}}
+
+	// Observers work without an event stream
+	var seen recordingObserver
+	w := newEventWriter(nil, &seen, false)
+	w.object(obj, Created, time.Second, nil)
+	w.object(obj, Failed, 0, fmt.Errorf("boom"))
+	w.summary(nil)
+
+	expected := recordingObserver{"Deployment ns/web created <nil>", "Deployment ns/web failed boom"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Unexpected observations %q", seen)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Metadata that Helm 3 (and for heritage, Helm 2) uses to mark the
+// objects it manages.
+const (
+	helmLabelManagedBy      = "app.kubernetes.io/managed-by"
+	helmLabelHeritage       = "heritage"
+	helmLabelRelease        = "release"
+	helmAnnotationRelease   = "meta.helm.sh/release-name"
+	helmAnnotationReleaseNs = "meta.helm.sh/release-namespace"
+	helmManagedByValue      = "Helm"
+	helmHeritageTillerValue = "Tiller"
+)
+
+var (
+	// Labels are only removed if they have Helm's value, since
+	// eg: "heritage" may mean something else to someone else
+	helmLabels = map[string]string{
+		helmLabelManagedBy: helmManagedByValue,
+		helmLabelHeritage:  helmHeritageTillerValue,
+	}
+	helmAnnotations = []string{helmAnnotationRelease, helmAnnotationReleaseNs}
+)
+
+// helmRelease returns the Helm release that manages live, if any.
+func helmRelease(live metav1.Object) (string, bool) {
+	l := live.GetLabels()
+	a := live.GetAnnotations()
+
+	if name := a[helmAnnotationRelease]; name != "" {
+		if ns := a[helmAnnotationReleaseNs]; ns != "" {
+			return ns + "/" + name, true
+		}
+		return name, true
+	}
+	if l[helmLabelHeritage] == helmHeritageTillerValue {
+		return l[helmLabelRelease], true
+	}
+	if l[helmLabelManagedBy] == helmManagedByValue {
+		return "(unknown)", true
+	}
+	return "", false
+}
+
+// withoutHelmMetadata returns a copy of obj that, as a merge patch,
+// also removes the Helm labels and annotations found on live.
+// Values set explicitly in obj are kept.
+func withoutHelmMetadata(obj, live *unstructured.Unstructured) *unstructured.Unstructured {
+	ret := obj.DeepCopy()
+	remove := func(field, key string, objValues map[string]string) {
+		if _, ok := objValues[key]; !ok {
+			// null deletes a key in a JSON merge patch
+			unstructured.SetNestedField(ret.Object, nil, "metadata", field, key)
+		}
+	}
+
+	liveLabels := live.GetLabels()
+	for k, v := range helmLabels {
+		if liveLabels[k] == v {
+			remove("labels", k, obj.GetLabels())
+		}
+	}
+	liveAnnotations := live.GetAnnotations()
+	for _, k := range helmAnnotations {
+		if _, ok := liveAnnotations[k]; ok {
+			remove("annotations", k, obj.GetAnnotations())
+		}
+	}
+	return ret
+}
+
+// helmRemovalPatch returns a merge patch with only the removals of
+// patch, from withoutHelmMetadata.  Server-side apply leaves fields
+// another manager set, so Helm's metadata is removed separately.
+func helmRemovalPatch(patch *unstructured.Unstructured) ([]byte, error) {
+	metadata := map[string]interface{}{}
+	for _, field := range []string{"labels", "annotations"} {
+		values, _, _ := unstructured.NestedMap(patch.Object, "metadata", field)
+		removed := map[string]interface{}{}
+		for k, v := range values {
+			if v == nil {
+				removed[k] = nil
+			}
+		}
+		if len(removed) > 0 {
+			metadata[field] = removed
+		}
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHelmRelease(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	if _, ok := helmRelease(obj); ok {
+		t.Errorf("Object without Helm metadata is Helm managed")
+	}
+
+	obj.SetLabels(map[string]string{helmLabelManagedBy: helmManagedByValue})
+	obj.SetAnnotations(map[string]string{
+		helmAnnotationRelease:   "myrelease",
+		helmAnnotationReleaseNs: "myns",
+	})
+	if r, ok := helmRelease(obj); !ok || r != "myns/myrelease" {
+		t.Errorf("Unexpected Helm release (%q, %v)", r, ok)
+	}
+
+	obj = &unstructured.Unstructured{}
+	obj.SetLabels(map[string]string{helmLabelHeritage: helmHeritageTillerValue, helmLabelRelease: "old"})
+	if r, ok := helmRelease(obj); !ok || r != "old" {
+		t.Errorf("Unexpected Helm 2 release (%q, %v)", r, ok)
+	}
+}
+
+func TestWithoutHelmMetadata(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name": "foo",
+				"labels": map[string]interface{}{
+					// Explicitly set in config, so kept
+					helmLabelHeritage: "mine",
+				},
+			},
+		},
+	}
+	live := obj.DeepCopy()
+	live.SetLabels(map[string]string{
+		helmLabelManagedBy: helmManagedByValue,
+		helmLabelHeritage:  helmHeritageTillerValue,
+		"app":              "foo",
+	})
+	live.SetAnnotations(map[string]string{helmAnnotationRelease: "myrelease"})
+
+	patch, err := json.Marshal(withoutHelmMetadata(obj, live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"annotations":{"meta.helm.sh/release-name":null},"labels":{"app.kubernetes.io/managed-by":null,"heritage":"mine"},"name":"foo"}}`
+	if strings.TrimSpace(string(patch)) != expected {
+		t.Errorf("Expected patch %s, got %s", expected, patch)
+	}
+
+	if _, ok := obj.GetLabels()[helmLabelManagedBy]; ok {
+		t.Errorf("Original object was modified")
+	}
+
+	// Only the removals, for use before server-side apply
+	patch, err = helmRemovalPatch(withoutHelmMetadata(obj, live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"metadata":{"annotations":{"meta.helm.sh/release-name":null},"labels":{"app.kubernetes.io/managed-by":null}}}`
+	if string(patch) != expected {
+		t.Errorf("Expected removal patch %s, got %s", expected, patch)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/base64"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	gkConfigMap = schema.GroupKind{Kind: "ConfigMap"}
+	gkSecret    = schema.GroupKind{Kind: "Secret"}
+)
+
+// mayBeImmutable returns true if obj is of a kind that supports
+// `immutable: true`.
+func mayBeImmutable(obj *unstructured.Unstructured) bool {
+	gk := obj.GroupVersionKind().GroupKind()
+	return gk == gkConfigMap || gk == gkSecret
+}
+
+func isImmutable(obj *unstructured.Unstructured) bool {
+	v, _, _ := unstructured.NestedBool(obj.Object, "immutable")
+	return v
+}
+
+// immutableData returns the data fields of a ConfigMap or Secret, in
+// the form the server stores them.
+func immutableData(obj *unstructured.Unstructured) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for _, field := range []string{"data", "binaryData"} {
+		if m, ok := obj.Object[field].(map[string]interface{}); ok {
+			for k, v := range m {
+				ret[field+"."+k] = v
+			}
+		}
+	}
+	// The server folds Secret stringData into (base64) data
+	if m, ok := obj.Object["stringData"].(map[string]interface{}); ok {
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				ret["data."+k] = base64.StdEncoding.EncodeToString([]byte(s))
+			}
+		}
+	}
+	return ret
+}
+
+// needsRecreate returns true if live is immutable, and updating it
+// to match config would require changes the server refuses to patch.
+func needsRecreate(config, live *unstructured.Unstructured) bool {
+	if !isImmutable(live) {
+		return false
+	}
+	return !isImmutable(config) ||
+		!reflect.DeepEqual(immutableData(config), immutableData(live))
+}
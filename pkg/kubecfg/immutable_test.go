@@ -0,0 +1,88 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNeedsRecreate(t *testing.T) {
+	secret := func(immutable bool, fields map[string]interface{}) *unstructured.Unstructured {
+		o := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "foo"},
+		}
+		if immutable {
+			o["immutable"] = true
+		}
+		for k, v := range fields {
+			o[k] = v
+		}
+		return &unstructured.Unstructured{Object: o}
+	}
+	data := func(k, v string) map[string]interface{} {
+		return map[string]interface{}{k: v}
+	}
+
+	for i, tc := range []struct {
+		config, live *unstructured.Unstructured
+		expected     bool
+	}{
+		{
+			// Mutable live object can always be patched
+			config:   secret(true, map[string]interface{}{"data": data("a", "Yg==")}),
+			live:     secret(false, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: false,
+		},
+		{
+			// Unchanged immutable object
+			config:   secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			live:     secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: false,
+		},
+		{
+			// stringData is compared in its encoded form
+			config:   secret(true, map[string]interface{}{"stringData": data("a", "a")}),
+			live:     secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: false,
+		},
+		{
+			// Changed data
+			config:   secret(true, map[string]interface{}{"data": data("a", "Yg==")}),
+			live:     secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: true,
+		},
+		{
+			// Removed key
+			config:   secret(true, nil),
+			live:     secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: true,
+		},
+		{
+			// immutable can't be unset
+			config:   secret(false, map[string]interface{}{"data": data("a", "YQ==")}),
+			live:     secret(true, map[string]interface{}{"data": data("a", "YQ==")}),
+			expected: true,
+		},
+	} {
+		if actual := needsRecreate(tc.config, tc.live); actual != tc.expected {
+			t.Errorf("%d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+// AnnotationImpersonate names a service account, in the object's
+// namespace, that update and delete act as for that object.  The
+// server then applies that service account's RBAC rules, rather
+// than those of whoever is running kubecfg.
+const AnnotationImpersonate = "kubecfg.ksonnet.io/impersonate-service-account"
+
+// ClientPoolFactory returns a client pool that acts as user
+type ClientPoolFactory func(user string) (dynamic.ClientPool, error)
+
+// clientPools picks the client pool for each object, creating one
+// per impersonated identity as needed.
+type clientPools struct {
+	def       dynamic.ClientPool
+	factory   ClientPoolFactory
+	disco     discovery.ServerResourcesInterface
+	defaultNs string
+
+	lock  sync.Mutex
+	pools map[string]dynamic.ClientPool
+}
+
+func newClientPools(def dynamic.ClientPool, factory ClientPoolFactory, disco discovery.ServerResourcesInterface, defaultNs string) *clientPools {
+	return &clientPools{
+		def:       def,
+		factory:   factory,
+		disco:     disco,
+		defaultNs: defaultNs,
+		pools:     map[string]dynamic.ClientPool{},
+	}
+}
+
+// forObject returns the client pool for obj, and the user it acts
+// as ("" for the default identity).
+func (p *clientPools) forObject(obj runtime.Object) (dynamic.ClientPool, string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := m.GetAnnotations()[AnnotationImpersonate]; !ok {
+		return p.def, "", nil
+	}
+	rsrc, err := utils.ResourceFor(p.disco, obj)
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := impersonatedUser(m, rsrc.Namespaced, p.defaultNs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if pool, ok := p.pools[user]; ok {
+		return pool, user, nil
+	}
+	if p.factory == nil {
+		return nil, "", fmt.Errorf("%s is set, but impersonation is not available", AnnotationImpersonate)
+	}
+	pool, err := p.factory(user)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to impersonate %s: %v", user, err)
+	}
+	p.pools[user] = pool
+	return pool, user, nil
+}
+
+// impersonatedUser returns the service account username named by
+// obj's AnnotationImpersonate, or "" if it has none.  The annotation
+// is "name" for a service account in obj's namespace.  Cluster-scoped
+// objects must give "namespace/name" instead.  Namespaced objects may
+// only name their own namespace, so config for one namespace can't
+// act with the rights of another's service accounts.
+func impersonatedUser(obj metav1.Object, namespaced bool, defaultNs string) (string, error) {
+	value, ok := obj.GetAnnotations()[AnnotationImpersonate]
+	if !ok {
+		return "", nil
+	}
+
+	var namespace string
+	if namespaced {
+		namespace = obj.GetNamespace()
+		if namespace == "" {
+			namespace = defaultNs
+		}
+	}
+	name := value
+	if i := strings.Index(value, "/"); i >= 0 {
+		name = value[i+1:]
+		if errs := validation.IsDNS1123Label(value[:i]); len(errs) > 0 {
+			return "", fmt.Errorf("Invalid %s %q: %s", AnnotationImpersonate, value, strings.Join(errs, "; "))
+		}
+		if namespaced && value[:i] != namespace {
+			return "", fmt.Errorf("%s %q must name a service account in the object's namespace %q", AnnotationImpersonate, value, namespace)
+		}
+		namespace = value[:i]
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("Invalid %s %q: %s", AnnotationImpersonate, value, strings.Join(errs, "; "))
+	}
+	if namespace == "" {
+		return "", fmt.Errorf("%s %q needs a namespace for a cluster-scoped object", AnnotationImpersonate, value)
+	}
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestImpersonatedUser(t *testing.T) {
+	tests := []struct {
+		clusterScoped bool
+		namespace     string
+		annotation    string
+		expected      string
+		err           bool
+	}{
+		{namespace: "ns", expected: ""},
+		{namespace: "ns", annotation: "deployer", expected: "system:serviceaccount:ns:deployer"},
+		{namespace: "", annotation: "deployer", expected: "system:serviceaccount:default:deployer"},
+		{namespace: "ns", annotation: "ns/deployer", expected: "system:serviceaccount:ns:deployer"},
+		{namespace: "", annotation: "default/deployer", expected: "system:serviceaccount:default:deployer"},
+		// Namespaced objects can't borrow another namespace's
+		// service accounts
+		{namespace: "ns", annotation: "kube-system/deployer", err: true},
+		{namespace: "", annotation: "other/deployer", err: true},
+		{clusterScoped: true, annotation: "other/deployer", expected: "system:serviceaccount:other:deployer"},
+		// Cluster-scoped objects need an explicit namespace
+		{clusterScoped: true, annotation: "deployer", err: true},
+		{annotation: "Not Valid", err: true},
+		{annotation: "/deployer", err: true},
+	}
+	for _, test := range tests {
+		obj := &unstructured.Unstructured{}
+		obj.SetNamespace(test.namespace)
+		if test.annotation != "" {
+			obj.SetAnnotations(map[string]string{AnnotationImpersonate: test.annotation})
+		}
+
+		user, err := impersonatedUser(obj, !test.clusterScoped, "default")
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", test.annotation, user)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.annotation, err)
+		} else if user != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.annotation, user, test.expected)
+		}
+	}
+}
+
+func TestClientPools(t *testing.T) {
+	def := &fakedynamic.FakeClientPool{}
+	var created []string
+	factory := func(user string) (dynamic.ClientPool, error) {
+		created = append(created, user)
+		return &fakedynamic.FakeClientPool{}, nil
+	}
+	disco := &fakedisco.FakeDiscovery{Fake: &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "patch"}},
+				},
+			},
+		},
+	}}
+	pools := newClientPools(def, factory, disco, "default")
+
+	plain := &unstructured.Unstructured{}
+	pool, user, err := pools.forObject(plain)
+	if err != nil || pool != def || user != "" {
+		t.Errorf("Unexpected pool for unannotated object: %v %q %v", pool, user, err)
+	}
+
+	tenant := &unstructured.Unstructured{}
+	tenant.SetAPIVersion("v1")
+	tenant.SetKind("ConfigMap")
+	tenant.SetNamespace("tenant")
+	tenant.SetAnnotations(map[string]string{AnnotationImpersonate: "deployer"})
+	first, user, err := pools.forObject(tenant)
+	if err != nil || first == def || user != "system:serviceaccount:tenant:deployer" {
+		t.Errorf("Unexpected pool for annotated object: %v %q %v", first, user, err)
+	}
+	second, _, _ := pools.forObject(tenant)
+	if second != first || len(created) != 1 {
+		t.Errorf("Pool was not cached: created %v", created)
+	}
+
+	// Without a factory, impersonation is refused rather than
+	// falling back to the default identity
+	if _, _, err := newClientPools(def, nil, disco, "default").forObject(tenant); err == nil {
+		t.Errorf("Expected an error without a factory")
+	}
+
+	escape := tenant.DeepCopy()
+	escape.SetAnnotations(map[string]string{AnnotationImpersonate: "kube-system/deployer"})
+	if _, _, err := pools.forObject(escape); err == nil {
+		t.Errorf("Impersonated a service account in another namespace")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// labelSelector locates a label selector, and the pod template
+// labels that it must continue to match.
+type labelSelector struct {
+	selector []string
+	template []string
+}
+
+var (
+	workloadSelector = labelSelector{
+		selector: []string{"spec", "selector", "matchLabels"},
+		template: []string{"spec", "template", "metadata", "labels"},
+	}
+	mapSelector = labelSelector{
+		selector: []string{"spec", "selector"},
+		template: []string{"spec", "template", "metadata", "labels"},
+	}
+	serviceSelector = labelSelector{
+		selector: []string{"spec", "selector"},
+	}
+)
+
+// labelSelectors are the selectors that addSelectorLabels may
+// extend.  Most are immutable once created.
+var labelSelectors = map[schema.GroupKind]labelSelector{
+	{Group: "", Kind: "ReplicationController"}: mapSelector,
+	{Group: "", Kind: "Service"}:               serviceSelector,
+	{Group: "apps", Kind: "Deployment"}:        workloadSelector,
+	{Group: "apps", Kind: "ReplicaSet"}:        workloadSelector,
+	{Group: "apps", Kind: "StatefulSet"}:       workloadSelector,
+	{Group: "apps", Kind: "DaemonSet"}:         workloadSelector,
+	{Group: "extensions", Kind: "Deployment"}:  workloadSelector,
+	{Group: "extensions", Kind: "ReplicaSet"}:  workloadSelector,
+	{Group: "extensions", Kind: "DaemonSet"}:   workloadSelector,
+}
+
+// addSelectorLabels adds labels to obj's label selector, and to its
+// pod template so the selector still matches.  This is only safe
+// for objects that don't exist yet, since selectors are immutable.
+// Objects without a selector are left alone, so that eg: a Service
+// without a selector doesn't start selecting pods.
+func addSelectorLabels(obj *unstructured.Unstructured, labels map[string]string) error {
+	s, ok := labelSelectors[obj.GroupVersionKind().GroupKind()]
+	if !ok || len(labels) == 0 {
+		return nil
+	}
+
+	selector, found, err := unstructured.NestedStringMap(obj.Object, s.selector...)
+	if err != nil || !found || len(selector) == 0 {
+		return err
+	}
+	for k, v := range labels {
+		selector[k] = v
+	}
+	if err := unstructured.SetNestedStringMap(obj.Object, selector, s.selector...); err != nil {
+		return err
+	}
+
+	if s.template == nil {
+		return nil
+	}
+	template, _, err := unstructured.NestedStringMap(obj.Object, s.template...)
+	if err != nil {
+		return err
+	}
+	if template == nil {
+		template = map[string]string{}
+	}
+	for k, v := range labels {
+		template[k] = v
+	}
+	return unstructured.SetNestedStringMap(obj.Object, template, s.template...)
+}
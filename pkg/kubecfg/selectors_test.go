@@ -0,0 +1,109 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+func TestSelectorLabels(t *testing.T) {
+	deployment := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"name": "foo"},
+				},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels": map[string]interface{}{"name": "foo"},
+					},
+				},
+			},
+		}}
+	}
+	service := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"name": "foo"},
+			},
+		}}
+	}
+	labels := map[string]string{"app": "bar"}
+	get := func(obj *unstructured.Unstructured, path ...string) map[string]string {
+		m, _, err := unstructured.NestedStringMap(obj.Object, path...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	unchanged := map[string]string{"name": "foo"}
+	extended := map[string]string{"name": "foo", "app": "bar"}
+
+	// Global labels only touch metadata
+	for _, obj := range []*unstructured.Unstructured{deployment(), service()} {
+		utils.MergeMetaDataLabels(obj, labels, false)
+		if !reflect.DeepEqual(obj.GetLabels(), labels) {
+			t.Errorf("Unexpected %s labels %v", obj.GetKind(), obj.GetLabels())
+		}
+		path := []string{"spec", "selector"}
+		if obj.GetKind() == "Deployment" {
+			path = append(path, "matchLabels")
+		}
+		if s := get(obj, path...); !reflect.DeepEqual(s, unchanged) {
+			t.Errorf("%s selector changed to %v", obj.GetKind(), s)
+		}
+	}
+
+	d := deployment()
+	if err := addSelectorLabels(d, labels); err != nil {
+		t.Fatal(err)
+	}
+	if s := get(d, "spec", "selector", "matchLabels"); !reflect.DeepEqual(s, extended) {
+		t.Errorf("Unexpected Deployment selector %v", s)
+	}
+	if l := get(d, "spec", "template", "metadata", "labels"); !reflect.DeepEqual(l, extended) {
+		t.Errorf("Unexpected Deployment template labels %v", l)
+	}
+
+	s := service()
+	if err := addSelectorLabels(s, labels); err != nil {
+		t.Fatal(err)
+	}
+	if sel := get(s, "spec", "selector"); !reflect.DeepEqual(sel, extended) {
+		t.Errorf("Unexpected Service selector %v", sel)
+	}
+
+	// A Service without a selector must not start selecting pods
+	s = service()
+	unstructured.RemoveNestedField(s.Object, "spec", "selector")
+	if err := addSelectorLabels(s, labels); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := unstructured.NestedFieldCopy(s.Object, "spec", "selector"); found {
+		t.Errorf("Selector added to Service without one")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySummary describes the distribution of per-object API
+// call durations over a run.
+type LatencySummary struct {
+	Count  int
+	Min    time.Duration
+	Median time.Duration
+	P95    time.Duration
+	Max    time.Duration
+	Wall   time.Duration
+}
+
+// LatencySeconds is a LatencySummary in seconds, as written in a
+// RunSummary.
+type LatencySeconds struct {
+	Count         int     `json:"count"`
+	MinSeconds    float64 `json:"minSeconds"`
+	MedianSeconds float64 `json:"medianSeconds"`
+	P95Seconds    float64 `json:"p95Seconds"`
+	MaxSeconds    float64 `json:"maxSeconds"`
+	WallSeconds   float64 `json:"wallSeconds"`
+}
+
+// Seconds returns s in seconds.
+func (s LatencySummary) Seconds() LatencySeconds {
+	return LatencySeconds{
+		Count:         s.Count,
+		MinSeconds:    s.Min.Seconds(),
+		MedianSeconds: s.Median.Seconds(),
+		P95Seconds:    s.P95.Seconds(),
+		MaxSeconds:    s.Max.Seconds(),
+		WallSeconds:   s.Wall.Seconds(),
+	}
+}
+
+func (s LatencySummary) String() string {
+	return fmt.Sprintf("%d objects in %s (min %s, median %s, p95 %s, max %s)",
+		s.Count, s.Wall, s.Min, s.Median, s.P95, s.Max)
+}
+
+// latencyStats records per-object durations.  It is safe for
+// concurrent use, since objects may be updated in parallel.
+type latencyStats struct {
+	lock      sync.Mutex
+	start     time.Time
+	durations []time.Duration
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{start: time.Now()}
+}
+
+func (s *latencyStats) record(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.durations = append(s.durations, d)
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (s *latencyStats) summary() LatencySummary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sorted := make([]time.Duration, len(s.durations))
+	copy(sorted, s.durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ret := LatencySummary{
+		Count:  len(sorted),
+		Median: percentile(sorted, 0.5),
+		P95:    percentile(sorted, 0.95),
+		Wall:   time.Since(s.start),
+	}
+	if len(sorted) > 0 {
+		ret.Min = sorted[0]
+		ret.Max = sorted[len(sorted)-1]
+	}
+	return ret
+}
@@ -1,10 +1,17 @@
 package kubecfg
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/sergi/go-diff/diffmatchpatch"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -58,15 +65,191 @@ type UpdateCmd struct {
 	DefaultNamespace string
 
 	Create bool
-	GcTag  string
-	SkipGc bool
-	DryRun bool
+	// GcTag is stamped on every updated object.
+	GcTag string
+	// PruneTag selects the objects considered for garbage
+	// collection, by their gc tag.  It defaults to GcTag, but may
+	// differ when another process owns pruning.
+	PruneTag string
+	SkipGc   bool
+	DryRun   bool
+
+	// ServerDryRun sends every write to the server as a dry run,
+	// so admission webhooks and defaulting run without anything
+	// being persisted.  ClientPool (and Impersonate) must already
+	// add dryRun to writes; this only checks that the server
+	// supports it, and logs what it would have done.
+	ServerDryRun bool
+
+	// Version of this kubecfg, recorded on every updated object
+	Version string
+	// RefuseDowngrade fails the update of an object last
+	// updated by a newer kubecfg, rather than just warning.
+	RefuseDowngrade bool
+
+	// RecreateImmutable deletes and recreates immutable
+	// ConfigMaps and Secrets whose data has changed, since the
+	// server refuses to patch them.
+	RecreateImmutable bool
+
+	// SkipUnknown skips objects of kinds the server doesn't
+	// serve (eg: a mistyped apiVersion, or a missing CRD), rather
+	// than failing before anything is updated.
+	SkipUnknown bool
+
+	// SkipUnavailableConversions skips objects (and garbage
+	// collection) of custom resource kinds whose conversion
+	// webhook is failing, rather than aborting the update.
+	SkipUnavailableConversions bool
+
+	// SelectorLabels are added to the label selectors (and pod
+	// templates) of objects being created.  Existing objects are
+	// never changed, since their selectors are immutable.
+	SelectorLabels map[string]string
+
+	// AdoptFromHelm takes over objects managed by Helm, removing
+	// Helm's labels and annotations as they are updated.
+	AdoptFromHelm bool
+
+	// OnlyChanged compares every object with the server first,
+	// and only writes those that differ.  Fields limits which
+	// fields of each kind are compared.
+	OnlyChanged bool
+	Fields      utils.CompareConfig
+
+	// Impersonate creates the client pools for objects with
+	// AnnotationImpersonate.  Other objects use ClientPool.
+	Impersonate ClientPoolFactory
+
+	// Events, if set, receives a line of JSON as each object is
+	// finished with, and a summary at the end.
+	Events io.Writer
+	// Observer, if set, is told as each object is finished with
+	Observer Observer
+
+	// ServerSide, if set, writes objects with server-side apply
+	// as FieldManager, rather than with a merge patch.
+	// ForceConflicts takes ownership of fields owned by other
+	// managers.
+	ServerSide     Applier
+	FieldManager   string
+	ForceConflicts bool
+
+	// Parallelism is the number of objects to update at once,
+	// within each dependency tier.  Unless FailFast is set, a
+	// failure stops the update only once the rest of its tier has
+	// been attempted.
+	Parallelism int
+	FailFast    bool
+
+	// ConflictAttempts is the number of times to try writing an
+	// object that another writer keeps modifying.  Zero means
+	// DefaultConflictAttempts.
+	ConflictAttempts int
+
+	// Wait, if set, waits after updating for every updated object
+	// to become ready, for up to WaitTimeout (or forever, if zero).
+	Wait        bool
+	WaitTimeout time.Duration
+
+	// ctx, if set, stops objects being started once it is done
+	// (see Updater.Apply)
+	ctx context.Context
 }
 
-func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) error {
+// DefaultConflictAttempts is the default UpdateCmd.ConflictAttempts
+const DefaultConflictAttempts = 5
+
+// Delay before the first retry after a conflict, doubling for each
+// later retry up to maxConflictBackoff.  Variables for tests.
+var (
+	minConflictBackoff = 100 * time.Millisecond
+	maxConflictBackoff = 5 * time.Second
+)
+
+func conflictBackoff(attempt int) time.Duration {
+	d := minConflictBackoff
+	for i := 1; i < attempt && d < maxConflictBackoff; i++ {
+		d *= 2
+	}
+	if d > maxConflictBackoff {
+		d = maxConflictBackoff
+	}
+	return d
+}
+
+func (c UpdateCmd) conflictAttempts() int {
+	if c.ConflictAttempts <= 0 {
+		return DefaultConflictAttempts
+	}
+	return c.ConflictAttempts
+}
+
+// Applier sends server-side apply requests (see utils.Applier)
+type Applier interface {
+	Apply(obj *unstructured.Unstructured, defNs, user string, opts utils.ApplyOptions) (result *unstructured.Unstructured, created bool, err error)
+}
+
+// apply writes obj with server-side apply as user, which creates
+// missing objects.  live is the server's copy, if already fetched.
+func (c UpdateCmd) apply(rc dynamic.ResourceInterface, obj, live *unstructured.Unstructured, user string) (metav1.Object, Action, error) {
+	action := Updated
+	if live == nil && (!c.Create || len(c.SelectorLabels) > 0) {
+		var err error
+		live, err = rc.Get(obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			if !c.Create {
+				return nil, action, err
+			}
+			live = nil
+		} else if err != nil {
+			return nil, action, err
+		}
+		if live == nil {
+			action = Created
+			if err := addSelectorLabels(obj, c.SelectorLabels); err != nil {
+				return nil, action, err
+			}
+		}
+	}
+
+	opts := utils.ApplyOptions{
+		FieldManager: c.FieldManager,
+		Force:        c.ForceConflicts,
+	}
+	newobj, created, err := c.ServerSide.Apply(obj, c.DefaultNamespace, user, opts)
+	if err != nil {
+		return nil, action, err
+	}
+	if created {
+		// Usually nothing was fetched to tell
+		action = Created
+	}
+	return newobj, action, nil
+}
+
+func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) (err error) {
 	dryRunText := ""
 	if c.DryRun {
 		dryRunText = " (dry-run)"
+	} else if c.ServerDryRun {
+		dryRunText = " (server dry-run)"
+	}
+
+	events := newEventWriter(c.Events, c.Observer, c.DryRun || c.ServerDryRun)
+	defer func() { events.summary(err) }()
+
+	if c.ServerDryRun {
+		if err := utils.CheckServerDryRun(c.Discovery); err != nil {
+			return err
+		}
+	}
+
+	pools := newClientPools(c.ClientPool, c.Impersonate, c.Discovery, c.DefaultNamespace)
+
+	apiObjects, err = c.servableObjects(apiObjects, events)
+	if err != nil {
+		return err
 	}
 
 	log.Infof("Fetching schemas for %d resources", len(apiObjects))
@@ -77,6 +260,14 @@ func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) error {
 	sort.Sort(depOrder)
 
 	seenUids := sets.NewString()
+	// GroupKinds skipped due to unavailable conversion webhooks
+	skippedKinds := sets.NewString()
+	// Helm releases that objects were adopted from
+	helmReleases := sets.NewString()
+
+	// Only release versions are ordered, so only they can be
+	// checked for downgrades.
+	_, checkVersion := parseReleaseVersion(c.Version)
 
 	for _, obj := range apiObjects {
 		if c.GcTag != "" {
@@ -84,52 +275,243 @@ func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) error {
 			utils.SetMetaDataAnnotation(obj, AnnotationGcTag, c.GcTag)
 			utils.SetMetaDataLabel(obj, LabelGcTag, c.GcTag)
 		}
+		if c.Version != "" {
+			utils.SetMetaDataAnnotation(obj, AnnotationAppliedVersion, c.Version)
+		}
+	}
+
+	if c.OnlyChanged {
+		start := time.Now()
+		total := len(apiObjects)
+		apiObjects, err = c.changedObjects(apiObjects, pools, seenUids, events)
+		if err != nil {
+			return err
+		}
+		log.Infof("Compared %d objects with the server in %s: skipping %d unchanged, updating %d",
+			total, time.Since(start), total-len(apiObjects), len(apiObjects))
+	}
 
+	tiers, err := utils.DependencyTiers(c.Discovery, apiObjects)
+	if err != nil {
+		return err
+	}
+
+	stats := newLatencyStats()
+	events.recordLatency(stats)
+	var waitItems []waitItem
+	// Guards seenUids, skippedKinds, helmReleases and waitItems
+	// while objects are being updated
+	var lock sync.Mutex
+	updateObject := func(obj *unstructured.Unstructured) error {
 		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
-		log.Info("Updating ", desc, dryRunText)
+		start := time.Now()
+		// Every failure is reported, including those before
+		// anything is sent
+		fail := func(err error) error {
+			events.object(obj, Failed, time.Since(start), err)
+			return err
+		}
 
-		rc, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.DefaultNamespace)
+		pool, user, err := pools.forObject(obj)
 		if err != nil {
-			return err
+			return fail(fmt.Errorf("Error updating %s: %v", desc, err))
+		}
+		if user != "" {
+			desc = fmt.Sprintf("%s (as %s)", desc, user)
+		}
+		log.Info("Updating ", desc, dryRunText)
+		skip := func(err error) bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return c.skipConversion(obj, desc, err, skippedKinds)
 		}
 
-		asPatch, err := json.Marshal(obj)
+		rc, err := utils.ClientForResource(pool, c.Discovery, obj, c.DefaultNamespace)
 		if err != nil {
-			return err
+			return fail(fmt.Errorf("Error updating %s: %v", desc, err))
 		}
+
 		var newobj metav1.Object
-		if !c.DryRun {
-			newobj, err = rc.Patch(obj.GetName(), types.MergePatchType, asPatch)
-			log.Debugf("Patch(%s) returned (%v, %v)", obj.GetName(), newobj, err)
-		} else {
-			newobj, err = rc.Get(obj.GetName(), metav1.GetOptions{})
-		}
-		if c.Create && errors.IsNotFound(err) {
-			log.Info(" Creating non-existent ", desc, dryRunText)
-			if !c.DryRun {
-				newobj, err = rc.Create(obj)
-				log.Debugf("Create(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+		var live *unstructured.Unstructured
+		action := Updated
+
+		for attempt := 1; ; attempt++ {
+			action = Updated
+
+			live = nil
+			if checkVersion || mayBeImmutable(obj) || c.AdoptFromHelm || c.ServerDryRun {
+				live, err = rc.Get(obj.GetName(), metav1.GetOptions{})
+				if errors.IsNotFound(err) {
+					live = nil
+				} else if err != nil {
+					if err = c.conversionFailure(obj, err); skip(err) {
+						events.object(obj, Skipped, time.Since(start), err)
+						return nil
+					}
+					return fail(fmt.Errorf("Error fetching %s: %v", desc, err))
+				}
+			}
+
+			if live != nil && checkVersion {
+				if v := newerAppliedVersion(live, c.Version); v != "" {
+					if c.RefuseDowngrade {
+						return fail(fmt.Errorf("Error updating %s: object was last updated by kubecfg %s, which is newer than this kubecfg %s", desc, v, c.Version))
+					}
+					log.Warnf(" %s was last updated by kubecfg %s, which is newer than this kubecfg %s", desc, v, c.Version)
+				}
+			}
+
+			patch := obj
+			if live != nil && c.AdoptFromHelm {
+				if release, ok := helmRelease(live); ok {
+					log.Infof(" Adopting %s from Helm release %s%s", desc, release, dryRunText)
+					lock.Lock()
+					helmReleases.Insert(release)
+					lock.Unlock()
+					patch = withoutHelmMetadata(obj, live)
+				}
+			}
+			var asPatch []byte
+			asPatch, err = json.Marshal(patch)
+			if err != nil {
+				return fail(fmt.Errorf("Error encoding %s: %v", desc, err))
+			}
+
+			var recreate *unstructured.Unstructured
+			if live != nil && mayBeImmutable(obj) && needsRecreate(obj, live) {
+				if !c.RecreateImmutable {
+					return fail(fmt.Errorf("Error updating %s: object is immutable and its data has changed, so it cannot be patched. Rerun with --recreate-immutable to delete and recreate it", desc))
+				}
+				recreate = live
+			}
+
+			if recreate != nil {
+				log.Info(" Recreating immutable ", desc, dryRunText)
+				log.Warnf(" Pods already consuming %s keep the old data until they are restarted", desc)
+				action = Recreated
+				if c.ServerDryRun {
+					// A dry-run create would find the
+					// object still there
+					uid := recreate.GetUID()
+					err = rc.Delete(recreate.GetName(), &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+					newobj = obj
+				} else if !c.DryRun {
+					newobj, err = recreateObject(rc, recreate, obj)
+					log.Debugf("Recreate(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+				} else {
+					newobj = obj
+				}
+			} else if c.ServerSide != nil && !c.DryRun {
+				if patch != obj {
+					// Apply alone would leave Helm's
+					// metadata, which kubecfg's field
+					// manager never owned
+					var helmPatch []byte
+					if helmPatch, err = helmRemovalPatch(patch); err == nil {
+						_, err = rc.Patch(obj.GetName(), types.MergePatchType, helmPatch)
+						log.Debugf("Patch(%s) removing Helm metadata returned %v", obj.GetName(), err)
+					}
+				}
+				if err == nil {
+					newobj, action, err = c.apply(rc, obj, live, user)
+					log.Debugf("Apply(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+				}
+			} else if !c.DryRun {
+				newobj, err = rc.Patch(obj.GetName(), types.MergePatchType, asPatch)
+				log.Debugf("Patch(%s) returned (%v, %v)", obj.GetName(), newobj, err)
 			} else {
-				newobj = obj
-				err = nil
+				newobj, err = rc.Get(obj.GetName(), metav1.GetOptions{})
+			}
+			if c.Create && errors.IsNotFound(err) {
+				log.Info(" Creating non-existent ", desc, dryRunText)
+				action = Created
+				if err = addSelectorLabels(obj, c.SelectorLabels); err != nil {
+					return fail(fmt.Errorf("Error adding selector labels to %s: %v", desc, err))
+				}
+				if !c.DryRun {
+					newobj, err = rc.Create(obj)
+					log.Debugf("Create(%s) returned (%v, %v)", obj.GetName(), newobj, err)
+				} else {
+					newobj = obj
+					err = nil
+				}
 			}
+
+			if !errors.IsConflict(err) || attempt >= c.conflictAttempts() {
+				break
+			}
+			// Another writer got in first: start again from
+			// the server's latest copy
+			delay := conflictBackoff(attempt)
+			log.Warnf(" Conflict updating %s, retrying in %s (attempt %d of %d): %v", desc, delay, attempt+1, c.conflictAttempts(), err)
+			time.Sleep(delay)
 		}
+		elapsed := time.Since(start)
+		stats.record(elapsed)
 		if err != nil {
-			// TODO: retry
-			return fmt.Errorf("Error updating %s: %s", desc, err)
+			if err = c.conversionFailure(obj, err); skip(err) {
+				events.object(obj, Skipped, elapsed, err)
+				return nil
+			}
+			return fail(fmt.Errorf("Error updating %s: %s", desc, err))
+		}
+		if u, ok := newobj.(*unstructured.Unstructured); ok && u != nil && u.GetKind() != "" {
+			// The server's copy includes the default namespace
+			events.object(u, action, elapsed, nil)
+		} else {
+			events.object(obj, action, elapsed, nil)
 		}
 
 		log.Debug("Updated object: ", diff.ObjectDiff(obj, newobj))
 
+		if u, ok := newobj.(*unstructured.Unstructured); ok && c.ServerDryRun && action != Recreated {
+			if text := serverDryRunDiff(live, u); text != "" {
+				log.Infof(" Server dry-run result for %s:\n%s", desc, text)
+			}
+		}
+
+		if !c.DryRun && !c.ServerDryRun && isCustomResourceDefinition(obj) {
+			// Later objects may be of the newly defined kind
+			log.Debugf("Refreshing discovery after updating %s", desc)
+			utils.MarkDiscoveryStale(c.Discovery)
+		}
+
 		// Some objects appear under multiple kinds
 		// (eg: Deployment is both extensions/v1beta1
 		// and apps/v1beta1).  UID is the only stable
 		// identifier that links these two views of
 		// the same object.
+		lock.Lock()
 		seenUids.Insert(string(newobj.GetUID()))
+		if c.Wait {
+			waitItems = append(waitItems, waitItem{desc: desc, name: obj.GetName(), rc: rc})
+		}
+		lock.Unlock()
+		return nil
 	}
 
-	if c.GcTag != "" && !c.SkipGc {
+	// Tiers are updated in order, since later tiers may depend on
+	// earlier ones (eg: objects in a new namespace)
+	for _, tier := range tiers {
+		if err := c.forEach(tier, updateObject); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Updated ", stats.summary(), dryRunText)
+
+	for _, release := range helmReleases.List() {
+		// Helm 3 deletes the objects listed in its release
+		// record on uninstall, whatever their labels say.
+		log.Warnf("Objects were adopted from Helm release %s, which still lists them. Delete the release record rather than running helm uninstall, or they will be deleted", release)
+	}
+
+	pruneTag := c.PruneTag
+	if pruneTag == "" {
+		pruneTag = c.GcTag
+	}
+
+	if pruneTag != "" && !c.SkipGc {
 		version, err := utils.FetchVersion(c.Discovery)
 		if err != nil {
 			version = utils.GetDefaultVersion()
@@ -137,22 +519,35 @@ func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) error {
 		}
 
 		// [gctag-migration]: Add LabelGcTag==c.GcTag to ListOptions.LabelSelector in phase2
-		err = walkObjects(c.ClientPool, c.Discovery, metav1.ListOptions{}, func(o runtime.Object) error {
+		err = walkObjects(c.ClientPool, c.Discovery, metav1.ListOptions{}, c.SkipUnavailableConversions, func(o runtime.Object) error {
 			meta, err := meta.Accessor(o)
 			if err != nil {
 				return err
 			}
 			gvk := o.GetObjectKind().GroupVersionKind()
+			gk := gvk.GroupKind()
+			if skippedKinds.Has(gk.String()) {
+				// Objects we failed to update would look unseen
+				log.Debugf("Skipping gc of %s: kind was skipped during update", utils.FqName(meta))
+				return nil
+			}
 			desc := fmt.Sprintf("%s %s (%s)", utils.ResourceNameFor(c.Discovery, o), utils.FqName(meta), gvk.GroupVersion())
 			log.Debugf("Considering %v for gc", desc)
-			if eligibleForGc(meta, c.GcTag) && !seenUids.Has(string(meta.GetUID())) {
+			if eligibleForGc(meta, pruneTag) && !seenUids.Has(string(meta.GetUID())) {
 				log.Info("Garbage collecting ", desc, dryRunText)
+				start := time.Now()
 				if !c.DryRun {
-					err := gcDelete(c.ClientPool, c.Discovery, &version, o)
+					// Delete as whoever would have created it
+					pool, _, err := pools.forObject(o)
+					if err == nil {
+						err = gcDelete(pool, c.Discovery, &version, o)
+					}
 					if err != nil {
+						events.object(o, Failed, time.Since(start), err)
 						return err
 					}
 				}
+				events.object(o, GarbageCollected, time.Since(start), nil)
 			}
 			return nil
 		})
@@ -161,9 +556,235 @@ func (c UpdateCmd) Run(apiObjects []*unstructured.Unstructured) error {
 		}
 	}
 
+	if c.Wait && !c.DryRun && !c.ServerDryRun {
+		if err := waitForReady(waitItems, c.WaitTimeout); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// forEach calls fn on each of objs, with up to c.Parallelism calls
+// at once.  Unless c.FailFast is set, every object is attempted, and
+// the errors are returned together.
+func (c UpdateCmd) forEach(objs []*unstructured.Unstructured, fn func(*unstructured.Unstructured) error) error {
+	workers := c.Parallelism
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(objs) {
+		workers = len(objs)
+	}
+
+	var lock sync.Mutex
+	var errs []error
+	failed := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(errs) > 0
+	}
+
+	work := make(chan *unstructured.Unstructured)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range work {
+				if c.FailFast && failed() {
+					// Queued before the failure
+					continue
+				}
+				if err := fn(obj); err != nil {
+					lock.Lock()
+					errs = append(errs, err)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, obj := range objs {
+		if c.FailFast && failed() {
+			break
+		}
+		if c.ctx != nil && c.ctx.Err() != nil {
+			lock.Lock()
+			errs = append(errs, c.ctx.Err())
+			lock.Unlock()
+			break
+		}
+		work <- obj
+	}
+	close(work)
+	wg.Wait()
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("%d objects failed to update:\n  %s", len(errs), strings.Join(msgs, "\n  "))
+}
+
+// servableObjects checks that the server serves the kinds of every
+// one of apiObjects, before any are updated.  Objects it doesn't are
+// an error, or dropped with a warning if c.SkipUnknown is set.
+func (c UpdateCmd) servableObjects(apiObjects []*unstructured.Unstructured, events *eventWriter) ([]*unstructured.Unstructured, error) {
+	unknown := utils.UnservableKinds(c.Discovery, apiObjects)
+	if len(unknown) == 0 {
+		return apiObjects, nil
+	}
+
+	if !c.SkipUnknown {
+		msgs := make([]string, 0, len(unknown))
+		for gvk, err := range unknown {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", gvk, err))
+		}
+		sort.Strings(msgs)
+		return nil, fmt.Errorf("Server is unable to handle %d kinds, so nothing was updated. Rerun with --skip-unknown to skip their objects:\n  %s", len(unknown), strings.Join(msgs, "\n  "))
+	}
+
+	ret := make([]*unstructured.Unstructured, 0, len(apiObjects))
+	for _, obj := range apiObjects {
+		err, ok := unknown[obj.GroupVersionKind()]
+		if !ok {
+			ret = append(ret, obj)
+			continue
+		}
+		log.Warnf("Skipping %s %s: %v", obj.GetKind(), utils.FqName(obj), err)
+		events.object(obj, Skipped, 0, err)
+	}
+	return ret, nil
+}
+
+// conversionFailure describes err in more detail if it is due to an
+// unavailable conversion webhook for obj's kind.
+func (c UpdateCmd) conversionFailure(obj *unstructured.Unstructured, err error) error {
+	if !isConversionWebhookError(err) {
+		return err
+	}
+	rsrc, rerr := utils.ResourceFor(c.Discovery, obj)
+	if rerr != nil {
+		return err
+	}
+	return describeConversionError(c.ClientPool, rsrc.Name, obj.GroupVersionKind(), err)
+}
+
+// skipConversion reports whether obj should be skipped because err
+// is a conversion webhook failure and SkipUnavailableConversions is
+// set, recording its kind in skippedKinds.
+func (c UpdateCmd) skipConversion(obj *unstructured.Unstructured, desc string, err error, skippedKinds sets.String) bool {
+	if !c.SkipUnavailableConversions || !isConversionWebhookError(err) {
+		return false
+	}
+	log.Warnf("Skipping %s: %v", desc, err)
+	gk := obj.GroupVersionKind().GroupKind()
+	skippedKinds.Insert(gk.String())
+	return true
+}
+
+// changedObjects returns the objects that differ from the server,
+// recording the UIDs of the unchanged ones in seenUids so they are
+// not garbage collected.
+func (c UpdateCmd) changedObjects(apiObjects []*unstructured.Unstructured, pools *clientPools, seenUids sets.String, events *eventWriter) ([]*unstructured.Unstructured, error) {
+	ret := make([]*unstructured.Unstructured, 0, len(apiObjects))
+	for _, obj := range apiObjects {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+
+		pool, _, err := pools.forObject(obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching %s: %v", desc, err)
+		}
+
+		rc, err := utils.ClientForResource(pool, c.Discovery, obj, c.DefaultNamespace)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		live, err := rc.Get(obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) || isConversionWebhookError(err) {
+			// Conversion failures are reported (or skipped)
+			// by the update itself
+			ret = append(ret, obj)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Error fetching %s: %v", desc, err)
+		}
+
+		unchanged, err := isUnchanged(obj, live, c.Fields.For(obj.GroupVersionKind().GroupKind()))
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			log.Debug("Skipping unchanged ", desc)
+			events.object(live, Unchanged, time.Since(start), nil)
+			seenUids.Insert(string(live.GetUID()))
+			continue
+		}
+		ret = append(ret, obj)
+	}
+	return ret, nil
+}
+
+// isUnchanged reports whether every field of obj already has the
+// same value in live, as with the "subset" diff strategy.  Fields
+// that fields excludes are ignored.
+func isUnchanged(obj, live *unstructured.Unstructured, fields utils.CompareFields) (bool, error) {
+	// Compare as JSON, since numbers decoded from the server and
+	// from config may have different types.
+	liveText, err := json.Marshal(filterFields(removeMapFields(obj.Object, live.Object, "", nil), "", fields))
+	if err != nil {
+		return false, err
+	}
+	objText, err := json.Marshal(filterFields(obj.Object, "", fields))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(liveText, objText), nil
+}
+
+// recreateObject replaces live with obj by deleting and then
+// creating it.
+func recreateObject(rc dynamic.ResourceInterface, live, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	uid := live.GetUID()
+	deleteOpts := metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	}
+	if err := rc.Delete(live.GetName(), &deleteOpts); err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return rc.Create(obj)
+}
+
+// serverDryRunDiff returns the unified diff from live (nil if the
+// object doesn't exist) to result, the server's copy after a dry
+// run, ignoring fields that change on every write.
+func serverDryRunDiff(live, result *unstructured.Unstructured) string {
+	text := func(obj *unstructured.Unstructured) string {
+		if obj == nil {
+			return ""
+		}
+		obj = obj.DeepCopy()
+		unstructured.RemoveNestedField(obj.Object, "metadata", "resourceVersion")
+		unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+		buf, _ := json.MarshalIndent(obj.Object, "", "  ")
+		return string(buf)
+	}
+
+	dmp := diffmatchpatch.New()
+	liveChars, resultChars, lines := dmp.DiffLinesToChars(text(live), text(result))
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(liveChars, resultChars, false), lines)
+	return unifiedHunks(diffs, unifiedContext)
+}
+
 func stringListContains(list []string, value string) bool {
 	for _, item := range list {
 		if item == value {
@@ -182,18 +803,11 @@ func gcDelete(clientpool dynamic.ClientPool, disco discovery.DiscoveryInterface,
 	uid := obj.GetUID()
 	desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(disco, o), utils.FqName(obj))
 
-	deleteOpts := metav1.DeleteOptions{
-		Preconditions: &metav1.Preconditions{UID: &uid},
-	}
-	if version.Compare(1, 6) < 0 {
-		// 1.5.x option
-		boolFalse := false
-		deleteOpts.OrphanDependents = &boolFalse
-	} else {
-		// 1.6.x option (NB: Background is broken)
-		fg := metav1.DeletePropagationForeground
-		deleteOpts.PropagationPolicy = &fg
+	deleteOpts, err := deleteOptions(*version, metav1.DeletePropagationForeground)
+	if err != nil {
+		return err
 	}
+	deleteOpts.Preconditions = &metav1.Preconditions{UID: &uid}
 
 	c, err := utils.ClientForResource(clientpool, disco, o, metav1.NamespaceNone)
 	if err != nil {
@@ -213,8 +827,10 @@ func gcDelete(clientpool dynamic.ClientPool, disco discovery.DiscoveryInterface,
 	return nil
 }
 
-func walkObjects(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, listopts metav1.ListOptions, callback func(runtime.Object) error) error {
-	rsrclists, err := disco.ServerResources()
+func walkObjects(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, listopts metav1.ListOptions, skipConversions bool, callback func(runtime.Object) error) error {
+	// Only the preferred version of each resource, since the
+	// same objects are served by every version.
+	rsrclists, err := disco.ServerPreferredResources()
 	if err != nil {
 		return err
 	}
@@ -245,6 +861,18 @@ func walkObjects(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, li
 			rc := client.Resource(&rsrc, ns)
 			log.Debugf("Listing %s", gvk)
 			obj, err := rc.List(listopts)
+			if isConversionWebhookError(err) {
+				err = describeConversionError(pool, rsrc.Name, gvk, err)
+				if skipConversions {
+					log.Warnf("Skipping garbage collection of %s: %v", gvk, err)
+					continue
+				}
+			}
+			if errors.IsForbidden(err) {
+				// A single RBAC gap shouldn't stop the rest
+				log.Warnf("Skipping %s, which you are not allowed to list: %v", gvk, err)
+				continue
+			}
 			if err != nil {
 				return err
 			}
@@ -1,10 +1,21 @@
 package kubecfg
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
 
 	"github.com/ksonnet/kubecfg/utils"
 )
@@ -90,3 +101,579 @@ func TestEligibleForGc(t *testing.T) {
 		t.Errorf("%v should not be eligible (controller ownerref)", o)
 	}
 }
+
+func TestLatencySummary(t *testing.T) {
+	s := newLatencyStats()
+	if sum := s.summary(); sum.Count != 0 || sum.Max != 0 {
+		t.Errorf("Unexpected summary of no samples: %v", sum)
+	}
+
+	for i := 100; i >= 1; i-- {
+		s.record(time.Duration(i) * time.Millisecond)
+	}
+	sum := s.summary()
+	if sum.Count != 100 {
+		t.Errorf("Expected 100 samples, got %d", sum.Count)
+	}
+	if sum.Min != 1*time.Millisecond {
+		t.Errorf("Wrong min: %s", sum.Min)
+	}
+	if sum.Median != 50*time.Millisecond {
+		t.Errorf("Wrong median: %s", sum.Median)
+	}
+	if sum.P95 != 95*time.Millisecond {
+		t.Errorf("Wrong p95: %s", sum.P95)
+	}
+	if sum.Max != 100*time.Millisecond {
+		t.Errorf("Wrong max: %s", sum.Max)
+	}
+}
+
+func TestNewerAppliedVersion(t *testing.T) {
+	for _, tc := range []struct {
+		applied, running, expected string
+	}{
+		{applied: "", running: "v0.9.0", expected: ""},
+		{applied: "v0.9.0", running: "v0.9.0", expected: ""},
+		{applied: "v0.8.1", running: "v0.9.0", expected: ""},
+		{applied: "v0.10.0", running: "v0.9.0", expected: "v0.10.0"},
+		{applied: "v1.0.0-rc1", running: "v0.9.3", expected: "v1.0.0-rc1"},
+		{applied: "v0.9.1", running: "(dev build)", expected: ""},
+		{applied: "dev-2018-01-01", running: "v0.9.0", expected: ""},
+	} {
+		o := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		if tc.applied != "" {
+			utils.SetMetaDataAnnotation(o, AnnotationAppliedVersion, tc.applied)
+		}
+		if actual := newerAppliedVersion(o, tc.running); actual != tc.expected {
+			t.Errorf("applied %q running %q: expected %q, got %q", tc.applied, tc.running, tc.expected, actual)
+		}
+	}
+}
+
+func TestIsUnchanged(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"data":       map[string]interface{}{"a": "b"},
+			"replicas":   float64(3),
+		},
+	}
+	live := obj.DeepCopy()
+	live.SetUID("some-uid")
+	live.SetResourceVersion("42")
+	live.Object["replicas"] = int64(3)
+
+	if unchanged, err := isUnchanged(obj, live, utils.CompareFields{}); err != nil || !unchanged {
+		t.Errorf("Expected unchanged, got (%v, %v)", unchanged, err)
+	}
+
+	unstructured.SetNestedField(live.Object, "c", "data", "a")
+	if unchanged, err := isUnchanged(obj, live, utils.CompareFields{}); err != nil || unchanged {
+		t.Errorf("Expected changed, got (%v, %v)", unchanged, err)
+	}
+
+	// eg: --ignore-path data
+	if unchanged, err := isUnchanged(obj, live, utils.CompareFields{Exclude: []string{"data"}}); err != nil || !unchanged {
+		t.Errorf("Expected unchanged ignoring data, got (%v, %v)", unchanged, err)
+	}
+}
+
+func TestServerDryRunDiff(t *testing.T) {
+	live := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "foo", "resourceVersion": "41"},
+			"data":       map[string]interface{}{"a": "b"},
+		},
+	}
+	result := live.DeepCopy()
+	result.SetResourceVersion("42")
+	if text := serverDryRunDiff(live, result); text != "" {
+		t.Errorf("Expected no diff, got %q", text)
+	}
+
+	// eg: set by a mutating webhook
+	unstructured.SetNestedField(result.Object, "injected", "data", "c")
+	text := serverDryRunDiff(live, result)
+	if !strings.Contains(text, "+    \"c\": \"injected\"") || strings.Contains(text, "resourceVersion") {
+		t.Errorf("Unexpected diff %q", text)
+	}
+
+	if text := serverDryRunDiff(nil, result); !strings.HasPrefix(text, "@@ -0,0 ") {
+		t.Errorf("Unexpected diff for a new object %q", text)
+	}
+}
+
+func TestConversionWebhookError(t *testing.T) {
+	err := fmt.Errorf(`Internal error occurred: conversion webhook for example.com/v1, Kind=Widget failed: Post https://widgets.system.svc:443/convert: connection refused`)
+	if !isConversionWebhookError(err) {
+		t.Errorf("%v not recognised as a conversion webhook error", err)
+	}
+	if isConversionWebhookError(fmt.Errorf("Internal error occurred: etcdserver: request timed out")) {
+		t.Errorf("Unrelated error recognised as a conversion webhook error")
+	}
+	if isConversionWebhookError(nil) {
+		t.Errorf("nil recognised as a conversion webhook error")
+	}
+
+	crd := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"conversion": map[string]interface{}{
+					"strategy": "Webhook",
+					"webhookClientConfig": map[string]interface{}{
+						"service": map[string]interface{}{
+							"namespace": "system",
+							"name":      "widgets",
+						},
+					},
+				},
+			},
+		},
+	}
+	if w := conversionWebhookFor(crd); w != "service system/widgets" {
+		t.Errorf("Unexpected webhook %q", w)
+	}
+
+	crd.Object["spec"] = map[string]interface{}{
+		"conversion": map[string]interface{}{
+			"strategy": "Webhook",
+			"webhook": map[string]interface{}{
+				"clientConfig": map[string]interface{}{
+					"url": "https://example.com/convert",
+				},
+			},
+		},
+	}
+	if w := conversionWebhookFor(crd); w != "https://example.com/convert" {
+		t.Errorf("Unexpected webhook %q", w)
+	}
+}
+
+func TestIsCustomResourceDefinition(t *testing.T) {
+	for _, apiVersion := range []string{"apiextensions.k8s.io/v1beta1", "apiextensions.k8s.io/v1"} {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind("CustomResourceDefinition")
+		if !isCustomResourceDefinition(obj) {
+			t.Errorf("%s CustomResourceDefinition not recognised", apiVersion)
+		}
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("CustomResourceDefinition")
+	if isCustomResourceDefinition(obj) {
+		t.Errorf("CustomResourceDefinition in another group recognised")
+	}
+}
+
+// preferredDiscovery serves every fake resource as preferred, which
+// FakeDiscovery doesn't.
+type preferredDiscovery struct {
+	*fakedisco.FakeDiscovery
+}
+
+func (d preferredDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return d.Resources, nil
+}
+
+func TestWalkObjects(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		},
+	}
+	fake.AddReactor("list", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		list := &unstructured.UnstructuredList{}
+		for _, name := range []string{"a", "b"} {
+			obj := unstructured.Unstructured{}
+			obj.SetAPIVersion("v1")
+			obj.SetKind("ConfigMap")
+			obj.SetName(name)
+			list.Items = append(list.Items, obj)
+		}
+		return true, list, nil
+	})
+	fake.AddReactor("list", "secrets", func(action ktesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", fmt.Errorf("RBAC says no"))
+	})
+	disco := preferredDiscovery{&fakedisco.FakeDiscovery{Fake: fake}}
+
+	seen := []string{}
+	err := walkObjects(pool, disco, metav1.ListOptions{}, false, func(o runtime.Object) error {
+		seen = append(seen, o.(*unstructured.Unstructured).GetName())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("An unlistable kind stopped the walk: %v", err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("Unexpected objects %v", seen)
+	}
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	defer func(min time.Duration) { minConflictBackoff = min }(minConflictBackoff)
+	minConflictBackoff = time.Millisecond
+
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+	conflicts := 0
+	patches := 0
+	fake.AddReactor("patch", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if patches <= conflicts {
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "cm", fmt.Errorf("the object has been modified"))
+		}
+		if patches > conflicts+1 {
+			return true, nil, fmt.Errorf("unexpected patch after success")
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetName("cm")
+		obj.SetUID("1234")
+		return true, obj, nil
+	})
+
+	c := UpdateCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+		ConflictAttempts: 3,
+	}
+	objs := func() []*unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetName("cm")
+		return []*unstructured.Unstructured{obj}
+	}
+
+	conflicts, patches = 2, 0
+	if err := c.Run(objs()); err != nil {
+		t.Errorf("Expected success after 2 conflicts, got %v", err)
+	}
+	if patches != 3 {
+		t.Errorf("Expected 3 attempts, got %d", patches)
+	}
+
+	conflicts, patches = 5, 0
+	if err := c.Run(objs()); err == nil {
+		t.Errorf("Expected an error after 3 conflicts")
+	}
+	if patches != 3 {
+		t.Errorf("Expected 3 attempts, got %d", patches)
+	}
+
+	// Other errors aren't retried
+	fake.PrependReactor("patch", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		patches++
+		return true, nil, errors.NewBadRequest("nope")
+	})
+	patches = 0
+	if err := c.Run(objs()); err == nil || patches != 1 {
+		t.Errorf("Expected a single failed attempt, got %d: %v", patches, err)
+	}
+}
+
+// fakeApplier answers server-side apply requests, creating objects
+// it hasn't seen
+type fakeApplier struct {
+	seen map[string]bool
+	// calls, if set, records each request
+	calls *[]string
+}
+
+func (a *fakeApplier) Apply(obj *unstructured.Unstructured, defNs, user string, opts utils.ApplyOptions) (*unstructured.Unstructured, bool, error) {
+	if a.calls != nil {
+		*a.calls = append(*a.calls, "apply")
+	}
+	created := !a.seen[obj.GetName()]
+	a.seen[obj.GetName()] = true
+	return obj.DeepCopy(), created, nil
+}
+
+func TestServerSideApplyActions(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "services", Kind: "Service", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+	gets := 0
+	fake.AddReactor("get", "services", func(action ktesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "services"}, "svc")
+	})
+
+	var seen recordingObserver
+	c := UpdateCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+		Create:           true,
+		ServerSide:       &fakeApplier{seen: map[string]bool{}},
+		Observer:         &seen,
+	}
+	objs := func() []*unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Service")
+		obj.SetName("svc")
+		return []*unstructured.Unstructured{obj}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Run(objs()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Nothing is fetched, so the server says what happened
+	expected := recordingObserver{"Service /svc created <nil>", "Service /svc updated <nil>"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Expected %v, got %v", expected, seen)
+	}
+	if gets != 0 {
+		t.Errorf("Fetched objects %d times", gets)
+	}
+}
+
+func TestServerSideAdoptFromHelm(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "services", Kind: "Service", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+	fake.AddReactor("get", "services", func(action ktesting.Action) (bool, runtime.Object, error) {
+		live := &unstructured.Unstructured{}
+		live.SetAPIVersion("v1")
+		live.SetKind("Service")
+		live.SetName("svc")
+		live.SetNamespace("default")
+		live.SetLabels(map[string]string{helmLabelManagedBy: helmManagedByValue, "app": "web"})
+		live.SetAnnotations(map[string]string{helmAnnotationRelease: "web"})
+		return true, live, nil
+	})
+	var calls []string
+	fake.AddReactor("patch", "services", func(action ktesting.Action) (bool, runtime.Object, error) {
+		calls = append(calls, "patch "+string(action.(ktesting.PatchAction).GetPatch()))
+		return true, &unstructured.Unstructured{}, nil
+	})
+
+	c := UpdateCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+		Create:           true,
+		AdoptFromHelm:    true,
+		ServerSide:       &fakeApplier{seen: map[string]bool{"svc": true}, calls: &calls},
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Service")
+	obj.SetName("svc")
+	obj.SetLabels(map[string]string{"app": "web"})
+
+	if err := c.Run([]*unstructured.Unstructured{obj}); err != nil {
+		t.Fatal(err)
+	}
+	// Helm's metadata is removed, then kubecfg takes over the rest
+	expected := []string{
+		`patch {"metadata":{"annotations":{"meta.helm.sh/release-name":null},"labels":{"app.kubernetes.io/managed-by":null}}}`,
+		"apply",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected %q, got %q", expected, calls)
+	}
+}
+
+func TestUpdateReportsEarlyFailures(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+
+	var seen recordingObserver
+	c := UpdateCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+		Observer:         &seen,
+	}
+	// Rejected before any request is made
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Namespace")
+	obj.SetName("team")
+	obj.SetNamespace("other")
+
+	err := c.Run([]*unstructured.Unstructured{obj})
+	if err == nil || !strings.Contains(err.Error(), "cluster-scoped") {
+		t.Fatalf("Expected a cluster-scoped error, got %v", err)
+	}
+	if len(seen) != 1 || !strings.HasPrefix(seen[0], "Namespace other/team failed Error updating namespaces other.team") {
+		t.Errorf("Unexpected events %v", seen)
+	}
+}
+
+func TestUpdateUnservableKinds(t *testing.T) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+	patches := 0
+	fake.AddReactor("patch", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		patches++
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetName("cm")
+		return true, obj, nil
+	})
+
+	objs := func() []*unstructured.Unstructured {
+		var ret []*unstructured.Unstructured
+		for _, gvk := range []string{"v1/ConfigMap", "v1/Konfigmap", "example.com/v1/Widget"} {
+			i := strings.LastIndex(gvk, "/")
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(gvk[:i])
+			obj.SetKind(gvk[i+1:])
+			obj.SetName("cm")
+			ret = append(ret, obj)
+		}
+		return ret
+	}
+	c := UpdateCmd{
+		ClientPool:       pool,
+		Discovery:        &fakedisco.FakeDiscovery{Fake: fake},
+		DefaultNamespace: "default",
+	}
+
+	err := c.Run(objs())
+	if err == nil {
+		t.Fatal("Unservable kinds were accepted")
+	}
+	for _, kind := range []string{"Konfigmap", "Widget", "--skip-unknown"} {
+		if !strings.Contains(err.Error(), kind) {
+			t.Errorf("Error doesn't mention %s: %v", kind, err)
+		}
+	}
+	if patches != 0 {
+		t.Errorf("Patched %d objects before failing", patches)
+	}
+
+	c.SkipUnknown = true
+	if err := c.Run(objs()); err != nil {
+		t.Fatal(err)
+	}
+	if patches != 1 {
+		t.Errorf("Expected the ConfigMap to be patched, got %d patches", patches)
+	}
+}
+
+func TestConflictBackoff(t *testing.T) {
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, e := range expected {
+		if d := conflictBackoff(i + 1); d != e {
+			t.Errorf("Attempt %d: expected %s, got %s", i+1, e, d)
+		}
+	}
+	if d := conflictBackoff(20); d != maxConflictBackoff {
+		t.Errorf("Expected backoff capped at %s, got %s", maxConflictBackoff, d)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	objs := []*unstructured.Unstructured{}
+	for i := 0; i < 20; i++ {
+		obj := &unstructured.Unstructured{}
+		obj.SetName(fmt.Sprintf("obj%02d", i))
+		objs = append(objs, obj)
+	}
+
+	var lock sync.Mutex
+	running, maxRunning, calls := 0, 0, 0
+	fn := func(obj *unstructured.Unstructured) error {
+		lock.Lock()
+		calls++
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		if obj.GetName() == "obj03" || obj.GetName() == "obj07" {
+			return fmt.Errorf("%s failed", obj.GetName())
+		}
+		return nil
+	}
+
+	c := UpdateCmd{Parallelism: 4}
+	err := c.forEach(objs, fn)
+	if err == nil || !strings.Contains(err.Error(), "2 objects failed") ||
+		!strings.Contains(err.Error(), "obj03 failed") || !strings.Contains(err.Error(), "obj07 failed") {
+		t.Errorf("Expected both failures to be reported, got %v", err)
+	}
+	if calls != len(objs) {
+		t.Errorf("Expected every object to be attempted, got %d calls", calls)
+	}
+	if maxRunning > 4 {
+		t.Errorf("Parallelism exceeded: %d at once", maxRunning)
+	}
+
+	c = UpdateCmd{Parallelism: 1, FailFast: true}
+	calls = 0
+	if err := c.forEach(objs, fn); err == nil || err.Error() != "obj03 failed" {
+		t.Errorf("Expected the first failure, got %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("Expected to stop after the first failure, got %d calls", calls)
+	}
+}
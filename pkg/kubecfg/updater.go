@@ -0,0 +1,268 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+// Updater diffs and updates objects on a cluster, for programs that
+// embed kubecfg.  It behaves as the diff and update commands do, but
+// reads no flags or kubeconfig.
+type Updater struct {
+	ClientPool dynamic.ClientPool
+	Discovery  discovery.CachedDiscoveryInterface
+	// DefaultNamespace is where namespaced objects without a
+	// namespace go.  NewUpdater sets it to "default".
+	DefaultNamespace string
+	// DiffStrategy is "all" (the default) or "subset", as for
+	// the diff command
+	DiffStrategy string
+
+	conf *rest.Config
+}
+
+// NewUpdater returns an Updater for the cluster of conf, which is
+// not modified.
+func NewUpdater(conf *rest.Config) (*Updater, error) {
+	disco, err := discovery.NewDiscoveryClientForConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	discoCache := utils.NewMemcachedDiscoveryClient(disco, 0)
+	return &Updater{
+		ClientPool:       utils.NewClientPool(conf, discoCache),
+		Discovery:        discoCache,
+		DefaultNamespace: metav1.NamespaceDefault,
+		conf:             rest.CopyConfig(conf),
+	}, nil
+}
+
+// DiffResult is the outcome of comparing an object with the server
+type DiffResult struct {
+	DiffEntry
+	// Object is the object as given to Diff
+	Object *unstructured.Unstructured
+	// Live is the server's copy, or nil if there is none
+	Live *unstructured.Unstructured
+}
+
+// Diff compares objs with the server, in alphabetical order.  Unlike
+// the diff command, differences are not an error.
+func (u *Updater) Diff(ctx context.Context, objs []runtime.Object) ([]DiffResult, error) {
+	uobjs, err := toUnstructured(objs)
+	if err != nil {
+		return nil, err
+	}
+	c := DiffCmd{
+		ClientPool:       u.ClientPool,
+		Discovery:        u.Discovery,
+		DefaultNamespace: u.DefaultNamespace,
+		DiffStrategy:     u.DiffStrategy,
+	}
+	results, err := c.compare(ctx, uobjs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]DiffResult, len(results))
+	for i, r := range results {
+		ret[i] = DiffResult{DiffEntry: r.entry(), Object: r.obj, Live: r.live}
+	}
+	return ret, nil
+}
+
+// ApplyOptions are the options of Updater.Apply, which match those
+// of the update command.  The zero value creates and updates
+// objects, one at a time, without garbage collection.
+type ApplyOptions struct {
+	// NoCreate fails on objects missing from the server,
+	// rather than creating them
+	NoCreate bool
+	// SkipUnknown skips objects of kinds the server doesn't
+	// serve, rather than failing before anything is updated
+	SkipUnknown bool
+	// DryRun only reads from the server.  ServerDryRun sends
+	// each write as a server-side dry run.
+	DryRun       bool
+	ServerDryRun bool
+
+	// GcTag, if set, labels objects for garbage collection, and
+	// deletes those with the label that aren't in objs, unless
+	// SkipGc is set.
+	GcTag  string
+	SkipGc bool
+
+	// ServerSide uses server-side apply, owning fields as
+	// FieldManager (default "kubecfg")
+	ServerSide     bool
+	FieldManager   string
+	ForceConflicts bool
+
+	Parallelism int
+	FailFast    bool
+
+	// Wait waits for updated objects to become ready, for up to
+	// WaitTimeout (or forever, if zero)
+	Wait        bool
+	WaitTimeout time.Duration
+
+	// Observer, if set, is told as each object is finished with
+	Observer Observer
+}
+
+// ObjectError is an object that Updater.Apply failed to update
+type ObjectError struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e ObjectError) Error() string {
+	return e.Err.Error()
+}
+
+// ApplyError is returned by Updater.Apply when objects fail
+type ApplyError struct {
+	// Failed lists the objects that failed, in the order they did
+	Failed []ObjectError
+	// Err is the error the update command would report
+	Err error
+}
+
+func (e *ApplyError) Error() string {
+	return e.Err.Error()
+}
+
+// failureObserver records failed objects, and passes every event on
+// to next, if set.
+type failureObserver struct {
+	next   Observer
+	failed []ObjectError
+}
+
+func (o *failureObserver) OnObject(gvk schema.GroupVersionKind, namespace, name string, action Action, err error) {
+	if action == Failed {
+		o.failed = append(o.failed, ObjectError{GVK: gvk, Namespace: namespace, Name: name, Err: err})
+	}
+	if o.next != nil {
+		o.next.OnObject(gvk, namespace, name, action, err)
+	}
+}
+
+// Apply updates the server to match objs, as the update command
+// does.  If objects fail, the error is an *ApplyError listing them.
+// Once ctx is done, no more objects are started.
+func (u *Updater) Apply(ctx context.Context, objs []runtime.Object, opts ApplyOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	uobjs, err := toUnstructured(objs)
+	if err != nil {
+		return err
+	}
+
+	observer := &failureObserver{next: opts.Observer}
+	c := UpdateCmd{
+		ClientPool:       u.ClientPool,
+		Discovery:        u.Discovery,
+		DefaultNamespace: u.DefaultNamespace,
+		Create:           !opts.NoCreate,
+		SkipUnknown:      opts.SkipUnknown,
+		GcTag:            opts.GcTag,
+		SkipGc:           opts.SkipGc,
+		DryRun:           opts.DryRun,
+		ServerDryRun:     opts.ServerDryRun,
+		FieldManager:     opts.FieldManager,
+		ForceConflicts:   opts.ForceConflicts,
+		Parallelism:      opts.Parallelism,
+		FailFast:         opts.FailFast,
+		Wait:             opts.Wait,
+		WaitTimeout:      opts.WaitTimeout,
+		Observer:         observer,
+		ctx:              ctx,
+	}
+	if u.conf != nil {
+		conf := u.conf
+		if opts.ServerDryRun {
+			conf = rest.CopyConfig(u.conf)
+			utils.WithServerDryRun(conf)
+			c.ClientPool = utils.NewClientPool(conf, u.Discovery)
+		}
+		c.Impersonate = func(user string) (dynamic.ClientPool, error) {
+			imp := rest.CopyConfig(conf)
+			imp.Impersonate = rest.ImpersonationConfig{UserName: user}
+			return utils.NewClientPool(imp, u.Discovery), nil
+		}
+		if opts.ServerSide {
+			c.ServerSide = utils.NewApplier(conf, u.Discovery)
+		}
+	} else if opts.ServerDryRun || opts.ServerSide {
+		return fmt.Errorf("ServerDryRun and ServerSide need an Updater from NewUpdater")
+	}
+	if c.FieldManager == "" {
+		c.FieldManager = "kubecfg"
+	}
+
+	if err := c.Run(uobjs); err != nil {
+		if len(observer.failed) > 0 {
+			return &ApplyError{Failed: observer.failed, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// toUnstructured converts objs, which must have their apiVersion and
+// kind set, to copies as Unstructured.
+func toUnstructured(objs []runtime.Object) ([]*unstructured.Unstructured, error) {
+	ret := make([]*unstructured.Unstructured, len(objs))
+	for i, o := range objs {
+		if o.GetObjectKind().GroupVersionKind().Empty() {
+			return nil, fmt.Errorf("%T object has no apiVersion and kind", o)
+		}
+		if u, ok := o.(*unstructured.Unstructured); ok {
+			ret[i] = u.DeepCopy()
+			continue
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			return nil, err
+		}
+		// Typed objects always have a creationTimestamp, even
+		// if unset, which would show up in diffs
+		if m, ok := content["metadata"].(map[string]interface{}); ok {
+			if ts, found := m["creationTimestamp"]; found && ts == nil {
+				delete(m, "creationTimestamp")
+			}
+		}
+		ret[i] = &unstructured.Unstructured{Object: content}
+	}
+	return ret, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+func newFakeUpdater() (*Updater, *ktesting.Fake) {
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+				{Name: "namespaces", Kind: "Namespace", Verbs: []string{"get", "list", "patch"}},
+			},
+		},
+	}
+	u := &Updater{
+		ClientPool:       pool,
+		Discovery:        utils.NewMemcachedDiscoveryClient(&fakedisco.FakeDiscovery{Fake: fake}, 0),
+		DefaultNamespace: "default",
+	}
+	return u, fake
+}
+
+func configMap(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+		Data:       map[string]string{"a": data},
+	}
+}
+
+func TestUpdaterDiff(t *testing.T) {
+	u, fake := newFakeUpdater()
+	fake.AddReactor("get", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetName("cm")
+		obj.SetNamespace("default")
+		unstructured.SetNestedField(obj.Object, "old", "data", "a")
+		return true, obj, nil
+	})
+
+	results, err := u.Diff(context.Background(), []runtime.Object{configMap("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected one result, got %v", results)
+	}
+	r := results[0]
+	if r.Action != "updated" || r.Namespace != "default" || r.Live == nil || r.Object.GetName() != "cm" {
+		t.Errorf("Unexpected result %#v", r)
+	}
+
+	results, err = u.Diff(context.Background(), []runtime.Object{configMap("old")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Action != "unchanged" || results[0].Diff != "" {
+		t.Errorf("Unexpected result %#v", results[0])
+	}
+
+	if _, err := u.Diff(context.Background(), []runtime.Object{&corev1.ConfigMap{}}); err == nil {
+		t.Errorf("Object without a kind was accepted")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := u.Diff(ctx, []runtime.Object{configMap("new")}); err != context.Canceled {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+}
+
+func TestUpdaterApply(t *testing.T) {
+	u, fake := newFakeUpdater()
+	patches := 0
+	fake.AddReactor("patch", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		patches++
+		return true, nil, errors.NewBadRequest("nope")
+	})
+
+	cm := configMap("new")
+	err := u.Apply(context.Background(), []runtime.Object{cm}, ApplyOptions{GcTag: "tag", SkipGc: true})
+	aerr, ok := err.(*ApplyError)
+	if !ok {
+		t.Fatalf("Expected an ApplyError, got %#v", err)
+	}
+	if len(aerr.Failed) != 1 || aerr.Failed[0].Name != "cm" || aerr.Failed[0].GVK.Kind != "ConfigMap" || !strings.Contains(aerr.Failed[0].Err.Error(), "nope") {
+		t.Errorf("Unexpected failures %#v", aerr.Failed)
+	}
+	if patches != 1 {
+		t.Errorf("Expected one patch, got %d", patches)
+	}
+	if cm.Labels != nil {
+		t.Errorf("Apply modified its argument: %v", cm)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	patches = 0
+	if err := u.Apply(ctx, []runtime.Object{cm}, ApplyOptions{}); err != context.Canceled {
+		t.Errorf("Expected cancellation, got %v", err)
+	}
+	if patches != 0 {
+		t.Errorf("Cancelled Apply patched %d objects", patches)
+	}
+}
+
+func TestUpdaterApplyEarlyFailure(t *testing.T) {
+	u, _ := newFakeUpdater()
+	// Rejected before any request is made
+	ns := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: "team", Namespace: "other"},
+	}
+	err := u.Apply(context.Background(), []runtime.Object{ns}, ApplyOptions{})
+	aerr, ok := err.(*ApplyError)
+	if !ok {
+		t.Fatalf("Expected an ApplyError, got %#v", err)
+	}
+	if len(aerr.Failed) != 1 || aerr.Failed[0].Name != "team" || aerr.Failed[0].GVK.Kind != "Namespace" || !strings.Contains(aerr.Failed[0].Err.Error(), "cluster-scoped") {
+		t.Errorf("Unexpected failures %#v", aerr.Failed)
+	}
+}
@@ -34,6 +34,14 @@ import (
 type ValidateCmd struct {
 	Discovery     discovery.DiscoveryInterface
 	IgnoreUnknown bool
+	// WarningsAsErrors fails validation on any warning, such as
+	// a resource type with no schema.
+	WarningsAsErrors bool
+	// Offline validates against Discovery's OpenAPI document
+	// alone (see utils.NewOfflineDiscoveryClient), so kinds
+	// missing from it are unknown, rather than served without a
+	// schema.
+	Offline bool
 }
 
 func (c ValidateCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
@@ -65,19 +73,29 @@ func (c ValidateCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer)
 		gvk := obj.GroupVersionKind()
 
 		var allErrs []error
+		var warnings []string
 
 		schema, err := utils.NewOpenAPISchemaFor(c.Discovery, gvk)
 		if err != nil {
 			isNotFound := errors.IsNotFound(err) ||
 				strings.Contains(err.Error(), "is not supported by the server")
-			if isNotFound && (c.IgnoreUnknown || gvkExists(gvk)) {
-				log.Infof(" No schema found for %s, skipping validation", gvk)
-				continue
+			if isNotFound && c.Offline {
+				msg := fmt.Sprintf("Unknown kind %s: not found in schema", gvk)
+				if c.IgnoreUnknown {
+					warnings = append(warnings, msg+", skipping validation")
+				} else {
+					allErrs = append(allErrs, fmt.Errorf("%s", msg))
+				}
+			} else if isNotFound && (c.IgnoreUnknown || gvkExists(gvk)) {
+				warnings = append(warnings, fmt.Sprintf("No schema found for %s, skipping validation", gvk))
+			} else if isNotFound {
+				allErrs = append(allErrs, fmt.Errorf("Unknown kind %s: not served by the server", gvk))
+			} else {
+				allErrs = append(allErrs, fmt.Errorf("Unable to fetch schema: %v", err))
 			}
-			allErrs = append(allErrs, fmt.Errorf("Unable to fetch schema: %v", err))
 		} else {
 			// Validate obj
-			for _, err := range schema.Validate(obj) {
+			for _, err := range schema.ValidateFields(obj) {
 				allErrs = append(allErrs, err)
 			}
 		}
@@ -86,6 +104,14 @@ func (c ValidateCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer)
 			log.Errorf("Error in %s: %v", desc, err)
 			hasError = true
 		}
+		for _, w := range warnings {
+			if c.WarningsAsErrors {
+				log.Errorf("Error in %s: %s", desc, w)
+				hasError = true
+			} else {
+				log.Warnf("Warning in %s: %s", desc, w)
+			}
+		}
 	}
 
 	if hasError {
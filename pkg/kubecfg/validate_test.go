@@ -0,0 +1,102 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	ktesting "k8s.io/client-go/testing"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+func TestValidateWarningsAsErrors(t *testing.T) {
+	fake := &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+				},
+			},
+		},
+	}
+	objs := []*unstructured.Unstructured{
+		{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "foo"},
+		}},
+	}
+
+	// The fake server publishes no schemas, which is a warning
+	c := ValidateCmd{Discovery: &fakedisco.FakeDiscovery{Fake: fake}}
+	if err := c.Run(objs, ioutil.Discard); err != nil {
+		t.Errorf("Validation failed on a warning: %v", err)
+	}
+
+	c.WarningsAsErrors = true
+	if err := c.Run(objs, ioutil.Discard); err == nil {
+		t.Errorf("Validation succeeded despite a warning")
+	}
+}
+
+func TestValidateOffline(t *testing.T) {
+	doc, err := utils.ReadOpenAPIDocument(filepath.FromSlash("../../testdata/schema.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := func(apiVersion, kind string, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec":       spec,
+		}}
+	}
+	good := obj("v1", "Service", map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+	})
+	bad := obj("v1", "Service", map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": "eighty"}},
+	})
+	unknown := obj("example.com/v1", "Widget", map[string]interface{}{})
+
+	c := ValidateCmd{
+		Discovery: utils.NewOfflineDiscoveryClient(doc),
+		Offline:   true,
+	}
+	if err := c.Run([]*unstructured.Unstructured{good}, ioutil.Discard); err != nil {
+		t.Errorf("Valid object failed validation: %v", err)
+	}
+	if err := c.Run([]*unstructured.Unstructured{bad}, ioutil.Discard); err == nil {
+		t.Errorf("Invalid object passed validation")
+	}
+
+	c.IgnoreUnknown = true
+	if err := c.Run([]*unstructured.Unstructured{unknown}, ioutil.Discard); err != nil {
+		t.Errorf("Unknown kind failed validation despite IgnoreUnknown: %v", err)
+	}
+	c.IgnoreUnknown = false
+	if err := c.Run([]*unstructured.Unstructured{unknown}, ioutil.Discard); err == nil {
+		t.Errorf("Unknown kind passed validation")
+	}
+}
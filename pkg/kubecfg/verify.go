@@ -0,0 +1,187 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/ksonnet/kubecfg/utils"
+)
+
+// ErrVerifyFailed is returned when the cluster doesn't match config
+var ErrVerifyFailed = fmt.Errorf("Verification failed.")
+
+// VerifyCmd represents the verify subcommand
+type VerifyCmd struct {
+	ClientPool       dynamic.ClientPool
+	Discovery        discovery.DiscoveryInterface
+	DefaultNamespace string
+
+	// GcTag finds managed objects that are not in config, as
+	// update's garbage collection would.  Without it, only the
+	// objects in config are checked.
+	GcTag string
+	// Fields limits which fields of each kind are compared
+	Fields utils.CompareConfig
+	// OutputFormat is one of "text" (the default) or "json"
+	OutputFormat string
+}
+
+// VerifyReport is the outcome of verify
+type VerifyReport struct {
+	Passed   bool            `json:"passed"`
+	Matching []string        `json:"matching"`
+	Drifted  []DriftedObject `json:"drifted"`
+	Missing  []string        `json:"missing"`
+	// Extra are managed objects not in config, which update
+	// would garbage collect.
+	Extra []string `json:"extra"`
+}
+
+// DriftedObject is an object whose live state differs from config
+type DriftedObject struct {
+	Object string `json:"object"`
+	Diff   string `json:"diff"`
+}
+
+func (c VerifyCmd) Run(apiObjects []*unstructured.Unstructured, out io.Writer) error {
+	sort.Sort(utils.AlphabeticalOrder(apiObjects))
+
+	report := VerifyReport{
+		Matching: []string{},
+		Drifted:  []DriftedObject{},
+		Missing:  []string{},
+		Extra:    []string{},
+	}
+	seenUids := sets.NewString()
+
+	dmp := diffmatchpatch.New()
+	for _, obj := range apiObjects {
+		desc := fmt.Sprintf("%s %s", utils.ResourceNameFor(c.Discovery, obj), utils.FqName(obj))
+		log.Debug("Fetching ", desc)
+
+		client, err := utils.ClientForResource(c.ClientPool, c.Discovery, obj, c.DefaultNamespace)
+		if err != nil {
+			return err
+		}
+
+		live, err := client.Get(obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			report.Missing = append(report.Missing, desc)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Error fetching %s: %v", desc, err)
+		}
+		seenUids.Insert(string(live.GetUID()))
+
+		// Compare the fields in config, as with the "subset"
+		// diff strategy, so server-populated fields don't
+		// count as drift.
+		fields := c.Fields.For(obj.GroupVersionKind().GroupKind())
+		liveText, _ := json.MarshalIndent(filterFields(removeMapFields(obj.Object, live.Object, "", nil), "", fields), "", "  ")
+		objText, _ := json.MarshalIndent(filterFields(obj.Object, "", fields), "", "  ")
+		if string(liveText) == string(objText) {
+			report.Matching = append(report.Matching, desc)
+			continue
+		}
+
+		liveLines, objLines, lines := dmp.DiffLinesToChars(string(liveText), string(objText))
+		diff := dmp.DiffCharsToLines(dmp.DiffMain(liveLines, objLines, false), lines)
+		report.Drifted = append(report.Drifted, DriftedObject{
+			Object: desc,
+			Diff:   strings.TrimSuffix(DiffCmd{}.formatDiff(diff, false), "\n"),
+		})
+	}
+
+	if c.GcTag != "" {
+		err := walkObjects(c.ClientPool, c.Discovery, metav1.ListOptions{}, false, func(o runtime.Object) error {
+			m, err := meta.Accessor(o)
+			if err != nil {
+				return err
+			}
+			uid := string(m.GetUID())
+			if eligibleForGc(m, c.GcTag) && !seenUids.Has(uid) {
+				// Only report each object once, even if
+				// listed under several GroupVersions
+				seenUids.Insert(uid)
+				gvk := o.GetObjectKind().GroupVersionKind()
+				report.Extra = append(report.Extra, fmt.Sprintf("%s %s (%s)", utils.ResourceNameFor(c.Discovery, o), utils.FqName(m), gvk.GroupVersion()))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Strings(report.Extra)
+	}
+
+	report.Passed = len(report.Drifted) == 0 && len(report.Missing) == 0 && len(report.Extra) == 0
+
+	var err error
+	switch c.OutputFormat {
+	case "", "text":
+		err = writeVerifyText(report, out)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	default:
+		return fmt.Errorf("Unknown --output: %s", c.OutputFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !report.Passed {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+func writeVerifyText(report VerifyReport, out io.Writer) error {
+	for _, d := range report.Drifted {
+		fmt.Fprintf(out, "---\n- drifted %s\n%s\n", d.Object, d.Diff)
+	}
+	for _, m := range report.Missing {
+		fmt.Fprintf(out, "- missing %s\n", m)
+	}
+	for _, e := range report.Extra {
+		fmt.Fprintf(out, "- extra %s\n", e)
+	}
+
+	result := "PASSED"
+	if !report.Passed {
+		result = "FAILED"
+	}
+	_, err := fmt.Fprintf(out, "%s: %d matching, %d drifted, %d missing, %d extra\n",
+		result, len(report.Matching), len(report.Drifted), len(report.Missing), len(report.Extra))
+	return err
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestVerify(t *testing.T) {
+	configMap := func(name, value string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "ns"},
+			"data":       map[string]interface{}{"key": value},
+		}}
+	}
+	onServer := func(obj *unstructured.Unstructured) *unstructured.Unstructured {
+		ret := obj.DeepCopy()
+		ret.SetUID(types.UID("uid-" + obj.GetName()))
+		ret.SetResourceVersion("1")
+		ret.SetAnnotations(map[string]string{AnnotationGcTag: "mytag"})
+		return ret
+	}
+
+	live := map[string]*unstructured.Unstructured{
+		"same":  onServer(configMap("same", "a")),
+		"drift": onServer(configMap("drift", "old")),
+		"extra": onServer(configMap("extra", "a")),
+	}
+
+	pool := &fakedynamic.FakeClientPool{}
+	fake := &pool.Fake
+	fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list"}},
+			},
+		},
+	}
+	fake.AddReactor("get", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		name := action.(ktesting.GetAction).GetName()
+		if obj, ok := live[name]; ok {
+			return true, obj, nil
+		}
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	})
+	fake.AddReactor("list", "configmaps", func(action ktesting.Action) (bool, runtime.Object, error) {
+		list := &unstructured.UnstructuredList{}
+		for _, obj := range live {
+			list.Items = append(list.Items, *obj)
+		}
+		return true, list, nil
+	})
+
+	c := VerifyCmd{
+		ClientPool:   pool,
+		Discovery:    preferredDiscovery{&fakedisco.FakeDiscovery{Fake: fake}},
+		GcTag:        "mytag",
+		OutputFormat: "json",
+	}
+	objs := []*unstructured.Unstructured{
+		configMap("same", "a"),
+		configMap("drift", "new"),
+		configMap("missing", "a"),
+	}
+
+	var out bytes.Buffer
+	if err := c.Run(objs, &out); err != ErrVerifyFailed {
+		t.Errorf("Expected ErrVerifyFailed, got %v", err)
+	}
+
+	var report VerifyReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Error parsing report %q: %v", out.String(), err)
+	}
+	if report.Passed {
+		t.Errorf("Report passed")
+	}
+	if !reflect.DeepEqual(report.Matching, []string{"configmaps ns.same"}) {
+		t.Errorf("Unexpected matching %v", report.Matching)
+	}
+	if len(report.Drifted) != 1 || report.Drifted[0].Object != "configmaps ns.drift" {
+		t.Errorf("Unexpected drifted %v", report.Drifted)
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"configmaps ns.missing"}) {
+		t.Errorf("Unexpected missing %v", report.Missing)
+	}
+	if !reflect.DeepEqual(report.Extra, []string{"configmaps ns.extra (v1)"}) {
+		t.Errorf("Unexpected extra %v", report.Extra)
+	}
+
+	// Exactly matching config passes
+	delete(live, "drift")
+	delete(live, "extra")
+	out.Reset()
+	if err := c.Run([]*unstructured.Unstructured{configMap("same", "a")}, &out); err != nil {
+		t.Errorf("Verify failed: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// readinessCheck reports whether obj (the server's copy) is ready,
+// and if not, why.  A non-nil error means it never will be.
+type readinessCheck func(obj *unstructured.Unstructured) (bool, string, error)
+
+// readinessChecks are the kind-specific readiness tests.  Other
+// kinds are ready once any Ready condition is True.
+var readinessChecks = map[schema.GroupKind]readinessCheck{
+	{Group: "apps", Kind: "Deployment"}:       deploymentReady,
+	{Group: "extensions", Kind: "Deployment"}: deploymentReady,
+	{Group: "apps", Kind: "StatefulSet"}:      statefulSetReady,
+	{Group: "batch", Kind: "Job"}:             jobComplete,
+}
+
+func readinessCheckFor(gk schema.GroupKind) readinessCheck {
+	if check, ok := readinessChecks[gk]; ok {
+		return check
+	}
+	return conditionReady
+}
+
+// observed is false until the controller has seen obj's latest spec
+func observed(obj *unstructured.Unstructured) bool {
+	gen, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	return !found || gen >= obj.GetGeneration()
+}
+
+// desiredReplicas returns spec.replicas, which defaults to 1
+func desiredReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	v, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return v
+}
+
+func deploymentReady(obj *unstructured.Unstructured) (bool, string, error) {
+	if !observed(obj) {
+		return false, "waiting for rollout to start", nil
+	}
+	desired := desiredReplicas(obj)
+	if updated := statusInt(obj, "updatedReplicas"); updated < desired {
+		return false, fmt.Sprintf("%d of %d replicas updated", updated, desired), nil
+	}
+	if replicas := statusInt(obj, "replicas"); replicas > desired {
+		return false, fmt.Sprintf("%d old replicas pending termination", replicas-desired), nil
+	}
+	if available := statusInt(obj, "availableReplicas"); available < desired {
+		return false, fmt.Sprintf("%d of %d replicas available", available, desired), nil
+	}
+	return true, "", nil
+}
+
+func statefulSetReady(obj *unstructured.Unstructured) (bool, string, error) {
+	if !observed(obj) {
+		return false, "waiting for rollout to start", nil
+	}
+	desired := desiredReplicas(obj)
+	if ready := statusInt(obj, "readyReplicas"); ready < desired {
+		return false, fmt.Sprintf("%d of %d replicas ready", ready, desired), nil
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if update != "" && current != update {
+		return false, fmt.Sprintf("%d of %d replicas updated", statusInt(obj, "updatedReplicas"), desired), nil
+	}
+	return true, "", nil
+}
+
+func jobComplete(obj *unstructured.Unstructured) (bool, string, error) {
+	if status, msg := condition(obj, "Failed"); status == "True" {
+		return false, "", fmt.Errorf("job failed: %s", msg)
+	}
+	if status, _ := condition(obj, "Complete"); status == "True" {
+		return true, "", nil
+	}
+	return false, fmt.Sprintf("%d pods succeeded", statusInt(obj, "succeeded")), nil
+}
+
+func conditionReady(obj *unstructured.Unstructured) (bool, string, error) {
+	status, msg := condition(obj, "Ready")
+	switch status {
+	case "", "True":
+		// Kinds without a Ready condition have nothing to wait for
+		return true, "", nil
+	}
+	if msg == "" {
+		msg = "not ready"
+	}
+	return false, msg, nil
+}
+
+// condition returns the status and message of obj's condition of
+// type condType, if any.
+func condition(obj *unstructured.Unstructured, condType string) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != condType {
+			continue
+		}
+		status, _ := cond["status"].(string)
+		msg, _ := cond["message"].(string)
+		if msg == "" {
+			msg, _ = cond["reason"].(string)
+		}
+		return status, msg
+	}
+	return "", ""
+}
+
+// waitItem is an updated (or deleted) object to wait for
+type waitItem struct {
+	desc string
+	name string
+	rc   dynamic.ResourceInterface
+}
+
+// waitPollInterval is how often waitForReady checks objects.  A
+// variable for tests.
+var waitPollInterval = 2 * time.Second
+
+// waitDeadline returns the deadline for a wait of up to timeout, or
+// the zero time (no deadline) if timeout is zero.
+func waitDeadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// waitForReady polls items until every one is ready, or timeout (if
+// non-zero) passes.  The error lists those that never became ready.
+func waitForReady(items []waitItem, timeout time.Duration) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if timeout > 0 {
+		log.Infof("Waiting up to %s for %d objects to become ready", timeout, len(items))
+	} else {
+		log.Infof("Waiting for %d objects to become ready", len(items))
+	}
+
+	pending, err := pollItems(items, waitDeadline(timeout), func(item waitItem) (bool, string, error) {
+		obj, err := item.rc.Get(item.name, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("Error fetching %s: %v", item.desc, err)
+			return false, err.Error(), nil
+		}
+		ready, reason, err := readinessCheckFor(obj.GroupVersionKind().GroupKind())(obj)
+		if err != nil {
+			return false, "", fmt.Errorf("%s will never become ready: %v", item.desc, err)
+		}
+		if ready {
+			log.Infof(" %s is ready", item.desc)
+		}
+		return ready, reason, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("Timed out after %s waiting for %d objects to become ready:\n  %s", timeout, len(pending), strings.Join(pending, "\n  "))
+	}
+	return nil
+}
+
+// waitForDeletion polls items until none exist, or deadline (if not
+// zero) passes.  The error lists those that still exist.
+func waitForDeletion(items []waitItem, deadline time.Time) error {
+	if len(items) == 0 {
+		return nil
+	}
+	log.Infof("Waiting for %d objects to be deleted", len(items))
+
+	pending, err := pollItems(items, deadline, func(item waitItem) (bool, string, error) {
+		obj, err := item.rc.Get(item.name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			log.Infof(" %s is gone", item.desc)
+			return true, "", nil
+		} else if err != nil {
+			log.Debugf("Error fetching %s: %v", item.desc, err)
+			return false, err.Error(), nil
+		}
+		if obj.GetDeletionTimestamp() == nil {
+			return false, "not yet deleted", nil
+		}
+		if finalizers := obj.GetFinalizers(); len(finalizers) > 0 {
+			return false, "waiting for finalizers " + strings.Join(finalizers, ", "), nil
+		}
+		return false, "terminating", nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("Timed out waiting for %d objects to be deleted:\n  %s", len(pending), strings.Join(pending, "\n  "))
+	}
+	return nil
+}
+
+// pollItems calls check on each of items every waitPollInterval,
+// until check reports every one done, or deadline (if not zero)
+// passes.  It returns the items that aren't done, with check's
+// reasons, sorted.
+func pollItems(items []waitItem, deadline time.Time, check func(waitItem) (bool, string, error)) ([]string, error) {
+	pending := items
+	reasons := map[string]string{}
+	for {
+		var next []waitItem
+		for _, item := range pending {
+			done, reason, err := check(item)
+			if err != nil {
+				return nil, err
+			}
+			if !done {
+				reasons[item.desc] = reason
+				next = append(next, item)
+			}
+		}
+		pending = next
+
+		if len(pending) == 0 {
+			return nil, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(waitPollInterval)
+	}
+
+	ret := make([]string, len(pending))
+	for i, item := range pending {
+		ret[i] = fmt.Sprintf("%s (%s)", item.desc, reasons[item.desc])
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
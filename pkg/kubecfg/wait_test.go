@@ -0,0 +1,160 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package kubecfg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func statusObject(apiVersion, kind string, generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":       "myobj",
+				"generation": generation,
+			},
+			"spec":   spec,
+			"status": status,
+		},
+	}
+}
+
+func readyCondition(condType, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": condType, "status": status, "message": "some message"},
+		},
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	tests := []struct {
+		obj    *unstructured.Unstructured
+		ready  bool
+		reason string
+		err    bool
+	}{
+		{
+			obj: statusObject("apps/v1", "Deployment", 2,
+				map[string]interface{}{"replicas": int64(3)},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(3), "availableReplicas": int64(3), "replicas": int64(3)}),
+			reason: "waiting for rollout to start",
+		},
+		{
+			obj: statusObject("apps/v1", "Deployment", 2,
+				map[string]interface{}{"replicas": int64(3)},
+				map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(3), "availableReplicas": int64(2), "replicas": int64(3)}),
+			reason: "2 of 3 replicas available",
+		},
+		{
+			// spec.replicas defaults to 1
+			obj: statusObject("extensions/v1beta1", "Deployment", 1,
+				map[string]interface{}{},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(1), "availableReplicas": int64(1), "replicas": int64(1)}),
+			ready: true,
+		},
+		{
+			obj: statusObject("apps/v1", "StatefulSet", 1,
+				map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(2), "updatedReplicas": int64(1), "currentRevision": "a", "updateRevision": "b"}),
+			reason: "1 of 2 replicas updated",
+		},
+		{
+			obj: statusObject("apps/v1", "StatefulSet", 1,
+				map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(2), "currentRevision": "b", "updateRevision": "b"}),
+			ready: true,
+		},
+		{
+			obj:   statusObject("batch/v1", "Job", 1, map[string]interface{}{}, readyCondition("Complete", "True")),
+			ready: true,
+		},
+		{
+			obj: statusObject("batch/v1", "Job", 1, map[string]interface{}{}, readyCondition("Failed", "True")),
+			err: true,
+		},
+		{
+			obj:    statusObject("example.com/v1", "Widget", 1, map[string]interface{}{}, readyCondition("Ready", "False")),
+			reason: "some message",
+		},
+		{
+			obj:   statusObject("example.com/v1", "Widget", 1, map[string]interface{}{}, readyCondition("Ready", "True")),
+			ready: true,
+		},
+		{
+			// Nothing to wait for
+			obj:   statusObject("v1", "ConfigMap", 1, map[string]interface{}{}, map[string]interface{}{}),
+			ready: true,
+		},
+	}
+
+	for i, test := range tests {
+		check := readinessCheckFor(test.obj.GroupVersionKind().GroupKind())
+		ready, reason, err := check(test.obj)
+		if (err != nil) != test.err {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+		if ready != test.ready || reason != test.reason {
+			t.Errorf("%d: got (%v, %q), expected (%v, %q)", i, ready, reason, test.ready, test.reason)
+		}
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	oldInterval := waitPollInterval
+	waitPollInterval = time.Millisecond
+	defer func() { waitPollInterval = oldInterval }()
+
+	fake := &ktesting.Fake{}
+	gets := 0
+	fake.AddReactor("get", "widgets", func(action ktesting.Action) (bool, runtime.Object, error) {
+		gets++
+		status := "False"
+		if action.(ktesting.GetAction).GetName() == "becomes-ready" && gets > 2 {
+			status = "True"
+		}
+		obj := statusObject("example.com/v1", "Widget", 1, map[string]interface{}{}, readyCondition("Ready", status))
+		return true, obj, nil
+	})
+	rc := &fakedynamic.FakeResourceClient{
+		Resource: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"},
+		Fake:     fake,
+	}
+
+	items := []waitItem{{desc: "widgets becomes-ready", name: "becomes-ready", rc: rc}}
+	if err := waitForReady(items, time.Minute); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	items = append(items, waitItem{desc: "widgets never-ready", name: "never-ready", rc: rc})
+	err := waitForReady(items, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("Expected a timeout")
+	}
+	if !strings.Contains(err.Error(), "1 objects to become ready:\n  widgets never-ready (some message)") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -170,12 +170,16 @@ func jsonnetReader(vm *jsonnet.VM, path string) ([]runtime.Object, error) {
 
 	log.Debugf("jsonnet result is: %s", jsonstr)
 
+	return jsonnetObjects(&walkContext{label: "<top>"}, jsonstr)
+}
+
+func jsonnetObjects(ctx *walkContext, jsonstr string) ([]runtime.Object, error) {
 	var top interface{}
-	if err = json.Unmarshal([]byte(jsonstr), &top); err != nil {
+	if err := json.Unmarshal([]byte(jsonstr), &top); err != nil {
 		return nil, err
 	}
 
-	objs, err := jsonWalk(&walkContext{label: "<top>"}, top)
+	objs, err := jsonWalk(ctx, top)
 	if err != nil {
 		return nil, err
 	}
@@ -205,22 +209,114 @@ func jsonnetReader(vm *jsonnet.VM, path string) ([]runtime.Object, error) {
 	return ret, nil
 }
 
-// FlattenToV1 expands any List-type objects into their members, and
-// cooerces everything to v1.Unstructured.  Panics if coercion
-// encounters an unexpected object type.
-func FlattenToV1(objs []runtime.Object) []*unstructured.Unstructured {
+// RenderError records a file, or a top-level entry within a jsonnet
+// file, that failed to render.
+type RenderError struct {
+	Path string
+	// Entry is the failed top-level field, or empty if the whole
+	// file failed.
+	Entry string
+	Err   error
+}
+
+func (e RenderError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s (entry %q): %v", e.Path, e.Entry, e.Err)
+}
+
+// ReadBestEffort is like Read, but if a jsonnet file whose top level
+// is an object fails to evaluate, each top-level field is evaluated
+// separately.  It returns the objects that rendered, along with
+// errors for the entries (or whole files) that didn't.
+func ReadBestEffort(vm *jsonnet.VM, path string) ([]runtime.Object, []RenderError) {
+	objs, err := Read(vm, path)
+	if err == nil {
+		return objs, nil
+	}
+	failed := []RenderError{{Path: path, Err: err}}
+	if filepath.Ext(path) != ".jsonnet" {
+		return nil, failed
+	}
+
+	abs, aerr := filepath.Abs(path)
+	if aerr != nil {
+		return nil, failed
+	}
+	pathUrl := &url.URL{Scheme: "file", Path: abs}
+	bytes, rerr := ioutil.ReadFile(path)
+	if rerr != nil {
+		return nil, failed
+	}
+
+	// A jsonnet file is a single expression, so it can be
+	// wrapped.  Keep the source on its original lines, so error
+	// locations still make sense.
+	source := string(bytes)
+	fieldsJson, ferr := vm.EvaluateSnippet(pathUrl.String(), "std.objectFields(("+source+"\n))")
+	if ferr != nil {
+		return nil, failed
+	}
+	var fields []string
+	if err := json.Unmarshal([]byte(fieldsJson), &fields); err != nil {
+		return nil, failed
+	}
+
+	failed = nil
+	for _, field := range fields {
+		jsonstr, err := vm.EvaluateSnippet(pathUrl.String(), fmt.Sprintf("((%s\n))[%q]", source, field))
+		if err == nil {
+			var entryObjs []runtime.Object
+			entryObjs, err = jsonnetObjects(&walkContext{label: "<top>." + field}, jsonstr)
+			objs = append(objs, entryObjs...)
+		}
+		if err != nil {
+			failed = append(failed, RenderError{Path: path, Entry: field, Err: err})
+		}
+	}
+	return objs, failed
+}
+
+// FlattenToV1 expands any List-type objects (recursively) into their
+// members, preserving order, and cooerces everything to
+// v1.Unstructured.  Panics if coercion encounters an unexpected
+// object type.
+func FlattenToV1(objs []runtime.Object) ([]*unstructured.Unstructured, error) {
 	ret := make([]*unstructured.Unstructured, 0, len(objs))
 	for _, obj := range objs {
+		var err error
 		switch o := obj.(type) {
 		case *unstructured.UnstructuredList:
 			for i := range o.Items {
-				ret = append(ret, &o.Items[i])
+				ret, err = appendFlattened(ret, &o.Items[i])
+				if err != nil {
+					return nil, err
+				}
 			}
 		case *unstructured.Unstructured:
-			ret = append(ret, o)
+			ret, err = appendFlattened(ret, o)
+			if err != nil {
+				return nil, err
+			}
 		default:
 			panic("Unexpected unstructured object type")
 		}
 	}
-	return ret
+	return ret, nil
+}
+
+func appendFlattened(ret []*unstructured.Unstructured, obj *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if !obj.IsList() {
+		return append(ret, obj), nil
+	}
+	err := obj.EachListItem(func(item runtime.Object) error {
+		var err error
+		ret, err = appendFlattened(ret, item.(*unstructured.Unstructured))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error expanding %s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	return ret, nil
 }
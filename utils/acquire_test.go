@@ -17,9 +17,16 @@ package utils
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func TestJsonWalk(t *testing.T) {
@@ -105,3 +112,94 @@ func TestJsonWalk(t *testing.T) {
 		}
 	}
 }
+
+func TestFlattenToV1(t *testing.T) {
+	obj := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name},
+		}
+	}
+	list := func(items ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"items":      items,
+		}
+	}
+
+	input := []runtime.Object{
+		&unstructured.Unstructured{Object: obj("a")},
+		&unstructured.Unstructured{Object: list(obj("b"), list(obj("c"), list(obj("d"))), obj("e"))},
+		&unstructured.UnstructuredList{
+			Items: []unstructured.Unstructured{
+				{Object: list(obj("f"))},
+				{Object: obj("g")},
+			},
+		},
+	}
+
+	objs, err := FlattenToV1(input)
+	if err != nil {
+		t.Fatalf("FlattenToV1 failed: %v", err)
+	}
+	names := []string{}
+	for _, o := range objs {
+		names = append(names, o.GetName())
+	}
+	expected := []string{"a", "b", "c", "d", "e", "f", "g"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	bad := &unstructured.Unstructured{Object: list(list(42.0))}
+	if _, err := FlattenToV1([]runtime.Object{bad}); err == nil {
+		t.Errorf("FlattenToV1 succeeded on a List of non-objects")
+	}
+}
+
+func TestReadBestEffort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubecfg-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	entries := write("entries.jsonnet", `
+local cm(name) = {apiVersion: "v1", kind: "ConfigMap", metadata: {name: name}};
+{
+  good: cm("good"),
+  bad: error "broken",
+  list: [cm("a"), cm("b")],
+}
+`)
+	broken := write("broken.jsonnet", `{`)
+
+	vm := jsonnet.MakeVM()
+
+	objs, failed := ReadBestEffort(vm, entries)
+	names := []string{}
+	for _, o := range objs {
+		names = append(names, o.(*unstructured.Unstructured).GetName())
+	}
+	sort.Strings(names)
+	if expected := []string{"a", "b", "good"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	if len(failed) != 1 || failed[0].Entry != "bad" {
+		t.Errorf("Expected only entry bad to fail, got %v", failed)
+	}
+
+	objs, failed = ReadBestEffort(vm, broken)
+	if len(objs) != 0 || len(failed) != 1 || failed[0].Entry != "" {
+		t.Errorf("Expected the whole file to fail, got %v, %v", objs, failed)
+	}
+}
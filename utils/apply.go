@@ -0,0 +1,140 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// ApplyPatchType is the content type of a server-side apply
+// request.  The body is the complete desired object, as YAML or JSON.
+const ApplyPatchType types.PatchType = "application/apply-patch+yaml"
+
+// ApplyOptions control a server-side apply request.
+type ApplyOptions struct {
+	// FieldManager names the owner of the applied fields
+	FieldManager string
+	// Force takes ownership of fields owned by other managers,
+	// rather than failing with a conflict
+	Force bool
+}
+
+// Applier sends server-side apply requests.  The vendored dynamic
+// client can't, since it has no way to pass query parameters to
+// Patch.
+type Applier struct {
+	conf  *rest.Config
+	disco discovery.DiscoveryInterface
+}
+
+// NewApplier creates an Applier for the server described by conf.
+func NewApplier(conf *rest.Config, disco discovery.DiscoveryInterface) *Applier {
+	return &Applier{conf: conf, disco: disco}
+}
+
+// Apply creates or updates obj with a server-side apply request, as
+// user if non-empty, and returns the server's copy.  created reports
+// whether the server created the object, rather than updating it.
+func (a *Applier) Apply(obj *unstructured.Unstructured, defNs, user string, opts ApplyOptions) (result *unstructured.Unstructured, created bool, err error) {
+	gvk := obj.GroupVersionKind()
+	resource, err := serverResourceForGroupVersionKind(a.disco, gvk)
+	if err != nil {
+		return nil, false, err
+	}
+	namespace, err := resourceNamespace(resource, obj, defNs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	gv := gvk.GroupVersion()
+	conf := *a.conf
+	conf.ContentConfig = dynamic.ContentConfig()
+	conf.GroupVersion = &gv
+	conf.APIPath = dynamic.LegacyAPIPathResolverFunc(gvk)
+	if conf.UserAgent == "" {
+		conf.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	if user != "" {
+		conf.Impersonate = rest.ImpersonationConfig{UserName: user}
+	}
+	client, err := rest.RESTClientFor(&conf)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req := client.Patch(ApplyPatchType).
+		NamespaceIfScoped(namespace, resource.Namespaced).
+		Resource(resource.Name).
+		Name(obj.GetName()).
+		Param("fieldManager", opts.FieldManager).
+		Body(data)
+	if opts.Force {
+		req = req.Param("force", "true")
+	}
+	log.Debugf("Applying %s %s namespace=%s as %s", resource.Name, obj.GetName(), namespace, opts.FieldManager)
+
+	result = &unstructured.Unstructured{}
+	if err := req.Do().WasCreated(&created).Into(result); err != nil {
+		return nil, false, applyError(err)
+	}
+	return result, created, nil
+}
+
+// applyError explains errors specific to server-side apply.
+func applyError(err error) error {
+	switch {
+	case errors.IsConflict(err):
+		if managers := conflictingManagers(err); len(managers) > 0 {
+			return fmt.Errorf("%v.  Fields are owned by other managers: %s.  Rerun with --force-conflicts to take ownership", err, strings.Join(managers, ", "))
+		}
+	case errors.IsUnsupportedMediaType(err):
+		return fmt.Errorf("%v.  The server does not support server-side apply, which needs Kubernetes 1.16 or later.  Rerun without --server-side", err)
+	}
+	return err
+}
+
+// conflictingManagers lists the field conflicts reported in err, in
+// the server's words (eg: `conflict with "hpa": .spec.replicas`).
+func conflictingManagers(err error) []string {
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil
+	}
+	ret := []string{}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseType("FieldManagerConflict") {
+			continue
+		}
+		ret = append(ret, cause.Message)
+	}
+	return ret
+}
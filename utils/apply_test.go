@@ -0,0 +1,90 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func TestApply(t *testing.T) {
+	var status int
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/apis/apps/v1/namespaces/myns/deployments/web" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != string(ApplyPatchType) {
+			t.Errorf("Unexpected content type %s", ct)
+		}
+		if q := r.URL.Query(); q.Get("fieldManager") != "kubecfg" || q.Get("force") != "" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"name":"web"`) {
+			t.Errorf("Unexpected body %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	a := NewApplier(&rest.Config{Host: srv.URL}, newFakeDiscovery())
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetName("web")
+	opts := ApplyOptions{FieldManager: "kubecfg"}
+
+	status = http.StatusOK
+	response = `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "myns", "uid": "1234"}}`
+	result, created, err := a.Apply(obj, "myns", "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetUID() != "1234" || created {
+		t.Errorf("Unexpected result %v (created %v)", result, created)
+	}
+
+	status = http.StatusCreated
+	if _, created, err = a.Apply(obj, "myns", "", opts); err != nil || !created {
+		t.Errorf("Expected the object to be created, got %v", err)
+	}
+
+	status = http.StatusConflict
+	response = `{"apiVersion": "v1", "kind": "Status", "status": "Failure", "reason": "Conflict", "code": 409,
+		"message": "Apply failed with 1 conflict: conflict with \"hpa\": .spec.replicas",
+		"details": {"causes": [{"reason": "FieldManagerConflict", "message": "conflict with \"hpa\": .spec.replicas", "field": ".spec.replicas"}]}}`
+	_, _, err = a.Apply(obj, "myns", "", opts)
+	if err == nil || !strings.Contains(err.Error(), `owned by other managers: conflict with "hpa": .spec.replicas`) {
+		t.Errorf("Unexpected conflict error %v", err)
+	}
+
+	status = http.StatusUnsupportedMediaType
+	response = `{"apiVersion": "v1", "kind": "Status", "status": "Failure", "reason": "UnsupportedMediaType", "code": 415,
+		"message": "the body of the request was in an unknown format"}`
+	_, _, err = a.Apply(obj, "myns", "", opts)
+	if err == nil || !strings.Contains(err.Error(), "does not support server-side apply") {
+		t.Errorf("Unexpected error from an old server %v", err)
+	}
+}
@@ -68,7 +68,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _libKubecfgLibsonnet = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x55\x51\x8f\xdb\x36\x13\x7c\xf7\xaf\x18\x18\xdf\x83\x1d\x28\x56\x12\x7c\x40\x01\x17\x01\xea\x26\x29\xea\xf4\x62\xa3\xf6\xa5\xc1\xbd\x79\x4d\xad\x24\xe6\x28\x52\x25\x29\xfb\x8c\xa2\xff\xbd\x20\x25\x9d\xe5\xf3\x1d\x10\xe0\x20\x9c\xb9\xbb\xc3\x99\xd9\xd5\x2a\x4d\xf1\xc1\xd4\x27\x2b\x8b\xd2\xe3\xdd\x9b\xb7\x3f\xe1\xb6\x64\xdc\x37\x7b\x16\x79\x01\x6a\x7c\x69\xac\x1b\xa5\x69\xfb\x07\x00\x37\x52\xb0\x76\x9c\xa1\xd1\x19\x5b\xf8\x92\xb1\xa8\x49\x94\xdc\x47\x12\xfc\xc5\xd6\x49\xa3\xf1\x6e\xf6\x06\x93\x90\x30\xee\x42\xe3\xe9\xcf\x1d\xca\xc9\x34\xa8\xe8\x04\x6d\x3c\x1a\xc7\xf0\xa5\x74\xc8\xa5\x62\xf0\x83\xe0\xda\x43\x6a\x08\x53\xd5\x4a\x92\x16\x8c\xa3\xf4\x65\xbc\xaa\x03\x9a\x75\x30\x77\x1d\x8c\xd9\x7b\x92\x1a\x04\x61\xea\x13\x4c\x3e\xcc\x05\xf9\x33\x7b\xa0\xf4\xbe\x9e\xa7\xe9\xf1\x78\x9c\x51\xe4\x3d\x33\xb6\x48\x55\x9b\xeb\xd2\x9b\xe5\x87\x4f\xab\xed\xa7\xd7\xef\x66\x6f\xce\x55\x5f\xb5\x62\xe7\x60\xf9\xef\x46\x5a\xce\xb0\x3f\x81\xea\x5a\x49\x41\x7b\xc5\x50\x74\x84\xb1\xa0\xc2\x32\x67\xf0\x26\x70\x3f\x5a\xe9\xa5\x2e\x12\x38\x93\xfb\x23\x59\xee\x90\x32\xe9\xbc\x95\xfb\xc6\x5f\x18\xd8\x33\x95\xee\x22\xc1\x68\x90\xc6\x78\xb1\xc5\x72\x3b\xc6\xaf\x8b\xed\x72\x9b\x74\x38\xdf\x96\xb7\xbf\xaf\xbf\xde\xe2\xdb\x62\xb3\x59\xac\x6e\x97\x9f\xb6\x58\x6f\xf0\x61\xbd\xfa\xb8\xbc\x5d\xae\x57\x5b\xac\x7f\xc3\x62\x75\x87\x3f\x96\xab\x8f\x09\x58\xfa\x92\x2d\xf8\xa1\xb6\x41\x87\xb1\x90\xc1\x5a\xce\x7a\x1f\xb7\xcc\x17\x44\x72\xd3\x12\x73\x35\x0b\x99\x4b\x01\x45\xba\x68\xa8\x60\x14\xe6\xc0\x56\x4b\x5d\xa0\x66\x5b\x49\x17\x1a\xed\x40\x3a\xeb\x90\x94\xac\xa4\x27\x1f\x4f\xaf\x04\xce\x46\xa3\x7f\x46\x40\x9a\xa2\x26\xeb\xf8\xb3\x33\x7a\x92\x91\xa7\xe9\xbc\x3d\x70\x31\x79\x17\x8e\x76\x08\x3e\xe8\x02\xe4\x40\xf8\xee\x8c\x46\x66\x44\x53\xb1\xf6\x49\xbc\x2e\xc2\x58\xf6\x8d\xd5\x6d\x99\x65\xd7\xa8\x60\x7a\xcc\xd6\xec\x61\xf6\xdf\x59\xf8\xd9\x08\xe7\xeb\xe6\x73\x38\x9f\xcd\x34\x79\x79\xe0\xc9\xf8\xf1\x7c\x3c\x4d\x46\x03\x66\x77\x54\xa9\x0b\x66\x2f\x11\xbb\x5b\x7c\xb9\x09\x07\x4c\xd5\x33\xb4\x48\xe3\x15\x59\x4b\xa7\x57\xfd\x4c\xbe\x44\xd2\xcd\x80\x05\x9c\xd4\x85\xe2\x16\x23\x22\xf7\x92\x71\x94\x4a\xc1\xf9\xf0\xdc\x73\x87\xcf\x59\xe4\xa0\x11\xaf\x68\xdf\x11\xa3\xbb\x72\x56\x1c\x0a\x1f\xc5\x07\x45\xcf\x89\x0f\xe7\x67\xf1\x15\x69\x99\xb3\xf3\xb1\x33\x07\x52\x0d\x27\x90\x3a\x63\xed\xa7\x73\x08\xa3\x0f\x6c\x7d\xd4\x71\xc9\x1e\xbb\x98\xbb\x6b\x41\xbc\x01\xf5\x26\xb1\x16\x26\x6b\x89\x8e\x6b\xcb\xde\x9f\xc6\x98\x54\xc1\x82\xd7\x4a\x6a\x9e\xe2\xf3\x76\xbd\x4a\x5a\xee\x4c\xa2\x6c\x11\x34\xbb\xe8\x91\xe2\x03\xab\x8e\x40\xfb\xda\xed\xda\x1f\x3b\xb8\x9a\x04\xbb\x20\xef\x65\xce\xef\xff\x3f\x9d\xcf\x31\x19\xc5\xb9\x34\x82\x14\x72\xbc\xbf\xb0\x60\x58\x1b\x96\x53\xc8\xcc\x9f\x08\x1f\x01\x57\xfe\xc4\xf9\x88\x69\x3f\xe4\x4b\xb4\xa4\x45\xb8\xf6\x85\xba\xb6\x5f\x76\x7c\xa8\xec\x99\xde\x0d\x43\xe7\xf6\xb1\x13\x54\xf3\x36\x5e\xb1\xe1\x82\x1f\x26\x6e\x3a\xc7\x9f\x8d\xf1\xdc\x4d\x5f\xc1\x0f\xa8\xd8\x93\x28\xc9\x92\xf0\x6c\x1d\x72\xd3\xe8\x2c\xec\xac\xe8\x66\x9a\xc6\x2f\x40\x3b\xa7\x61\x21\x51\x57\xe5\x4b\xea\xc6\xb0\x22\x2f\xda\x6d\x6c\xac\x2c\xa4\x26\x05\x25\x3d\x5b\x52\x6d\xfd\x19\x3b\x00\x5e\x71\x7a\xa2\xe4\x2a\x7e\x96\x63\xd9\x19\x75\xe0\x65\x45\x05\x4f\x64\x78\x3e\x71\x3b\x33\xe2\x9e\xc3\x32\x0b\x9b\xa9\x73\x36\xb7\xa6\x6a\xcb\xe3\xf1\xdc\x53\x01\xa9\xe3\x4c\x56\xc6\x0e\x56\x5a\x0c\xff\x92\xc9\x82\x9d\x4f\x90\x71\xcd\x3a\x0b\x00\x46\xf7\xdf\xbf\x4e\x8e\xa9\x2a\xd2\x19\xc2\xbc\x22\x57\x54\x44\x59\x43\x6e\x4f\x14\x0d\x43\x43\x31\x05\x3f\x7c\x09\xd6\x4d\xe2\xbf\x49\x47\x78\x3a\xc7\xa6\xdf\x62\xb6\x61\xc8\xbc\x33\x5c\x9e\x5b\x33\x1c\x9d\x19\x36\x7d\x98\x5c\xdc\xe3\xf1\x45\xe7\xd8\xc2\xc2\x84\x45\xdd\x02\xd4\xa8\x49\xdc\x53\xd1\x2d\x84\x49\x7d\xf2\xa5\xd1\xaf\xa5\x2b\xa7\xad\x80\x9e\xcf\x15\xfd\x3e\xf0\x84\xfc\xb6\xd9\x3b\xff\x48\xde\x8a\x04\x96\x6b\xf5\xc8\x7f\xb0\xdf\xc2\xb6\x0b\x31\x12\x52\x17\x03\x84\x38\x65\x56\xb4\xaf\x7b\x48\x98\x01\x9b\x98\x17\x35\xf4\x2d\x0c\x5f\x74\xa9\x85\x6a\x32\xc6\xff\xde\x26\x60\x2f\x1e\x37\x8b\xe5\x3c\x7c\x53\x0c\x5c\xb3\x8f\x83\xc8\x2e\x82\xfc\x98\x25\xfd\x8a\x8f\xbe\x3c\x6f\x49\x54\xf9\x9c\x25\x31\x10\x2c\xf9\x77\xf4\x5f\x00\x00\x00\xff\xff\x3a\x93\xab\x97\x36\x09\x00\x00")
+var _libKubecfgLibsonnet = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x95\x57\x6d\x6f\xdb\x36\x10\xfe\x9e\x5f\x71\x30\x0a\xd4\xee\x14\x39\x2d\xf6\x02\x78\x28\x30\x2f\xed\x30\x77\xad\x83\xd9\xe9\x8a\x7c\x0b\x2d\x9d\x6c\x36\x12\xa9\x91\x54\x1c\xa3\xe8\x7f\xdf\x1d\x49\x59\xf2\x4b\x81\xae\x28\x12\x9b\x47\x3e\x7c\xee\xb9\x37\x66\x3c\x86\x6b\x5d\xef\x8c\x5c\x6f\x1c\xbc\xba\x7a\xf9\x0b\xdc\x6e\x10\x1e\x9a\x15\x66\xc5\x1a\x44\xe3\x36\xda\xd8\x8b\xf1\x38\xfc\x07\xfa\xf7\x5e\x66\xa8\x2c\xe6\xd0\xa8\x1c\x0d\x38\xda\x3e\xad\x45\x46\xbf\xa2\x25\x81\x7f\xd0\x58\xa9\x15\xbc\x4a\xaf\x60\xc8\x1b\x06\xd1\x34\x18\xfd\x1a\x51\x76\xba\x81\x4a\xec\x40\x69\x07\x8d\x45\x82\x91\x16\x0a\x59\x22\xe0\x53\x86\xb5\x03\xa9\x20\xd3\x55\x5d\x4a\xa1\x32\x84\xad\x74\x1b\x7f\x55\x04\x4a\x23\xcc\x5d\x84\xd1\x2b\x27\xe8\x84\xa0\x33\x35\x7d\x2b\xfa\x7b\x41\xb8\x8e\x3d\xc0\xc6\xb9\x7a\x32\x1e\x6f\xb7\xdb\x54\x78\xde\xa9\x36\xeb\x71\x19\xf6\xda\xf1\xfb\xd9\xf5\xdb\xf9\xf2\xed\x25\x71\xef\x4e\x7d\x54\x25\x5a\x0b\x06\xff\x6d\xa4\x21\xd7\x57\x3b\x10\x35\x71\xcb\xc4\x8a\x18\x97\x62\x0b\xda\x80\x58\x1b\x24\x9b\xd3\xcc\x7d\x6b\xa4\x93\x6a\x9d\x80\xd5\x85\xdb\x0a\x83\x11\x29\x97\xd6\x19\xb9\x6a\xdc\x81\x80\x2d\x53\xd2\xa0\xbf\x81\x24\x14\x0a\x06\xd3\x25\xcc\x96\x03\xf8\x7d\xba\x9c\x2d\x93\x88\xf3\x69\x76\xfb\xe7\xcd\xc7\x5b\xf8\x34\x5d\x2c\xa6\xf3\xdb\xd9\xdb\x25\xdc\x2c\xe0\xfa\x66\xfe\x66\x76\x3b\xbb\x99\xd3\xb7\x3f\x60\x3a\xbf\x83\xbf\x66\xf3\x37\x09\x20\xc9\x47\x57\xe1\x53\x6d\xd8\x0f\x22\x2b\x59\x5a\xcc\x5b\x1d\x97\x88\x07\x44\x0a\x1d\x88\xd9\x1a\x33\x59\xc8\x8c\x7c\x54\xeb\x46\xac\x11\xd6\xfa\x11\x8d\x22\xd7\xa0\x46\x53\x49\xcb\x81\xb6\x44\x33\x8f\x48\xa5\xac\xa4\x13\xce\xaf\x9e\x38\x98\x5e\x5c\x7c\xb9\x00\xa0\x9d\xb5\x30\x16\xdf\x59\xad\x86\xb9\x70\x62\x34\x09\x0b\xd6\x6f\xbe\xe7\xa5\x7b\x60\x1d\xe8\x1a\x41\xe8\xf0\x99\x76\x42\xae\xb3\xa6\x42\xe5\x12\x7f\x9d\x87\x31\xe8\x1a\xa3\xc2\x31\x72\xad\x29\x59\x74\xbf\x5b\xa1\xa3\xac\xf8\x8c\x99\x4b\x69\xeb\xfe\xba\xc9\x84\x70\xf3\x54\x11\xc3\x47\x1c\x0e\xf6\xeb\x83\x51\x72\xd1\x63\x76\x27\xaa\xf2\x80\xd9\xb7\x88\xdd\x4d\x3f\xbc\xe7\x05\x14\xd5\x19\x5a\x14\xbd\x17\xc2\x18\xb1\x7b\xd1\xe6\xe4\xb7\x48\xda\x14\x60\x0a\x96\x0c\x25\x06\x0c\x8f\xdc\xba\x4c\x05\x50\x96\x74\x0f\xff\x5c\x61\xc4\xa7\x0c\x11\xfe\x0e\x7f\x45\xa8\x11\xad\xe2\x71\x2c\x91\x0f\xee\x9d\x67\x8f\xce\x39\xcf\xeb\x9d\xf3\x95\x50\xb2\x40\xeb\x7c\x64\x1e\x45\xd9\x50\x35\x4b\x8a\xa2\x72\x24\x44\xa6\x15\xc5\xde\x79\x3f\x0e\xd9\xc3\xbd\xdf\x7b\x1f\x40\xa8\x02\x44\x2b\x12\xaa\x4c\xe7\x81\xe8\x80\x92\xcf\xb9\xdd\x00\x86\x15\x4b\x70\x59\x4a\x85\x23\x78\xb7\xbc\x99\x27\x81\x3b\x52\x35\x06\x04\x45\x14\xf8\x74\x89\x8f\x58\x46\x02\xa1\xec\xee\xc3\x17\x0a\x02\xd5\x2e\x5a\x76\xef\xdb\x9c\x5f\xff\x38\x22\x97\x87\x17\x3e\x2f\x75\x26\x4a\x28\xe0\xf5\x81\x04\xfd\xb3\xdc\x9c\x78\x67\x71\xe4\x38\x2d\x9e\xe8\xe3\xf3\xc3\x6f\xfb\x2e\x5d\xbc\x24\x01\xe1\x54\x17\x11\xc3\x7e\x18\xf1\xbe\x67\x67\x62\xd7\x37\x75\xe1\x43\x9b\x89\x1a\x97\xfe\x8a\x05\xae\xf1\x69\x68\x89\xdf\xdf\x8d\x76\x18\xb3\x8f\xd6\xa0\x42\x47\x4a\x0b\x23\x32\x47\x8d\x9a\x6a\x9d\xea\x94\x7b\x96\x57\x93\x50\x6e\xf7\x79\xca\x0d\x49\xc4\x53\x6e\x23\x62\x1a\x56\xc2\x65\xa1\x1b\x6b\x9a\x1b\x52\x91\xae\xa5\x24\x28\x51\x86\xf3\x1d\x36\x03\x9e\x70\x3a\xf2\xe4\xc4\xde\xb9\x43\x24\x74\xf9\x88\xb3\x8a\x1a\xcf\x50\xf2\xcf\x23\xb5\x49\xac\x07\xe4\x66\xc6\x9d\x29\x2a\x5b\x18\x5d\x85\xe3\x7e\x79\xe2\xc4\x9a\x9c\xf3\x39\x59\x69\xd3\x6b\x69\xde\xfc\x5b\x2e\xd7\x24\x63\x02\x39\xd6\xa8\x72\x06\xa0\x4e\x13\xe7\x5f\x74\x47\x57\xa4\x76\x0e\x9c\xaf\x50\x94\x62\xed\xdd\xea\x73\x3b\xf2\xa8\x6f\xea\x3b\x43\xbe\x7d\x60\xe9\x86\xfe\x63\x12\x09\x93\x4b\x8b\xb6\x8b\x99\x86\x66\x40\x11\x05\x97\x5d\x68\xfa\xa9\x93\xc2\xa2\x35\x53\xf2\x70\x1f\xf7\x85\x8e\x3e\x84\x6b\xcd\x8d\x3a\x00\xd4\x54\xf8\xd9\x03\x71\x08\xa7\x87\xf5\x8e\x86\xb9\xba\x94\x76\x33\x0a\x0e\xb4\x7c\x4e\xe8\xb7\x86\x23\xf2\xcb\x66\x65\xdd\x9e\xbc\xc9\x12\x5a\xae\xcb\x3d\xff\x5e\x7f\xe3\x6e\xc7\x36\x91\x11\xe1\x1e\x82\xcf\x32\x93\x85\x72\xe7\x0d\xd4\xf5\x16\x7e\x9f\xf7\xa1\x0d\x21\x4f\x74\xa9\xb2\xb2\xc9\x11\x9e\xbd\xa4\xf1\xe5\xb2\x7d\x67\x31\x58\xf0\x4c\xd1\x60\x9b\x95\x4f\x44\xb4\x1e\xe4\xfb\x24\x69\x5b\xbc\xd7\xe5\xbc\x24\xde\xcb\x73\x92\x78\x43\x27\x49\xd6\x18\x43\x97\xcc\x45\x85\xbe\x17\x0d\xfb\x81\x24\x25\x54\x6b\x08\x95\x13\xdb\xbc\x77\x5d\x37\x2e\x60\x50\xef\x26\x52\xf4\x8e\x90\xae\xb7\x7f\x1b\xbb\xbc\x65\x49\x9c\x4e\x7c\x4a\xc3\xe5\x65\xb7\x23\x4c\xe7\x03\x1e\x21\x67\xb5\x2a\xe4\x9a\x4b\xc4\xe1\x93\x23\x5d\xe6\xa1\xf2\x05\x3f\xb2\x58\x59\xff\xcc\xaa\xc4\x43\x98\xb4\x01\x80\xd8\xd4\x8d\x0f\xd9\x7d\xfb\xee\xb3\x1b\xbd\xbd\x8f\x25\xc1\xf5\xc0\xfe\x84\x06\xda\xdd\xc2\x82\x1d\x6b\x70\x24\xdb\xb1\xf9\x44\xbc\xeb\x40\xf4\x9c\x74\xed\xc0\x3c\x75\x6b\x5f\x0f\x0d\xbf\x35\xa3\x36\xad\x2d\xbe\x5b\x7a\x34\xcf\x8b\xd0\xb6\xf3\xa8\xc4\xff\x12\x21\x9c\x3d\xab\x44\x74\xe8\xbc\x0e\xd1\xd8\xa9\xb0\x11\x76\x73\xe3\xf3\x62\x48\xe9\xd1\x13\x41\xc0\x86\xd2\x79\xf9\xe7\xf4\xf2\xd5\x4f\x3f\xfb\x6d\xad\x1c\x3c\x2e\xc3\xf0\xd8\x57\x16\x59\xe8\x34\xcd\xd0\x8d\xa4\xb6\x9c\x6b\xb4\xea\xb9\xeb\xf1\x2e\x24\x96\xf4\xc1\xd0\x5b\x8c\x1f\x19\x75\xdb\xe7\x86\x71\x22\xd1\x58\x2e\xe4\x13\xc1\x8c\xfc\x0d\xed\x6d\x82\xfe\x30\x60\xef\x3e\x88\x9a\x55\x5d\x62\x46\xe3\xfb\x39\x3d\x50\xe9\x0d\xe4\x1f\xb9\x94\xcc\x1c\xa8\xbe\x92\xa4\x87\x6d\x2a\x06\x7f\x43\x55\xad\x77\x5c\x85\xf4\x6c\xd6\x94\xcf\x24\x30\x31\x44\x45\x13\x3d\x84\xc8\xe3\xd0\xa8\x50\xd4\x7f\x27\x1e\x24\x20\xb5\xa3\xda\xdb\x5f\xc3\x97\x01\xbd\xb4\x53\x16\x7a\x30\xe1\xd2\xd6\xc6\x51\x97\x80\x6e\xf5\x6b\xd2\x9e\xcb\x5a\xbe\x13\xf8\xd2\xae\x81\x9f\x76\x8c\x75\xb0\x08\x9e\xfa\xc4\xc3\x5c\x0e\xe0\x07\x1f\x2e\xcb\x05\x6e\x86\x31\xfe\x69\x2f\x3a\xfe\x25\x98\xc0\x55\x02\x2f\xaf\x46\x49\x07\xf3\xb5\xf7\x39\xdc\xc1\x3f\xf7\x8b\xd1\x1c\xbe\xa6\xe9\xfe\x8f\x98\x4e\x9c\xd0\xce\x7c\xd3\x23\x49\x9f\xa5\x7b\x17\xd2\x96\x76\xca\x44\x39\xc3\x3a\x3a\x47\xd9\xd5\x19\x38\xb3\xbe\x5e\xfc\x07\xfc\x75\xb2\x5c\xd3\x0d\x00\x00")
 
 func libKubecfgLibsonnetBytes() ([]byte, error) {
 	return bindataRead(
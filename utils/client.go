@@ -17,12 +17,16 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/googleapis/gnostic/OpenAPIv2"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/version"
@@ -37,29 +41,118 @@ type memcachedDiscoveryClient struct {
 	lock            sync.RWMutex
 	servergroups    *metav1.APIGroupList
 	serverresources map[string]*metav1.APIResourceList
-	schemas         map[string]openapi.Resources
 	schema          *openapi_v2.Document
+	resources       openapi.Resources
+	serverversion   *version.Info
+
+	// OpenAPI v3 documents, and their parsed forms, by path
+	v3index     map[string]string
+	v3docs      map[string][]byte
+	v3resources map[string]openapi.Resources
+
+	// Aggregate results, only cached when complete
+	allresources        []*metav1.APIResourceList
+	preferred           []*metav1.APIResourceList
+	preferrednamespaced []*metav1.APIResourceList
+
+	// Results are refetched after maxAge, if non-zero
+	maxAge  time.Duration
+	expires time.Time
+	// stale is set when results were dropped by expiry or
+	// MarkStale, rather than Invalidate
+	stale bool
+
+	// retries is the number of retries after transient errors
+	retries int
 }
 
 // NewMemcachedDiscoveryClient creates a new DiscoveryClient that
-// caches results in memory
-func NewMemcachedDiscoveryClient(cl discovery.DiscoveryInterface) discovery.CachedDiscoveryInterface {
-	c := &memcachedDiscoveryClient{cl: cl}
-	c.Invalidate()
+// caches results in memory.  If maxAge is non-zero, results older
+// than that are transparently refetched.
+func NewMemcachedDiscoveryClient(cl discovery.DiscoveryInterface, maxAge time.Duration) discovery.CachedDiscoveryInterface {
+	return newMemcachedDiscoveryClient(cl, maxAge)
+}
+
+func newMemcachedDiscoveryClient(cl discovery.DiscoveryInterface, maxAge time.Duration) *memcachedDiscoveryClient {
+	c := &memcachedDiscoveryClient{cl: cl, maxAge: maxAge, retries: DefaultDiscoveryRetries}
+	c.reset()
 	return c
 }
 
+// Fresh is false if results have expired or been marked stale
+// since the last Invalidate, or if cl is itself a cache serving old
+// results.  RESTMappers built on c rebuild themselves on a miss
+// when it is false.
 func (c *memcachedDiscoveryClient) Fresh() bool {
+	c.lock.RLock()
+	stale := c.stale || c.expired()
+	c.lock.RUnlock()
+	if stale {
+		return false
+	}
+	if cached, ok := c.cl.(discovery.CachedDiscoveryInterface); ok {
+		return cached.Fresh()
+	}
 	return true
 }
 
+// Invalidate forgets cached results, including those of cl if it
+// is itself a cache.
 func (c *memcachedDiscoveryClient) Invalidate() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	c.reset()
+	c.stale = false
+	if cached, ok := c.cl.(discovery.CachedDiscoveryInterface); ok {
+		cached.Invalidate()
+	}
+}
+
+// MarkStale forgets cached results, like Invalidate, and also
+// reports them as not Fresh until the next Invalidate.  Unlike
+// Invalidate, this causes RESTMappers built on c to rebuild
+// themselves the next time they fail to find a type.
+func (c *memcachedDiscoveryClient) MarkStale() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reset()
+	c.stale = true
+	if cached, ok := c.cl.(discovery.CachedDiscoveryInterface); ok {
+		cached.Invalidate()
+	}
+}
+
+// expired is true if results are older than maxAge.  Call with
+// c.lock held.
+func (c *memcachedDiscoveryClient) expired() bool {
+	return c.maxAge > 0 && time.Now().After(c.expires)
+}
+
+// expire drops results older than maxAge.  Call with c.lock held
+// for writing.
+func (c *memcachedDiscoveryClient) expire() {
+	if c.expired() {
+		log.Debugf("Discovery results are older than %s, refetching", c.maxAge)
+		c.reset()
+		c.stale = true
+	}
+}
+
+func (c *memcachedDiscoveryClient) reset() {
+	c.expires = time.Now().Add(c.maxAge)
 	c.servergroups = nil
 	c.serverresources = make(map[string]*metav1.APIResourceList)
-	c.schemas = make(map[string]openapi.Resources)
+	c.schema = nil
+	c.resources = nil
+	c.serverversion = nil
+	c.v3index = nil
+	c.v3docs = make(map[string][]byte)
+	c.v3resources = make(map[string]openapi.Resources)
+	c.allresources = nil
+	c.preferred = nil
+	c.preferrednamespaced = nil
 }
 
 func (c *memcachedDiscoveryClient) RESTClient() rest.Interface {
@@ -69,64 +162,276 @@ func (c *memcachedDiscoveryClient) RESTClient() rest.Interface {
 func (c *memcachedDiscoveryClient) ServerGroups() (*metav1.APIGroupList, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	c.expire()
 
-	var err error
 	if c.servergroups != nil {
 		return c.servergroups, nil
 	}
-	c.servergroups, err = c.cl.ServerGroups()
-	return c.servergroups, err
+	var groups *metav1.APIGroupList
+	err := withRetries("discovery of API groups", c.retries, func() error {
+		var err error
+		groups, err = c.cl.ServerGroups()
+		return err
+	})
+	if err != nil {
+		return groups, err
+	}
+	c.servergroups = groups
+	return groups, nil
 }
 
 func (c *memcachedDiscoveryClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-
-	var err error
-	if v := c.serverresources[groupVersion]; v != nil {
+	c.lock.RLock()
+	v := c.serverresources[groupVersion]
+	expired := c.expired()
+	retries := c.retries
+	c.lock.RUnlock()
+	if v != nil && !expired {
 		return v, nil
 	}
-	c.serverresources[groupVersion], err = c.cl.ServerResourcesForGroupVersion(groupVersion)
-	return c.serverresources[groupVersion], err
+
+	// Don't hold the lock across the request, so that lookups of
+	// different GroupVersions may proceed concurrently.
+	err := withRetries("discovery of "+groupVersion, retries, func() error {
+		var err error
+		v, err = c.cl.ServerResourcesForGroupVersion(groupVersion)
+		return err
+	})
+	if err != nil {
+		return v, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+	c.serverresources[groupVersion] = v
+	return v, nil
 }
 
 func (c *memcachedDiscoveryClient) ServerResources() ([]*metav1.APIResourceList, error) {
-	return c.cl.ServerResources()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	if c.allresources != nil {
+		return c.allresources, nil
+	}
+	rls, err := c.cl.ServerResources()
+	// Even a partial result saves later per-GroupVersion lookups
+	for _, rl := range rls {
+		c.serverresources[rl.GroupVersion] = rl
+	}
+	if err != nil {
+		return rls, err
+	}
+	c.allresources = rls
+	return rls, nil
 }
 
 func (c *memcachedDiscoveryClient) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
-	return c.cl.ServerPreferredResources()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	// NB: these lists only include the preferred version of each
+	// resource, so they can't fill in serverresources.
+	if c.preferred != nil {
+		return c.preferred, nil
+	}
+	rls, err := c.cl.ServerPreferredResources()
+	if err != nil {
+		return rls, err
+	}
+	c.preferred = rls
+	return rls, nil
 }
 
 func (c *memcachedDiscoveryClient) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
-	return c.cl.ServerPreferredNamespacedResources()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	if c.preferrednamespaced != nil {
+		return c.preferrednamespaced, nil
+	}
+	rls, err := c.cl.ServerPreferredNamespacedResources()
+	if err != nil {
+		return rls, err
+	}
+	c.preferrednamespaced = rls
+	return rls, nil
 }
 
 func (c *memcachedDiscoveryClient) ServerVersion() (*version.Info, error) {
-	return c.cl.ServerVersion()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	if c.serverversion != nil {
+		return c.serverversion, nil
+	}
+	v, err := c.cl.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	c.serverversion = v
+	return v, nil
 }
 
 func (c *memcachedDiscoveryClient) OpenAPISchema() (*openapi_v2.Document, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	c.expire()
 
+	if err := c.fetchOpenAPISchema(); err != nil {
+		return nil, err
+	}
+	return c.schema, nil
+}
+
+// fetchOpenAPISchema sets c.schema, unless it is already set.  Call
+// with c.lock held for writing.
+func (c *memcachedDiscoveryClient) fetchOpenAPISchema() error {
 	if c.schema != nil {
-		return c.schema, nil
+		return nil
+	}
+	return withRetries("fetch of OpenAPI schema", c.retries, func() error {
+		schema, err := c.cl.OpenAPISchema()
+		if err != nil {
+			return err
+		}
+		c.schema = schema
+		return nil
+	})
+}
+
+// openAPIResources returns the parsed form of OpenAPISchema().
+// Parsing the full document is expensive on clusters with many
+// CRDs, so it is done at most once and shared by all subsequent
+// per-GroupVersionKind lookups.
+func (c *memcachedDiscoveryClient) openAPIResources() (openapi.Resources, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	if c.resources != nil {
+		return c.resources, nil
+	}
+
+	if err := c.fetchOpenAPISchema(); err != nil {
+		return nil, err
+	}
+
+	resources, err := openapi.NewOpenAPIData(c.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	c.resources = resources
+	return resources, nil
+}
+
+// OpenAPIV3Schema fetches the OpenAPI v3 document at path (see
+// OpenAPIV3Path), caching the server's list of documents as well as
+// each one.
+func (c *memcachedDiscoveryClient) OpenAPIV3Schema(path string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+
+	return c.openAPIV3Schema(path)
+}
+
+// openAPIV3Schema is OpenAPIV3Schema.  Call with c.lock held for
+// writing.
+func (c *memcachedDiscoveryClient) openAPIV3Schema(path string) ([]byte, error) {
+	if doc, ok := c.v3docs[path]; ok {
+		return doc, nil
 	}
 
-	schema, err := c.cl.OpenAPISchema()
+	if c.v3index == nil {
+		index, err := fetchOpenAPIV3Index(c.cl.RESTClient())
+		if errors.IsNotFound(err) {
+			// Not supported: don't ask again
+			index = map[string]string{}
+		} else if err != nil {
+			return nil, err
+		}
+		c.v3index = index
+	}
+	ref, ok := c.v3index[path]
+	if !ok {
+		return nil, errors.NewNotFound(openAPIV3Resource, path)
+	}
+	doc, err := fetchOpenAPIV3(c.cl.RESTClient(), ref)
 	if err != nil {
 		return nil, err
 	}
+	c.v3docs[path] = doc
+	return doc, nil
+}
+
+// openAPIV3Resources returns the parsed form of
+// OpenAPIV3Schema(path), like openAPIResources.
+func (c *memcachedDiscoveryClient) openAPIV3Resources(path string) (openapi.Resources, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
 
-	c.schema = schema
-	return schema, nil
+	if resources, ok := c.v3resources[path]; ok {
+		return resources, nil
+	}
+	doc, err := c.openAPIV3Schema(path)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := openAPIV3Resources(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing OpenAPI v3 document %s: %v", path, err)
+	}
+	c.v3resources[path] = resources
+	return resources, nil
 }
 
 var _ discovery.CachedDiscoveryInterface = &memcachedDiscoveryClient{}
+var _ OpenAPIV3Interface = &memcachedDiscoveryClient{}
+
+// MarkDiscoveryStale forgets any results cached by disco, so that
+// types registered since (eg: by a CustomResourceDefinition) are
+// found by later lookups, including by RESTMappers built on disco.
+func MarkDiscoveryStale(disco discovery.DiscoveryInterface) {
+	switch c := disco.(type) {
+	case *memcachedDiscoveryClient:
+		c.MarkStale()
+	case discovery.CachedDiscoveryInterface:
+		c.Invalidate()
+	}
+}
+
+// NewClientPool returns a pool of dynamic clients for conf, finding
+// resources with disco.
+func NewClientPool(conf *rest.Config, disco discovery.CachedDiscoveryInterface) dynamic.ClientPool {
+	mapper := discovery.NewDeferredDiscoveryRESTMapper(disco, dynamic.VersionInterfaces)
+	return dynamic.NewClientPool(conf, mapper, dynamic.LegacyAPIPathResolverFunc)
+}
 
 // ClientForResource returns the ResourceClient for a given object
 func ClientForResource(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, obj runtime.Object, defNs string) (dynamic.ResourceInterface, error) {
+	return clientForResource(pool, disco, obj, defNs, "")
+}
+
+// ClientForResourceSubresource returns a ResourceClient for the
+// named subresource (eg: "status" or "scale") of a given object.
+// Get, Update and Patch act on the subresource; it is an error if
+// the server doesn't serve it.
+func ClientForResourceSubresource(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, obj runtime.Object, defNs, subresource string) (dynamic.ResourceInterface, error) {
+	if subresource == "" || strings.Contains(subresource, "/") {
+		return nil, fmt.Errorf("Invalid subresource %q", subresource)
+	}
+	return clientForResource(pool, disco, obj, defNs, subresource)
+}
+
+func clientForResource(pool dynamic.ClientPool, disco discovery.DiscoveryInterface, obj runtime.Object, defNs, subresource string) (dynamic.ResourceInterface, error) {
 	gvk := obj.GetObjectKind().GroupVersionKind()
 
 	client, err := pool.ClientForGroupVersionKind(gvk)
@@ -139,13 +444,16 @@ func ClientForResource(pool dynamic.ClientPool, disco discovery.DiscoveryInterfa
 		return nil, err
 	}
 
-	meta, err := meta.Accessor(obj)
+	namespace, err := resourceNamespace(resource, obj, defNs)
 	if err != nil {
 		return nil, err
 	}
-	namespace := meta.GetNamespace()
-	if namespace == "" {
-		namespace = defNs
+
+	if subresource != "" {
+		resource, err = serverSubresource(disco, gvk.GroupVersion(), resource.Name, subresource)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	log.Debugf("Fetching client for %s namespace=%s", resource, namespace)
@@ -153,18 +461,140 @@ func ClientForResource(pool dynamic.ClientPool, disco discovery.DiscoveryInterfa
 	return rc, nil
 }
 
+// resourceNamespace returns the namespace obj belongs in, which is
+// always empty for cluster-scoped resources.
+func resourceNamespace(resource *metav1.APIResource, obj runtime.Object, defNs string) (string, error) {
+	meta, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	namespace := meta.GetNamespace()
+	if !resource.Namespaced {
+		if namespace != "" {
+			return "", fmt.Errorf("%s %s is cluster-scoped, but has namespace %q", resource.Name, meta.GetName(), namespace)
+		}
+	} else if namespace == "" {
+		namespace = defNs
+	}
+	return namespace, nil
+}
+
+// serverSubresource returns the server's description of
+// resource/subresource in gv.  The dynamic client splits the name
+// again to address the subresource.
+func serverSubresource(disco discovery.ServerResourcesInterface, gv schema.GroupVersion, resource, subresource string) (*metav1.APIResource, error) {
+	resources, err := disco.ServerResourcesForGroupVersion(gv.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch resource description for %s: %v", gv, err)
+	}
+
+	name := resource + "/" + subresource
+	available := []string{}
+	for i := range resources.APIResources {
+		r := &resources.APIResources[i]
+		if r.Name == name {
+			return r, nil
+		}
+		if strings.HasPrefix(r.Name, resource+"/") {
+			available = append(available, strings.TrimPrefix(r.Name, resource+"/"))
+		}
+	}
+	return nil, fmt.Errorf("%s %s has no %q subresource (available: %s)", gv, resource, subresource, strings.Join(available, ", "))
+}
+
+// UnservableKinds returns the kinds of objs that disco can't serve,
+// with the reason for each.  Kinds defined by a
+// CustomResourceDefinition in objs are assumed to be servable once
+// it is created.
+func UnservableKinds(disco discovery.ServerResourcesInterface, objs []*unstructured.Unstructured) map[schema.GroupVersionKind]error {
+	defined := map[schema.GroupVersionKind]bool{}
+	for _, obj := range objs {
+		if obj.GroupVersionKind().GroupKind() == gkCrd {
+			for _, gvk := range crdKinds(obj) {
+				defined[gvk] = true
+			}
+		}
+	}
+
+	ret := map[schema.GroupVersionKind]error{}
+	checked := map[schema.GroupVersionKind]bool{}
+	for _, obj := range objs {
+		gvk := obj.GroupVersionKind()
+		if checked[gvk] || defined[gvk] {
+			continue
+		}
+		checked[gvk] = true
+		if _, err := serverResourceForGroupVersionKind(disco, gvk); err != nil {
+			ret[gvk] = err
+		}
+	}
+	return ret
+}
+
+// crdKinds returns the kinds a CustomResourceDefinition defines
+func crdKinds(crd *unstructured.Unstructured) []schema.GroupVersionKind {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return nil
+	}
+
+	var ret []schema.GroupVersionKind
+	if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" {
+		ret = append(ret, schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+	}
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		if m, ok := v.(map[string]interface{}); ok {
+			if name, ok := m["name"].(string); ok && name != "" {
+				ret = append(ret, schema.GroupVersionKind{Group: group, Version: name, Kind: kind})
+			}
+		}
+	}
+	return ret
+}
+
+// ResourceFor returns the APIResource that serves obj
+func ResourceFor(disco discovery.ServerResourcesInterface, obj runtime.Object) (*metav1.APIResource, error) {
+	return serverResourceForGroupVersionKind(disco, obj.GetObjectKind().GroupVersionKind())
+}
+
 func serverResourceForGroupVersionKind(disco discovery.ServerResourcesInterface, gvk schema.GroupVersionKind) (*metav1.APIResource, error) {
 	resources, err := disco.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch resource description for %s: %v", gvk.GroupVersion(), err)
 	}
 
-	for _, r := range resources.APIResources {
-		if r.Kind == gvk.Kind {
-			log.Debugf("Using resource '%s' for %s", r.Name, gvk)
-			return &r, nil
-		}
+	if r := primaryResource(resources, gvk.Kind); r != nil {
+		log.Debugf("Using resource '%s' for %s", r.Name, gvk)
+		return r, nil
+	}
+
+	// Results cached from an earlier run may predate a new CRD
+	if cached, ok := disco.(discovery.CachedDiscoveryInterface); ok && !cached.Fresh() {
+		log.Debugf("Unable to find %s in cached discovery results, refreshing", gvk)
+		cached.Invalidate()
+		return serverResourceForGroupVersionKind(disco, gvk)
 	}
 
 	return nil, fmt.Errorf("Server is unable to handle %s", gvk)
 }
+
+// primaryResource returns the resource in list that serves kind,
+// ignoring subresources.  Subresources may share their parent's
+// kind (eg: "deployments/status" is a Deployment), or have a kind of
+// their own (eg: "deployments/scale" is a Scale), but can't be used
+// to create, list or delete objects.
+func primaryResource(list *metav1.APIResourceList, kind string) *metav1.APIResource {
+	for i := range list.APIResources {
+		r := &list.APIResources[i]
+		if strings.Contains(r.Name, "/") {
+			continue
+		}
+		if r.Kind == kind {
+			ret := *r
+			return &ret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,455 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func newFakeDiscovery() *fakediscovery.FakeDiscovery {
+	fake := &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+					{Name: "namespaces", Kind: "Namespace"},
+				},
+			},
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", Kind: "Deployment", Namespaced: true},
+				},
+			},
+		},
+	}
+	return &fakediscovery.FakeDiscovery{Fake: fake}
+}
+
+func TestPrefetchResources(t *testing.T) {
+	fake := newFakeDiscovery()
+	disco := NewMemcachedDiscoveryClient(fake, 0)
+
+	objs := []*unstructured.Unstructured{}
+	for _, gvk := range []struct{ apiVersion, kind string }{
+		{"v1", "ConfigMap"},
+		{"v1", "Namespace"},
+		{"apps/v1", "Deployment"},
+		{"unknown/v1", "Unknown"},
+	} {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(gvk.apiVersion)
+		obj.SetKind(gvk.kind)
+		objs = append(objs, obj)
+	}
+
+	prefetched, deferred := PrefetchResources(disco, objs, 2, 0)
+	if len(prefetched) != 3 || len(deferred) != 0 {
+		t.Errorf("Unexpected prefetched %v, deferred %v", prefetched, deferred)
+	}
+	if n := len(fake.Actions()); n != 3 {
+		t.Errorf("Expected 3 discovery requests, got %d", n)
+	}
+
+	for _, gv := range []string{"v1", "apps/v1"} {
+		if _, err := disco.ServerResourcesForGroupVersion(gv); err != nil {
+			t.Errorf("ServerResourcesForGroupVersion(%s) failed: %v", gv, err)
+		}
+	}
+	if n := len(fake.Actions()); n != 3 {
+		t.Errorf("Prefetched GroupVersions were not cached, %d requests made", n)
+	}
+}
+
+// slowDiscovery blocks lookups of one GroupVersion until released
+type slowDiscovery struct {
+	discovery.ServerResourcesInterface
+	slow    string
+	release chan struct{}
+}
+
+func (d slowDiscovery) ServerResourcesForGroupVersion(gv string) (*metav1.APIResourceList, error) {
+	if gv == d.slow {
+		<-d.release
+	}
+	return d.ServerResourcesInterface.ServerResourcesForGroupVersion(gv)
+}
+
+func TestPrefetchResourcesTimeout(t *testing.T) {
+	disco := slowDiscovery{
+		ServerResourcesInterface: newFakeDiscovery(),
+		slow:                     "apps/v1",
+		release:                  make(chan struct{}),
+	}
+	defer close(disco.release)
+
+	objs := []*unstructured.Unstructured{}
+	for _, apiVersion := range []string{"v1", "apps/v1"} {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind("Dummy")
+		objs = append(objs, obj)
+	}
+
+	prefetched, deferred := PrefetchResources(disco, objs, 2, 100*time.Millisecond)
+	if !reflect.DeepEqual(prefetched, []string{"v1"}) {
+		t.Errorf("Unexpected prefetched %v", prefetched)
+	}
+	if !reflect.DeepEqual(deferred, []string{"apps/v1"}) {
+		t.Errorf("Unexpected deferred %v", deferred)
+	}
+}
+
+func TestServerResourceForGroupVersionKind(t *testing.T) {
+	fake := &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "apps/v1",
+				// Subresources first, to check they are
+				// never picked over the primary resource
+				APIResources: []metav1.APIResource{
+					{Name: "deployments/scale", Group: "autoscaling", Version: "v1", Kind: "Scale", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+					{Name: "deployments/status", Kind: "Deployment", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+					{Name: "deployments", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Verbs: []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}},
+					{Name: "replicasets/scale", Group: "autoscaling", Version: "v1", Kind: "Scale", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+					{Name: "replicasets", Kind: "ReplicaSet", Namespaced: true, Verbs: []string{"create", "delete", "get", "list", "patch", "update", "watch"}},
+					{Name: "replicasets/status", Kind: "ReplicaSet", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+				},
+			},
+		},
+	}
+	disco := &fakediscovery.FakeDiscovery{Fake: fake}
+
+	for kind, expected := range map[string]string{
+		"Deployment": "deployments",
+		"ReplicaSet": "replicasets",
+	} {
+		gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind}
+		r, err := serverResourceForGroupVersionKind(disco, gvk)
+		if err != nil {
+			t.Errorf("Error finding resource for %s: %v", kind, err)
+		} else if r.Name != expected {
+			t.Errorf("Got resource %q for %s, expected %q", r.Name, kind, expected)
+		}
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		if n := ResourceNameFor(disco, obj); n != expected {
+			t.Errorf("Got resource name %q for %s, expected %q", n, kind, expected)
+		}
+	}
+
+	// Scale is only served as a subresource
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Scale"}
+	if r, err := serverResourceForGroupVersionKind(disco, gvk); err == nil {
+		t.Errorf("Found resource %q for %s", r.Name, gvk)
+	}
+}
+
+func TestUnservableKinds(t *testing.T) {
+	fake := &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "patch"}},
+				},
+			},
+			{
+				GroupVersion: "apiextensions.k8s.io/v1beta1",
+				APIResources: []metav1.APIResource{
+					{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition", Verbs: []string{"get", "patch"}},
+				},
+			},
+		},
+	}
+	disco := &fakediscovery.FakeDiscovery{Fake: fake}
+
+	obj := func(apiVersion, kind string) *unstructured.Unstructured {
+		o := &unstructured.Unstructured{}
+		o.SetAPIVersion(apiVersion)
+		o.SetKind(kind)
+		o.SetName("x")
+		return o
+	}
+	crd := obj("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition")
+	unstructured.SetNestedField(crd.Object, "example.com", "spec", "group")
+	unstructured.SetNestedField(crd.Object, "Widget", "spec", "names", "kind")
+	unstructured.SetNestedSlice(crd.Object, []interface{}{
+		map[string]interface{}{"name": "v1"},
+		map[string]interface{}{"name": "v2"},
+	}, "spec", "versions")
+
+	objs := []*unstructured.Unstructured{
+		obj("v1", "ConfigMap"),
+		obj("v1", "Konfigmap"),
+		obj("v1", "Konfigmap"),
+		obj("apps/v1", "Deployment"),
+		crd,
+		obj("example.com/v2", "Widget"),
+		obj("example.com/v3", "Widget"),
+	}
+	unknown := UnservableKinds(disco, objs)
+
+	expected := []schema.GroupVersionKind{
+		{Version: "v1", Kind: "Konfigmap"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "example.com", Version: "v3", Kind: "Widget"},
+	}
+	if len(unknown) != len(expected) {
+		t.Errorf("Expected %d unservable kinds, got %v", len(expected), unknown)
+	}
+	for _, gvk := range expected {
+		if unknown[gvk] == nil {
+			t.Errorf("%s was not reported: %v", gvk, unknown)
+		}
+	}
+}
+
+// countingDiscovery counts the aggregate discovery calls
+type countingDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	preferred, namespaced int
+}
+
+func (d *countingDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	d.preferred++
+	return d.Resources, nil
+}
+
+func (d *countingDiscovery) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	d.namespaced++
+	return d.Resources, nil
+}
+
+func TestMemcachedAggregateResources(t *testing.T) {
+	fake := &countingDiscovery{FakeDiscovery: newFakeDiscovery()}
+	c := NewMemcachedDiscoveryClient(fake, 0)
+
+	for i := 0; i < 3; i++ {
+		if rls, err := c.ServerResources(); err != nil || len(rls) != 2 {
+			t.Fatalf("ServerResources returned (%v, %v)", rls, err)
+		}
+		if _, err := c.ServerPreferredResources(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ServerPreferredNamespacedResources(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each GroupVersion was filled in from ServerResources
+	for _, gv := range []string{"v1", "apps/v1"} {
+		if _, err := c.ServerResourcesForGroupVersion(gv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(fake.Actions()); n != 1 {
+		t.Errorf("Expected one ServerResources call, got %d: %v", n, fake.Actions())
+	}
+	if fake.preferred != 1 || fake.namespaced != 1 {
+		t.Errorf("Expected one call of each preferred lookup, got %d and %d", fake.preferred, fake.namespaced)
+	}
+
+	c.Invalidate()
+	if _, err := c.ServerResources(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ServerPreferredResources(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Actions()); n != 2 || fake.preferred != 2 {
+		t.Errorf("Invalidate didn't clear the cache: %d, %d", n, fake.preferred)
+	}
+}
+
+func TestMemcachedServerVersion(t *testing.T) {
+	fake := newFakeDiscovery()
+	fake.FakedServerVersion = &version.Info{Major: "1", Minor: "13"}
+	c := NewMemcachedDiscoveryClient(fake, 0)
+
+	for i := 0; i < 3; i++ {
+		if v, err := FetchVersion(c); err != nil || v != (ServerVersion{Major: 1, Minor: 13}) {
+			t.Fatalf("FetchVersion returned (%v, %v)", v, err)
+		}
+	}
+	if n := len(fake.Actions()); n != 1 {
+		t.Errorf("Expected one ServerVersion call, got %d", n)
+	}
+
+	c.Invalidate()
+	if _, err := c.ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Actions()); n != 2 {
+		t.Errorf("Invalidate didn't clear the cached version: %d calls", n)
+	}
+}
+
+func TestMemcachedMaxAge(t *testing.T) {
+	fake := newFakeDiscovery()
+	c := NewMemcachedDiscoveryClient(fake, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ServerResourcesForGroupVersion("v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(fake.Actions()); n != 1 {
+		t.Errorf("Expected one lookup before expiry, got %d", n)
+	}
+	if !c.Fresh() {
+		t.Errorf("Results reported stale before expiry")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if c.Fresh() {
+		t.Errorf("Expired results reported fresh")
+	}
+	if _, err := c.ServerResourcesForGroupVersion("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Actions()); n != 2 {
+		t.Errorf("Expected expired results to be refetched, got %d lookups", n)
+	}
+
+	c.Invalidate()
+	if !c.Fresh() {
+		t.Errorf("Results reported stale after Invalidate")
+	}
+}
+
+func TestMarkDiscoveryStale(t *testing.T) {
+	fake := newFakeDiscovery()
+	c := NewMemcachedDiscoveryClient(fake, 0)
+
+	if _, err := c.ServerResourcesForGroupVersion("v1"); err != nil {
+		t.Fatal(err)
+	}
+	MarkDiscoveryStale(c)
+	if c.Fresh() {
+		t.Errorf("Results reported fresh after MarkDiscoveryStale")
+	}
+	if _, err := c.ServerResourcesForGroupVersion("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Actions()); n != 2 {
+		t.Errorf("Expected stale results to be refetched, got %d lookups", n)
+	}
+
+	// Eg: DeferredDiscoveryRESTMapper.Reset()
+	c.Invalidate()
+	if !c.Fresh() {
+		t.Errorf("Results reported stale after Invalidate")
+	}
+
+	// Uncached clients are left alone
+	MarkDiscoveryStale(fake)
+}
+
+func TestClientForResourceNamespace(t *testing.T) {
+	disco := newFakeDiscovery()
+	pool := &fakedynamic.FakeClientPool{}
+
+	obj := func(kind, namespace string) *unstructured.Unstructured {
+		o := &unstructured.Unstructured{}
+		o.SetAPIVersion("v1")
+		o.SetKind(kind)
+		o.SetName("test")
+		o.SetNamespace(namespace)
+		return o
+	}
+
+	tests := []struct {
+		obj       *unstructured.Unstructured
+		namespace string
+	}{
+		{obj("ConfigMap", ""), "default"},
+		{obj("ConfigMap", "myns"), "myns"},
+		// Cluster-scoped: the default namespace isn't applied
+		{obj("Namespace", ""), ""},
+	}
+	for _, test := range tests {
+		rc, err := ClientForResource(pool, disco, test.obj, "default")
+		if err != nil {
+			t.Errorf("Error fetching client for %s: %v", test.obj.GetKind(), err)
+			continue
+		}
+		if ns := rc.(*fakedynamic.FakeResourceClient).Namespace; ns != test.namespace {
+			t.Errorf("Expected namespace %q for %s, got %q", test.namespace, FqName(test.obj), ns)
+		}
+	}
+
+	if _, err := ClientForResource(pool, disco, obj("Namespace", "myns"), "default"); err == nil {
+		t.Errorf("Expected an error for a namespaced Namespace")
+	}
+}
+
+func TestClientForResourceSubresource(t *testing.T) {
+	fake := &ktesting.Fake{
+		Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "apps/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "deployments", Kind: "Deployment", Namespaced: true},
+					{Name: "deployments/scale", Group: "autoscaling", Version: "v1", Kind: "Scale", Namespaced: true},
+					{Name: "deployments/status", Kind: "Deployment", Namespaced: true},
+				},
+			},
+		},
+	}
+	disco := &fakediscovery.FakeDiscovery{Fake: fake}
+	pool := &fakedynamic.FakeClientPool{}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetName("web")
+
+	rc, err := ClientForResourceSubresource(pool, disco, obj, "myns", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frc := rc.(*fakedynamic.FakeResourceClient)
+	if frc.Resource.Resource != "deployments/status" || frc.Namespace != "myns" {
+		t.Errorf("Unexpected client for %s in %s", frc.Resource, frc.Namespace)
+	}
+
+	rc, err = ClientForResource(pool, disco, obj, "myns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := rc.(*fakedynamic.FakeResourceClient).Resource.Resource; r != "deployments" {
+		t.Errorf("Unexpected resource %s", r)
+	}
+
+	for _, sub := range []string{"binding", "", "status/extra"} {
+		if _, err := ClientForResourceSubresource(pool, disco, obj, "myns", sub); err == nil {
+			t.Errorf("Expected an error for subresource %q", sub)
+		}
+	}
+}
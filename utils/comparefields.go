@@ -0,0 +1,191 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	goyaml "github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// CompareFields selects the fields of an object that are compared
+// with the server.  Paths are as for MergeKeys, so
+// "spec.containers.image" is the image of every container.
+type CompareFields struct {
+	// Include, if non-empty, limits comparison to these fields
+	// (and everything below them).
+	Include []string `json:"include,omitempty"`
+	// Exclude fields are never compared, even within Include.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// CompareConfig maps kinds to the fields compared for objects of
+// that kind.  AllKinds applies to every object.
+type CompareConfig map[schema.GroupKind]CompareFields
+
+// AllKinds is the CompareConfig key ("*" in a compare config file)
+// for fields of every kind.
+var AllKinds = schema.GroupKind{Kind: "*"}
+
+// For returns the fields compared for objects of kind gk.
+func (c CompareConfig) For(gk schema.GroupKind) CompareFields {
+	fields, all := c[gk], c[AllKinds]
+	if gk == AllKinds || (len(all.Include) == 0 && len(all.Exclude) == 0) {
+		return fields
+	}
+	return CompareFields{
+		Include: append(append([]string{}, all.Include...), fields.Include...),
+		Exclude: append(append([]string{}, all.Exclude...), fields.Exclude...),
+	}
+}
+
+// IgnorePaths adds paths (eg: from --ignore-path) to c, as fields of
+// every kind that are never compared.
+func IgnorePaths(c CompareConfig, paths []string) (CompareConfig, error) {
+	if len(paths) == 0 {
+		return c, nil
+	}
+	for _, p := range paths {
+		if err := validateFieldPath(p); err != nil {
+			return nil, fmt.Errorf("Invalid ignored path: %v", err)
+		}
+	}
+	ret := CompareConfig{}
+	for gk, fields := range c {
+		ret[gk] = fields
+	}
+	all := ret[AllKinds]
+	all.Exclude = append(append([]string{}, all.Exclude...), paths...)
+	ret[AllKinds] = all
+	return ret, nil
+}
+
+// ReadCompareConfig reads a YAML or JSON file mapping "Kind.group"
+// (eg: "Deployment.apps", or "ConfigMap" for the core group) to
+// include and exclude lists.
+func ReadCompareConfig(path string) (CompareConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCompareConfig(data)
+}
+
+// ParseCompareConfig parses and validates the contents of a
+// compare config file.
+func ParseCompareConfig(data []byte) (CompareConfig, error) {
+	var raw map[string]CompareFields
+	if err := goyaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Error parsing compare config: %v", err)
+	}
+
+	ret := CompareConfig{}
+	for kind, fields := range raw {
+		gk := schema.ParseGroupKind(kind)
+		if gk.Kind == "" {
+			return nil, fmt.Errorf("Invalid kind %q in compare config, expected Kind.group", kind)
+		}
+		if _, ok := ret[gk]; ok {
+			return nil, fmt.Errorf("Kind %q appears more than once in compare config", kind)
+		}
+
+		excluded := map[string]bool{}
+		for _, p := range fields.Exclude {
+			if err := validateFieldPath(p); err != nil {
+				return nil, fmt.Errorf("Invalid exclude path for %s: %v", kind, err)
+			}
+			excluded[p] = true
+		}
+		for _, p := range fields.Include {
+			if err := validateFieldPath(p); err != nil {
+				return nil, fmt.Errorf("Invalid include path for %s: %v", kind, err)
+			}
+			if excluded[p] {
+				return nil, fmt.Errorf("Path %q for %s is both included and excluded", p, kind)
+			}
+		}
+		ret[gk] = fields
+	}
+	return ret, nil
+}
+
+func validateFieldPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("empty path")
+	}
+	for _, f := range strings.Split(p, ".") {
+		if f == "" {
+			return fmt.Errorf("%q has an empty field", p)
+		}
+	}
+	return nil
+}
+
+// UnknownKinds returns the kinds in c that the server doesn't
+// serve, sorted.
+func (c CompareConfig) UnknownKinds(disco discovery.ServerResourcesInterface) ([]string, error) {
+	lists, err := disco.ServerResources()
+	if err != nil {
+		return nil, err
+	}
+	known := map[schema.GroupKind]bool{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				// Subresource, eg: deployments/scale
+				continue
+			}
+			known[schema.GroupKind{Group: gv.Group, Kind: r.Kind}] = true
+		}
+	}
+
+	ret := []string{}
+	for gk := range c {
+		if gk != AllKinds && !known[gk] {
+			ret = append(ret, gk.String())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Excludes returns true if the field at path isn't compared.
+func (f CompareFields) Excludes(path string) bool {
+	for _, p := range f.Exclude {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	if len(f.Include) == 0 {
+		return false
+	}
+	for _, p := range f.Include {
+		// Fields leading to an included field are kept too
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(p, path+".") {
+			return false
+		}
+	}
+	return true
+}
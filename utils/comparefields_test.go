@@ -0,0 +1,122 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseCompareConfig(t *testing.T) {
+	config, err := ParseCompareConfig([]byte(`
+Deployment.apps:
+  exclude: [spec.replicas]
+ConfigMap:
+  include: [data]
+`))
+	if err != nil {
+		t.Fatalf("ParseCompareConfig failed: %v", err)
+	}
+	expected := CompareConfig{
+		{Group: "apps", Kind: "Deployment"}: {Exclude: []string{"spec.replicas"}},
+		{Group: "", Kind: "ConfigMap"}:      {Include: []string{"data"}},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Unexpected config %v", config)
+	}
+
+	for _, bad := range []string{
+		`Deployment.apps: {exclude: [""]}`,
+		`Deployment.apps: {exclude: [spec..replicas]}`,
+		`Deployment.apps: {include: [spec], exclude: [spec]}`,
+		`Deployment.apps: [spec.replicas]`,
+		`".apps": {exclude: [spec]}`,
+	} {
+		if _, err := ParseCompareConfig([]byte(bad)); err == nil {
+			t.Errorf("ParseCompareConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCompareConfigUnknownKinds(t *testing.T) {
+	config := CompareConfig{
+		{Group: "apps", Kind: "Deployment"}:   {},
+		{Group: "example.com", Kind: "Gizmo"}: {},
+		{Group: "", Kind: "Widget"}:           {},
+		AllKinds:                              {},
+	}
+	unknown, err := config.UnknownKinds(newFakeDiscovery())
+	if err != nil {
+		t.Fatalf("UnknownKinds failed: %v", err)
+	}
+	if !reflect.DeepEqual(unknown, []string{"Gizmo.example.com", "Widget"}) {
+		t.Errorf("Unexpected unknown kinds %v", unknown)
+	}
+}
+
+func TestCompareFieldsExcludes(t *testing.T) {
+	f := CompareFields{
+		Include: []string{"spec.template"},
+		Exclude: []string{"spec.template.metadata.annotations"},
+	}
+	for path, expected := range map[string]bool{
+		"spec":                                   false,
+		"spec.template":                          false,
+		"spec.template.spec.containers":          false,
+		"spec.replicas":                          true,
+		"status":                                 true,
+		"spec.template.metadata.annotations":     true,
+		"spec.template.metadata.annotations.foo": true,
+	} {
+		if f.Excludes(path) != expected {
+			t.Errorf("Excludes(%q) != %v", path, expected)
+		}
+	}
+}
+
+func TestCompareConfigFor(t *testing.T) {
+	config, err := ParseCompareConfig([]byte(`
+Deployment.apps:
+  exclude: [spec.replicas]
+"*":
+  exclude: [metadata.annotations]
+`))
+	if err != nil {
+		t.Fatalf("ParseCompareConfig failed: %v", err)
+	}
+	config, err = IgnorePaths(config, []string{"metadata.managedFields"})
+	if err != nil {
+		t.Fatalf("IgnorePaths failed: %v", err)
+	}
+
+	deploy := config.For(schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	if !reflect.DeepEqual(deploy.Exclude, []string{"metadata.annotations", "metadata.managedFields", "spec.replicas"}) {
+		t.Errorf("Unexpected Deployment fields %v", deploy)
+	}
+	cm := config.For(schema.GroupKind{Kind: "ConfigMap"})
+	if !reflect.DeepEqual(cm.Exclude, []string{"metadata.annotations", "metadata.managedFields"}) || len(cm.Include) != 0 {
+		t.Errorf("Unexpected ConfigMap fields %v", cm)
+	}
+
+	if _, err := IgnorePaths(nil, []string{"spec..replicas"}); err == nil {
+		t.Errorf("IgnorePaths accepted an invalid path")
+	}
+	if fields := CompareConfig(nil).For(schema.GroupKind{Kind: "ConfigMap"}); len(fields.Exclude) != 0 {
+		t.Errorf("Unexpected fields from an empty config %v", fields)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// Matches characters that might not be valid in a file name
+var unsafeFileChars = regexp.MustCompile(`[^(\w/\.)]`)
+
+// DiscoveryCacheDir returns the directory under parentDir that
+// caches discovery results for the server at host, as kubectl
+// does (eg: ~/.kube/cache/discovery/example.com_6443).
+func DiscoveryCacheDir(parentDir, host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return filepath.Join(parentDir, unsafeFileChars.ReplaceAllString(host, "_"))
+}
+
+// diskCachedDiscoveryClient caches discovery results as files
+// under dir.  Each file is used until it is older than ttl.
+type diskCachedDiscoveryClient struct {
+	cl  discovery.DiscoveryInterface
+	dir string
+	ttl time.Duration
+
+	lock sync.Mutex
+	// fresh is false once anything has been read from disk
+	fresh bool
+}
+
+// NewCachedDiscoveryClient creates a new DiscoveryClient that
+// caches results in memory, and on disk under cacheDir for up to
+// ttl.  Missing, expired or unreadable files are fetched from the
+// server, and rewritten.
+func NewCachedDiscoveryClient(cl discovery.DiscoveryInterface, cacheDir string, ttl time.Duration) discovery.CachedDiscoveryInterface {
+	return newMemcachedDiscoveryClient(&diskCachedDiscoveryClient{
+		cl:    cl,
+		dir:   cacheDir,
+		ttl:   ttl,
+		fresh: true,
+	}, ttl)
+}
+
+// readFile reads the cache file name into v, returning false if it
+// is missing, expired or can't be decoded.
+func (c *diskCachedDiscoveryClient) readFile(name string, decode func([]byte) error) bool {
+	path := filepath.Join(c.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		log.Debugf("Discovery cache %s has expired", path)
+		return false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = decode(data)
+	}
+	if err != nil {
+		log.Debugf("Ignoring discovery cache %s: %v", path, err)
+		return false
+	}
+
+	c.lock.Lock()
+	c.fresh = false
+	c.lock.Unlock()
+	return true
+}
+
+// writeFile replaces the cache file name with data.  Failures only
+// lose the cache, so they are just logged.
+func (c *diskCachedDiscoveryClient) writeFile(name string, data []byte) {
+	path := filepath.Join(c.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		log.Debugf("Unable to write discovery cache: %v", err)
+		return
+	}
+	// Write then rename, so that concurrent readers never see
+	// a partial file.
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		log.Debugf("Unable to write discovery cache: %v", err)
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0660)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		log.Debugf("Unable to write discovery cache %s: %v", path, err)
+	}
+}
+
+func (c *diskCachedDiscoveryClient) writeJSON(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Debugf("Unable to encode discovery cache %s: %v", name, err)
+		return
+	}
+	c.writeFile(name, data)
+}
+
+func (c *diskCachedDiscoveryClient) Fresh() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.fresh
+}
+
+func (c *diskCachedDiscoveryClient) Invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := os.RemoveAll(c.dir); err != nil {
+		log.Debugf("Unable to remove discovery cache: %v", err)
+	}
+	c.fresh = true
+}
+
+func (c *diskCachedDiscoveryClient) RESTClient() rest.Interface {
+	return c.cl.RESTClient()
+}
+
+func (c *diskCachedDiscoveryClient) ServerGroups() (*metav1.APIGroupList, error) {
+	const name = "servergroups.json"
+	groups := &metav1.APIGroupList{}
+	if c.readFile(name, func(data []byte) error { return json.Unmarshal(data, groups) }) {
+		return groups, nil
+	}
+
+	groups, err := c.cl.ServerGroups()
+	if err != nil {
+		return groups, err
+	}
+	// kubectl expects the TypeMeta
+	cached := *groups
+	cached.Kind, cached.APIVersion = "APIGroupList", "v1"
+	c.writeJSON(name, &cached)
+	return groups, nil
+}
+
+func (c *diskCachedDiscoveryClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	name := filepath.Join(filepath.FromSlash(groupVersion), "serverresources.json")
+	resources := &metav1.APIResourceList{}
+	if c.readFile(name, func(data []byte) error { return json.Unmarshal(data, resources) }) {
+		return resources, nil
+	}
+
+	resources, err := c.cl.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return resources, err
+	}
+	cached := *resources
+	cached.Kind, cached.APIVersion = "APIResourceList", "v1"
+	c.writeJSON(name, &cached)
+	return resources, nil
+}
+
+// ServerResources is as for DiscoveryClient, but using the cache
+// for each GroupVersion.
+func (c *diskCachedDiscoveryClient) ServerResources() ([]*metav1.APIResourceList, error) {
+	groups, err := c.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*metav1.APIResourceList{}
+	failed := map[schema.GroupVersion]error{}
+	for _, group := range groups.Groups {
+		for _, v := range group.Versions {
+			resources, err := c.ServerResourcesForGroupVersion(v.GroupVersion)
+			if err != nil {
+				failed[schema.GroupVersion{Group: group.Name, Version: v.Version}] = err
+				continue
+			}
+			result = append(result, resources)
+		}
+	}
+	if len(failed) > 0 {
+		return result, &discovery.ErrGroupDiscoveryFailed{Groups: failed}
+	}
+	return result, nil
+}
+
+func (c *diskCachedDiscoveryClient) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return c.cl.ServerPreferredResources()
+}
+
+func (c *diskCachedDiscoveryClient) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	return c.cl.ServerPreferredNamespacedResources()
+}
+
+func (c *diskCachedDiscoveryClient) ServerVersion() (*version.Info, error) {
+	return c.cl.ServerVersion()
+}
+
+func (c *diskCachedDiscoveryClient) OpenAPISchema() (*openapi_v2.Document, error) {
+	const name = "openapi.pb"
+	doc := &openapi_v2.Document{}
+	if c.readFile(name, func(data []byte) error { return proto.Unmarshal(data, doc) }) {
+		return doc, nil
+	}
+
+	doc, err := c.cl.OpenAPISchema()
+	if err != nil {
+		return nil, err
+	}
+	if data, err := proto.Marshal(doc); err != nil {
+		log.Debugf("Unable to encode discovery cache %s: %v", name, err)
+	} else {
+		c.writeFile(name, data)
+	}
+	return doc, nil
+}
+
+var _ discovery.CachedDiscoveryInterface = &diskCachedDiscoveryClient{}
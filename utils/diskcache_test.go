@@ -0,0 +1,138 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiscoveryCacheDir(t *testing.T) {
+	if d := DiscoveryCacheDir("/cache", "https://example.com:6443"); d != "/cache/example.com_6443" {
+		t.Errorf("Unexpected cache dir %q", d)
+	}
+}
+
+func TestCachedDiscoveryClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubecfg-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := newFakeDiscovery()
+	c := NewCachedDiscoveryClient(fake, dir, time.Hour)
+	if _, err := c.ServerGroups(); err != nil {
+		t.Fatalf("ServerGroups failed: %v", err)
+	}
+	for _, gv := range []string{"v1", "apps/v1"} {
+		if _, err := c.ServerResourcesForGroupVersion(gv); err != nil {
+			t.Fatalf("ServerResourcesForGroupVersion(%s) failed: %v", gv, err)
+		}
+	}
+	if _, err := c.OpenAPISchema(); err != nil {
+		t.Fatalf("OpenAPISchema failed: %v", err)
+	}
+	if !c.Fresh() {
+		t.Errorf("Results from the server aren't fresh")
+	}
+	for _, name := range []string{"servergroups.json", "v1/serverresources.json", "apps/v1/serverresources.json", "openapi.pb"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Cache file %s wasn't written: %v", name, err)
+		}
+	}
+
+	// A new client (ie: the next run) reads from disk
+	fake.ClearActions()
+	c = NewCachedDiscoveryClient(fake, dir, time.Hour)
+	rl, err := c.ServerResourcesForGroupVersion("apps/v1")
+	if err != nil {
+		t.Fatalf("ServerResourcesForGroupVersion failed: %v", err)
+	}
+	if len(rl.APIResources) != 1 || rl.APIResources[0].Kind != "Deployment" {
+		t.Errorf("Unexpected cached resources %v", rl)
+	}
+	if _, err := c.ServerGroups(); err != nil {
+		t.Fatalf("ServerGroups failed: %v", err)
+	}
+	if a := fake.Actions(); len(a) != 0 {
+		t.Errorf("Cached results were fetched from the server: %v", a)
+	}
+	if c.Fresh() {
+		t.Errorf("Results from disk are fresh")
+	}
+
+	// Corrupt or expired files are refetched, without affecting
+	// other files
+	if err := ioutil.WriteFile(filepath.Join(dir, "v1", "serverresources.json"), []byte("{garbage"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "servergroups.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	fake.ClearActions()
+	c = NewCachedDiscoveryClient(fake, dir, time.Hour)
+	if _, err := c.ServerResources(); err != nil {
+		t.Fatalf("ServerResources failed: %v", err)
+	}
+	if a := fake.Actions(); len(a) != 2 {
+		t.Errorf("Expected servergroups and v1 to be refetched, got %v", a)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "v1", "serverresources.json")); err != nil || string(data) == "{garbage" {
+		t.Errorf("Corrupt cache file wasn't replaced: %q %v", data, err)
+	}
+
+	c.Invalidate()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Invalidate didn't remove the cache: %v", err)
+	}
+	if !c.Fresh() {
+		t.Errorf("Invalidated cache isn't fresh")
+	}
+}
+
+func TestCachedDiscoveryRefreshesMissingKind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubecfg-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Cached before Deployments existed
+	if err := os.MkdirAll(filepath.Join(dir, "apps", "v1"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	stale := `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"apps/v1","resources":[]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "apps", "v1", "serverresources.json"), []byte(stale), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCachedDiscoveryClient(newFakeDiscovery(), dir, time.Hour)
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	r, err := serverResourceForGroupVersionKind(c, gvk)
+	if err != nil {
+		t.Fatalf("Error finding %s: %v", gvk, err)
+	}
+	if r.Name != "deployments" {
+		t.Errorf("Unexpected resource %q", r.Name)
+	}
+}
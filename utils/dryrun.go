@@ -0,0 +1,72 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// WithServerDryRun makes every write through clients created from
+// conf a server-side dry run, by adding dryRun=All to each request
+// that isn't a read.  The vendored dynamic client has no other way
+// to pass it.
+func WithServerDryRun(conf *rest.Config) {
+	wrap := conf.WrapTransport
+	conf.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return dryRunRoundTripper{rt: rt}
+	}
+}
+
+type dryRunRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (t dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return t.rt.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify req
+	u := *req.URL
+	q := u.Query()
+	q.Set("dryRun", "All")
+	u.RawQuery = q.Encode()
+	dryRun := *req
+	dryRun.URL = &u
+	return t.rt.RoundTrip(&dryRun)
+}
+
+// CheckServerDryRun returns an error unless the server supports
+// server-side dry run.  Older servers ignore dryRun, and would make
+// the changes.
+func CheckServerDryRun(disco discovery.ServerVersionInterface) error {
+	version, err := FetchVersion(disco)
+	if err != nil {
+		return fmt.Errorf("Unable to check that the server supports server-side dry run: %v", err)
+	}
+	if version.Compare(1, 13) < 0 {
+		return fmt.Errorf("Server-side dry run needs Kubernetes 1.13 or later, but the server is %s.  Use --dry-run=client instead", version)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+	fakedisco "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/rest"
+	ktesting "k8s.io/client-go/testing"
+)
+
+func TestWithServerDryRun(t *testing.T) {
+	queries := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries[r.Method] = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	conf := &rest.Config{Host: srv.URL}
+	wrapped := false
+	conf.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		wrapped = true
+		return rt
+	}
+	WithServerDryRun(conf)
+	rt, err := rest.TransportFor(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+
+	for _, method := range []string{"GET", "PATCH"} {
+		req, err := http.NewRequest(method, srv.URL+"/api/v1/namespaces/default/configmaps/foo?fieldManager=kubecfg", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if !wrapped {
+		t.Error("Existing WrapTransport was dropped")
+	}
+	if queries["GET"] != "fieldManager=kubecfg" {
+		t.Errorf("GET query was %q", queries["GET"])
+	}
+	if queries["PATCH"] != "dryRun=All&fieldManager=kubecfg" {
+		t.Errorf("PATCH query was %q", queries["PATCH"])
+	}
+}
+
+func TestCheckServerDryRun(t *testing.T) {
+	disco := &fakedisco.FakeDiscovery{Fake: &ktesting.Fake{}}
+
+	disco.FakedServerVersion = &version.Info{Major: "1", Minor: "13"}
+	if err := CheckServerDryRun(disco); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	disco.FakedServerVersion = &version.Info{Major: "1", Minor: "12"}
+	if err := CheckServerDryRun(disco); err == nil || !strings.Contains(err.Error(), "server is 1.12") {
+		t.Errorf("Expected 1.12 to be refused, got %v", err)
+	}
+}
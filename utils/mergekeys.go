@@ -0,0 +1,120 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MergeKeys maps the path of a list-of-objects field (eg:
+// "spec.ports") to the fields that identify elements of that list.
+// List items don't contribute to the path, so the ports of every
+// container in a pod are "spec.containers.ports".
+type MergeKeys map[string][]string
+
+// FieldPath returns the path of field within parent.
+func FieldPath(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+// ParseMergeKey parses a merge key declaration of the form
+// "Kind.group:path=key[,key...]", eg: "Widget.example.com:spec.ports=name".
+func ParseMergeKey(s string) (schema.GroupKind, string, []string, error) {
+	i := strings.Index(s, ":")
+	j := strings.LastIndex(s, "=")
+	if i < 0 || j < i {
+		return schema.GroupKind{}, "", nil, fmt.Errorf("Invalid merge key %q, expected Kind.group:path=key[,key...]", s)
+	}
+
+	gk := schema.ParseGroupKind(s[:i])
+	path := strings.TrimPrefix(s[i+1:j], ".")
+	keys := strings.Split(s[j+1:], ",")
+	if gk.Kind == "" || path == "" {
+		return schema.GroupKind{}, "", nil, fmt.Errorf("Invalid merge key %q, expected Kind.group:path=key[,key...]", s)
+	}
+	for _, k := range keys {
+		if k == "" {
+			return schema.GroupKind{}, "", nil, fmt.Errorf("Invalid merge key %q, expected Kind.group:path=key[,key...]", s)
+		}
+	}
+
+	return gk, path, keys, nil
+}
+
+// CRDMergeKeys returns the merge keys declared in the schema of a
+// CustomResourceDefinition for the given version, using the
+// x-kubernetes-list-map-keys or x-kubernetes-patch-merge-key
+// extensions.
+func CRDMergeKeys(crd *unstructured.Unstructured, version string) MergeKeys {
+	s, _, _ := unstructured.NestedMap(crd.Object, "spec", "validation", "openAPIV3Schema")
+
+	// Per-version schemas override the top-level one
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok || v["name"] != version {
+			continue
+		}
+		if vs, ok, _ := unstructured.NestedMap(v, "schema", "openAPIV3Schema"); ok {
+			s = vs
+		}
+	}
+
+	keys := MergeKeys{}
+	walkSchemaMergeKeys(s, "", keys)
+	return keys
+}
+
+func walkSchemaMergeKeys(s map[string]interface{}, path string, keys MergeKeys) {
+	if props, ok := s["properties"].(map[string]interface{}); ok {
+		for name, p := range props {
+			if p, ok := p.(map[string]interface{}); ok {
+				walkSchemaMergeKeys(p, FieldPath(path, name), keys)
+			}
+		}
+	}
+	if items, ok := s["items"].(map[string]interface{}); ok {
+		if k := schemaMergeKeys(s); len(k) > 0 {
+			keys[path] = k
+		}
+		walkSchemaMergeKeys(items, path, keys)
+	}
+}
+
+func schemaMergeKeys(s map[string]interface{}) []string {
+	if s["x-kubernetes-list-type"] == "map" {
+		if list, ok := s["x-kubernetes-list-map-keys"].([]interface{}); ok {
+			ret := make([]string, 0, len(list))
+			for _, k := range list {
+				if k, ok := k.(string); ok {
+					ret = append(ret, k)
+				}
+			}
+			return ret
+		}
+	}
+	if k, ok := s["x-kubernetes-patch-merge-key"].(string); ok && k != "" {
+		return []string{k}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseMergeKey(t *testing.T) {
+	gk, path, keys, err := ParseMergeKey("Widget.example.com:.spec.ports=name,protocol")
+	if err != nil {
+		t.Fatalf("ParseMergeKey failed: %v", err)
+	}
+	if gk != (schema.GroupKind{Group: "example.com", Kind: "Widget"}) {
+		t.Errorf("Unexpected GroupKind %v", gk)
+	}
+	if path != "spec.ports" {
+		t.Errorf("Unexpected path %q", path)
+	}
+	if !reflect.DeepEqual(keys, []string{"name", "protocol"}) {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	for _, bad := range []string{"Widget.example.com", "Widget:spec.ports", ":spec.ports=name", "Widget:=name", "Widget:spec.ports=name,"} {
+		if _, _, _, err := ParseMergeKey(bad); err == nil {
+			t.Errorf("ParseMergeKey(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCRDMergeKeys(t *testing.T) {
+	listOf := func(ext map[string]interface{}, props map[string]interface{}) map[string]interface{} {
+		ret := map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":       "object",
+				"properties": props,
+			},
+		}
+		for k, v := range ext {
+			ret[k] = v
+		}
+		return ret
+	}
+	ports := listOf(map[string]interface{}{
+		"x-kubernetes-list-type":     "map",
+		"x-kubernetes-list-map-keys": []interface{}{"port", "protocol"},
+	}, nil)
+	members := listOf(map[string]interface{}{
+		"x-kubernetes-patch-merge-key": "name",
+	}, map[string]interface{}{"ports": ports})
+
+	crd := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"validation": map[string]interface{}{
+					"openAPIV3Schema": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"spec": map[string]interface{}{
+								"properties": map[string]interface{}{
+									"members": members,
+									"tags":    listOf(nil, nil),
+								},
+							},
+						},
+					},
+				},
+				"versions": []interface{}{
+					map[string]interface{}{
+						"name": "v2",
+						"schema": map[string]interface{}{
+							"openAPIV3Schema": map[string]interface{}{
+								"properties": map[string]interface{}{
+									"ports": ports,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected := MergeKeys{
+		"spec.members":       {"name"},
+		"spec.members.ports": {"port", "protocol"},
+	}
+	if keys := CRDMergeKeys(crd, "v1"); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+
+	expected = MergeKeys{"ports": {"port", "protocol"}}
+	if keys := CRDMergeKeys(crd, "v2"); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+}
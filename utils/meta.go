@@ -121,6 +121,37 @@ func SetMetaDataLabel(obj metav1.Object, key, value string) {
 	obj.SetLabels(l)
 }
 
+// MergeMetaDataLabels adds labels to obj.  Labels that obj already
+// has are kept, unless overwrite is true.
+func MergeMetaDataLabels(obj metav1.Object, labels map[string]string, overwrite bool) {
+	if len(labels) == 0 {
+		return
+	}
+	obj.SetLabels(mergeStringMap(obj.GetLabels(), labels, overwrite))
+}
+
+// MergeMetaDataAnnotations adds annotations to obj.  Annotations
+// that obj already has are kept, unless overwrite is true.
+func MergeMetaDataAnnotations(obj metav1.Object, annotations map[string]string, overwrite bool) {
+	if len(annotations) == 0 {
+		return
+	}
+	obj.SetAnnotations(mergeStringMap(obj.GetAnnotations(), annotations, overwrite))
+}
+
+func mergeStringMap(dst, src map[string]string, overwrite bool) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; ok && !overwrite {
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
 // ResourceNameFor returns a lowercase plural form of a type, for
 // human messages.  Returns lowercased kind if discovery lookup fails.
 func ResourceNameFor(disco discovery.ServerResourcesInterface, o runtime.Object) string {
@@ -131,10 +162,8 @@ func ResourceNameFor(disco discovery.ServerResourcesInterface, o runtime.Object)
 		return strings.ToLower(gvk.Kind)
 	}
 
-	for _, rl := range rls.APIResources {
-		if rl.Kind == gvk.Kind {
-			return rl.Name
-		}
+	if r := primaryResource(rls, gvk.Kind); r != nil {
+		return r.Name
 	}
 
 	log.Debugf("Discovery failed to find %s, falling back to kind", gvk)
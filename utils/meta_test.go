@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"reflect"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -159,3 +160,26 @@ func TestFqName(t *testing.T) {
 		t.Errorf("Got %q for %v", n, obj)
 	}
 }
+
+func TestMergeMetaDataLabels(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetLabels(map[string]string{"env": "config"})
+
+	MergeMetaDataLabels(obj, map[string]string{"env": "flag", "team": "a"}, false)
+	expected := map[string]string{"env": "config", "team": "a"}
+	if !reflect.DeepEqual(obj.GetLabels(), expected) {
+		t.Errorf("Expected %v, got %v", expected, obj.GetLabels())
+	}
+
+	MergeMetaDataLabels(obj, map[string]string{"env": "flag"}, true)
+	expected = map[string]string{"env": "flag", "team": "a"}
+	if !reflect.DeepEqual(obj.GetLabels(), expected) {
+		t.Errorf("Expected %v, got %v", expected, obj.GetLabels())
+	}
+
+	MergeMetaDataAnnotations(obj, map[string]string{"commit": "abc"}, false)
+	expected = map[string]string{"commit": "abc"}
+	if !reflect.DeepEqual(obj.GetAnnotations(), expected) {
+		t.Errorf("Expected %v, got %v", expected, obj.GetAnnotations())
+	}
+}
@@ -17,7 +17,9 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io"
 	"regexp"
 	"strings"
@@ -140,4 +142,18 @@ func RegisterNativeFuncs(vm *jsonnet.VM, resolver Resolver) {
 			return r.ReplaceAllString(src, repl), nil
 		},
 	})
+
+	vm.NativeFunction(&jsonnet.NativeFunction{
+		Name:   "hashObject",
+		Params: []jsonnetAst.Identifier{"obj"},
+		Func: func(args []interface{}) (res interface{}, err error) {
+			// encoding/json sorts object keys, so the hash
+			// doesn't depend on field order
+			data, err := json.Marshal(args[0])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+		},
+	})
 }
@@ -102,3 +102,19 @@ func TestRegexSubst(t *testing.T) {
 	x, err = vm.EvaluateSnippet("test", `std.native("regexSubst")("a(x*)b", "-ab-axxb-", "${1}W")`)
 	check(t, err, x, "\"-W-xxW-\"\n")
 }
+
+func TestHashObject(t *testing.T) {
+	vm := jsonnet.MakeVM()
+	RegisterNativeFuncs(vm, NewIdentityResolver())
+
+	x, err := vm.EvaluateSnippet("test", `std.native("hashObject")({b: 2, a: [1, {d: "x", c: null}]})`)
+	y, err2 := vm.EvaluateSnippet("test", `std.native("hashObject")({a: [1, {c: null, d: "x"}], b: 2})`)
+	if err != nil || err2 != nil {
+		t.Fatalf("hashObject failed: %v, %v", err, err2)
+	}
+	check(t, nil, x, y)
+
+	// sha256 of `{"a":1}`
+	x, err = vm.EvaluateSnippet("test", `std.native("hashObject")({a: 1})`)
+	check(t, err, x, "\"015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862\"\n")
+}
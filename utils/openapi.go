@@ -17,6 +17,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -33,14 +34,60 @@ type OpenAPISchema struct {
 	schema proto.Schema
 }
 
-// NewOpenAPISchemaFor returns the OpenAPISchema object ready to validate objects of given GroupVersion
-func NewOpenAPISchemaFor(delegate discovery.OpenAPISchemaInterface, gvk schema.GroupVersionKind) (*OpenAPISchema, error) {
-	log.Debugf("Fetching schema for %v", gvk)
+// openAPIResourcesGetter is implemented by discovery clients that
+// cache the parsed form of the OpenAPI document.
+type openAPIResourcesGetter interface {
+	openAPIResources() (openapi.Resources, error)
+}
+
+// openAPIResourcesFor returns the parsed OpenAPI document from
+// delegate, reusing a cached copy when delegate provides one.
+func openAPIResourcesFor(delegate discovery.OpenAPISchemaInterface) (openapi.Resources, error) {
+	if g, ok := delegate.(openAPIResourcesGetter); ok {
+		return g.openAPIResources()
+	}
+
 	doc, err := delegate.OpenAPISchema()
 	if err != nil {
 		return nil, err
 	}
-	res, err := openapi.NewOpenAPIData(doc)
+	return openapi.NewOpenAPIData(doc)
+}
+
+// openAPIV3ResourcesGetter is implemented by discovery clients that
+// cache the parsed forms of the OpenAPI v3 documents.
+type openAPIV3ResourcesGetter interface {
+	openAPIV3Resources(path string) (openapi.Resources, error)
+}
+
+// openAPIV3SchemaFor returns the schema for gvk from its OpenAPI v3
+// document, or nil if there isn't one.
+func openAPIV3SchemaFor(delegate discovery.OpenAPISchemaInterface, gvk schema.GroupVersionKind) proto.Schema {
+	g, ok := delegate.(openAPIV3ResourcesGetter)
+	if !ok {
+		return nil
+	}
+	path := OpenAPIV3Path(gvk.GroupVersion())
+	res, err := g.openAPIV3Resources(path)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.Debugf("Unable to use OpenAPI v3 schema for %v, falling back to v2: %v", gvk, err)
+		}
+		return nil
+	}
+	return res.LookupResource(gvk)
+}
+
+// NewOpenAPISchemaFor returns the OpenAPISchema object ready to validate objects of given GroupVersion.
+// The server's OpenAPI v3 schema is preferred, since its aggregated
+// v2 document loses parts of CRD schemas.
+func NewOpenAPISchemaFor(delegate discovery.OpenAPISchemaInterface, gvk schema.GroupVersionKind) (*OpenAPISchema, error) {
+	log.Debugf("Fetching schema for %v", gvk)
+	if sc := openAPIV3SchemaFor(delegate, gvk); sc != nil {
+		return &OpenAPISchema{schema: sc}, nil
+	}
+
+	res, err := openAPIResourcesFor(delegate)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +104,89 @@ func NewOpenAPISchemaFor(delegate discovery.OpenAPISchemaInterface, gvk schema.G
 	return &OpenAPISchema{schema: sc}, nil
 }
 
+// modelName is the name Validate gives obj's root in error paths
+func modelName(obj *unstructured.Unstructured) string {
+	gvk := obj.GroupVersionKind()
+	return fmt.Sprintf("%s.%s", gvk.Version, gvk.Kind)
+}
+
 // Validate is the primary entrypoint into this class
 func (s *OpenAPISchema) Validate(obj *unstructured.Unstructured) []error {
 	gvk := obj.GroupVersionKind()
 	log.Infof("validate object %q", gvk)
-	return validation.ValidateModel(obj.UnstructuredContent(), s.schema, fmt.Sprintf("%s.%s", gvk.Version, gvk.Kind))
+	return validation.ValidateModel(obj.UnstructuredContent(), s.schema, modelName(obj))
+}
+
+// ValidateFields is Validate, but with each schema violation given
+// as a FieldError.  Other errors are returned unchanged.
+func (s *OpenAPISchema) ValidateFields(obj *unstructured.Unstructured) []error {
+	errs := s.Validate(obj)
+	root := modelName(obj)
+	for i, err := range errs {
+		if ferr, ok := newFieldError(root, err); ok {
+			errs[i] = ferr
+		}
+	}
+	return errs
+}
+
+// FieldErrorType is the kind of schema violation a FieldError reports
+type FieldErrorType string
+
+// The kinds of FieldError
+const (
+	FieldMissing FieldErrorType = "missing required field"
+	FieldUnknown FieldErrorType = "unknown field"
+	FieldInvalid FieldErrorType = "wrong type for field"
+)
+
+// FieldError is a schema violation at Path, the path of the field
+// within the object (eg: spec.containers[0].image).
+type FieldError struct {
+	Type FieldErrorType
+	Path string
+	// Detail says what was wrong, for FieldInvalid
+	Detail string
+}
+
+func (e FieldError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s %s", e.Type, e.Path)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Type, e.Path, e.Detail)
+}
+
+// newFieldError converts err, from validating the object named root,
+// to a FieldError, if it is a schema violation.
+func newFieldError(root string, err error) (FieldError, bool) {
+	verr, ok := err.(validation.ValidationError)
+	if !ok {
+		return FieldError{}, false
+	}
+	// Paths start with the model, eg: "v1.Pod.spec"
+	relative := func(p string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(p, root), ".")
+	}
+	path := relative(verr.Path)
+	field := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch e := verr.Err.(type) {
+	case validation.MissingRequiredFieldError:
+		return FieldError{Type: FieldMissing, Path: field(e.Field)}, true
+	case validation.UnknownFieldError:
+		return FieldError{Type: FieldUnknown, Path: field(e.Field)}, true
+	case validation.InvalidTypeError:
+		detail := fmt.Sprintf("got %s, expected %s", e.Actual, e.Expected)
+		return FieldError{Type: FieldInvalid, Path: path, Detail: detail}, true
+	case validation.InvalidObjectTypeError:
+		// e.Path is the array element
+		detail := fmt.Sprintf("got %s", e.Type)
+		return FieldError{Type: FieldInvalid, Path: relative(e.Path), Detail: detail}, true
+	}
+	return FieldError{}, false
 }
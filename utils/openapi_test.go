@@ -26,6 +26,9 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	ktesting "k8s.io/client-go/testing"
 )
 
 type schemaFromFile struct {
@@ -44,6 +47,76 @@ func (s schemaFromFile) OpenAPISchema() (*openapi_v2.Document, error) {
 	return &doc, nil
 }
 
+// schemaDiscovery is a fake DiscoveryInterface that serves the
+// OpenAPI document from schemaFromFile.
+type schemaDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	schemaFromFile
+}
+
+func (d schemaDiscovery) OpenAPISchema() (*openapi_v2.Document, error) {
+	return d.schemaFromFile.OpenAPISchema()
+}
+
+func newSchemaDiscovery(dir string) schemaDiscovery {
+	return schemaDiscovery{
+		FakeDiscovery:  &fakediscovery.FakeDiscovery{Fake: &ktesting.Fake{}},
+		schemaFromFile: schemaFromFile{dir: dir},
+	}
+}
+
+var benchmarkGVKs = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "Service"},
+	{Version: "v1", Kind: "ConfigMap"},
+	{Group: "apps", Version: "v1beta1", Kind: "Deployment"},
+	{Group: "extensions", Version: "v1beta1", Kind: "Ingress"},
+}
+
+func benchmarkNewOpenAPISchemaFor(b *testing.B, delegate discovery.OpenAPISchemaInterface) {
+	for i := 0; i < b.N; i++ {
+		for _, gvk := range benchmarkGVKs {
+			if _, err := NewOpenAPISchemaFor(delegate, gvk); err != nil {
+				b.Fatalf("Error reading schema for %s: %v", gvk, err)
+			}
+		}
+	}
+}
+
+func BenchmarkNewOpenAPISchemaForUncached(b *testing.B) {
+	benchmarkNewOpenAPISchemaFor(b, schemaFromFile{dir: filepath.FromSlash("../testdata")})
+}
+
+func BenchmarkNewOpenAPISchemaForMemcached(b *testing.B) {
+	disco := NewMemcachedDiscoveryClient(newSchemaDiscovery(filepath.FromSlash("../testdata")), 0)
+	benchmarkNewOpenAPISchemaFor(b, disco)
+}
+
+func TestValidateMemcached(t *testing.T) {
+	disco := NewMemcachedDiscoveryClient(newSchemaDiscovery(filepath.FromSlash("../testdata")), 0)
+	for _, gvk := range benchmarkGVKs {
+		if _, err := NewOpenAPISchemaFor(disco, gvk); err != nil {
+			t.Errorf("Error reading schema for %s: %v", gvk, err)
+		}
+	}
+
+	c := disco.(*memcachedDiscoveryClient)
+	res := c.resources
+	if res == nil {
+		t.Fatalf("Parsed schema was not cached")
+	}
+	if _, err := NewOpenAPISchemaFor(disco, benchmarkGVKs[0]); err != nil {
+		t.Fatalf("Error reading schema: %v", err)
+	}
+	if c.resources != res {
+		t.Errorf("Parsed schema was not reused")
+	}
+
+	disco.Invalidate()
+	if c.resources != nil {
+		t.Errorf("Invalidate() did not clear the parsed schema")
+	}
+}
+
 func TestValidate(t *testing.T) {
 	schemaReader := schemaFromFile{dir: filepath.FromSlash("../testdata")}
 	s, err := NewOpenAPISchemaFor(schemaReader, schema.GroupVersionKind{Version: "v1", Kind: "Service"})
@@ -92,3 +165,42 @@ func TestValidate(t *testing.T) {
 		t.Errorf("Wrong error2 produced from invalid object: %q", err)
 	}
 }
+
+func TestValidateFields(t *testing.T) {
+	schemaReader := schemaFromFile{dir: filepath.FromSlash("../testdata")}
+	s, err := NewOpenAPISchemaFor(schemaReader, schema.GroupVersionKind{Version: "v1", Kind: "Pod"})
+	if err != nil {
+		t.Fatalf("Error reading schema: %v", err)
+	}
+
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"bogus":      true,
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"image": map[string]interface{}{}},
+				},
+			},
+		},
+	}
+	expected := map[FieldError]bool{
+		{Type: FieldUnknown, Path: "bogus"}:                                                        true,
+		{Type: FieldMissing, Path: "spec.containers[0].name"}:                                      true,
+		{Type: FieldInvalid, Path: "spec.containers[0].image", Detail: "got map, expected string"}: true,
+	}
+	errs := s.ValidateFields(obj)
+	for _, err := range errs {
+		ferr, ok := err.(FieldError)
+		if !ok {
+			t.Errorf("Unexpected error %#v", err)
+		} else if !expected[ferr] {
+			t.Errorf("Unexpected field error %q", ferr)
+		}
+		delete(expected, ferr)
+	}
+	for ferr := range expected {
+		t.Errorf("Missing field error %q", ferr)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/kubectl/cmd/util/openapi"
+)
+
+const openAPIV3Root = "/openapi/v3"
+
+// OpenAPIV3Interface is implemented by discovery clients that can
+// fetch the server's OpenAPI v3 documents.
+type OpenAPIV3Interface interface {
+	// OpenAPIV3Schema returns the JSON OpenAPI v3 document for
+	// the GroupVersion at path (see OpenAPIV3Path), or a NotFound
+	// error if the server doesn't serve one.
+	OpenAPIV3Schema(path string) ([]byte, error)
+}
+
+// OpenAPIV3Path returns the path of gv's OpenAPI v3 document,
+// relative to /openapi/v3 (eg: "apis/apps/v1").
+func OpenAPIV3Path(gv schema.GroupVersion) string {
+	if gv.Group == "" {
+		return "api/" + gv.Version
+	}
+	return "apis/" + gv.String()
+}
+
+var openAPIV3Resource = schema.GroupResource{Group: "schema", Resource: "openapi/v3"}
+
+// fetchOpenAPIV3Index returns the server's OpenAPI v3 documents, as
+// a map from path to URL.  Servers before 1.23 (or without the
+// feature enabled) return NotFound.
+func fetchOpenAPIV3Index(rc rest.Interface) (map[string]string, error) {
+	if rc == nil {
+		return nil, errors.NewNotFound(openAPIV3Resource, "")
+	}
+	b, err := rc.Get().AbsPath(openAPIV3Root).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var index struct {
+		Paths map[string]struct {
+			ServerRelativeURL string `json:"serverRelativeURL"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("Error decoding %s: %v", openAPIV3Root, err)
+	}
+	ret := make(map[string]string, len(index.Paths))
+	for path, p := range index.Paths {
+		ret[path] = p.ServerRelativeURL
+	}
+	return ret, nil
+}
+
+// fetchOpenAPIV3 fetches the document at ref (from the index),
+// which is relative to the server and may include a query.
+func fetchOpenAPIV3(rc rest.Interface, ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid OpenAPI v3 document URL %q: %v", ref, err)
+	}
+	req := rc.Get().AbsPath(u.Path).SetHeader("Accept", "application/json")
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			req = req.Param(k, v)
+		}
+	}
+	return req.Do().Raw()
+}
+
+// openAPIV3Resources parses an OpenAPI v3 document for use by the
+// (v2) validator.
+func openAPIV3Resources(doc []byte) (openapi.Resources, error) {
+	v2, err := openAPIV3ToV2(doc)
+	if err != nil {
+		return nil, err
+	}
+	return openapi.NewOpenAPIData(v2)
+}
+
+// openAPIV3ToV2 converts the schemas of an OpenAPI v3 document to a
+// v2 document, keeping what the validator understands.  Unlike the
+// server's own v2 document, this keeps the structural schemas of
+// CRDs, except for constructs v2 can't express (eg: anyOf).
+func openAPIV3ToV2(doc []byte) (*openapi_v2.Document, error) {
+	var v3 struct {
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(doc, &v3); err != nil {
+		return nil, fmt.Errorf("Error decoding OpenAPI v3 document: %v", err)
+	}
+
+	definitions := make(map[string]interface{}, len(v3.Components.Schemas))
+	for name, s := range v3.Components.Schemas {
+		definitions[name] = v2Schema(s)
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"swagger":     "2.0",
+		"info":        map[string]interface{}{"title": "Kubernetes", "version": "v3"},
+		"paths":       map[string]interface{}{},
+		"definitions": definitions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// No filename, since gnostic caches documents by name
+	info, err := compiler.ReadInfoFromBytes("", b)
+	if err != nil {
+		return nil, err
+	}
+	return openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+}
+
+// v2SchemaKeys are the schema fields allowed by OpenAPI v2, other
+// than extensions
+var v2SchemaKeys = map[string]bool{
+	"$ref": true, "additionalProperties": true, "allOf": true, "default": true,
+	"description": true, "enum": true, "example": true, "exclusiveMaximum": true,
+	"exclusiveMinimum": true, "format": true, "items": true, "maxItems": true,
+	"maxLength": true, "maxProperties": true, "maximum": true, "minItems": true,
+	"minLength": true, "minProperties": true, "minimum": true, "multipleOf": true,
+	"pattern": true, "properties": true, "readOnly": true, "required": true,
+	"title": true, "type": true, "uniqueItems": true,
+}
+
+// v2Schema converts an OpenAPI v3 schema to v2, in the shape the
+// old vendored schema parser expects.
+func v2Schema(v interface{}) interface{} {
+	s, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	// References with siblings are wrapped in a single allOf
+	if allOf, ok := s["allOf"].([]interface{}); ok && len(allOf) == 1 {
+		if sub, ok := allOf[0].(map[string]interface{}); ok {
+			merged := make(map[string]interface{}, len(s)+len(sub))
+			for k, v := range s {
+				if k != "allOf" {
+					merged[k] = v
+				}
+			}
+			for k, v := range sub {
+				merged[k] = v
+			}
+			s = merged
+		}
+	}
+
+	ret := map[string]interface{}{}
+	for k, v := range s {
+		if v2SchemaKeys[k] || strings.HasPrefix(k, "x-") {
+			ret[k] = v
+		}
+	}
+
+	if ref, ok := ret["$ref"].(string); ok {
+		ret["$ref"] = strings.Replace(ref, "#/components/schemas/", "#/definitions/", 1)
+	}
+	if props, ok := ret["properties"].(map[string]interface{}); ok {
+		converted := make(map[string]interface{}, len(props))
+		for name, p := range props {
+			converted[name] = v2Schema(p)
+		}
+		ret["properties"] = converted
+	}
+	if items, ok := ret["items"]; ok {
+		ret["items"] = v2Schema(items)
+	}
+	if add, ok := ret["additionalProperties"].(map[string]interface{}); ok {
+		ret["additionalProperties"] = v2Schema(add)
+	}
+	if allOf, ok := ret["allOf"].([]interface{}); ok {
+		converted := make([]interface{}, len(allOf))
+		for i, sub := range allOf {
+			converted[i] = v2Schema(sub)
+		}
+		ret["allOf"] = converted
+	}
+
+	if ret["x-kubernetes-int-or-string"] == true {
+		// As IntOrString is in the v2 document
+		ret["type"] = "string"
+		ret["format"] = "int-or-string"
+	}
+	if ret["x-kubernetes-preserve-unknown-fields"] == true {
+		// The validator would reject the unknown fields
+		delete(ret, "type")
+		delete(ret, "properties")
+		delete(ret, "required")
+	}
+
+	// The parser takes "object" to mean a map, and "array" to
+	// need items, so leave the type of other objects and arrays
+	// unset, as the v2 document does.
+	switch ret["type"] {
+	case "object":
+		if _, ok := ret["additionalProperties"].(map[string]interface{}); !ok {
+			delete(ret, "type")
+			if add, ok := ret["additionalProperties"].(bool); ok && add {
+				delete(ret, "properties")
+			}
+			delete(ret, "additionalProperties")
+		}
+	case "array":
+		if _, ok := ret["items"].(map[string]interface{}); !ok {
+			delete(ret, "type")
+			delete(ret, "items")
+		}
+	}
+	return ret
+}
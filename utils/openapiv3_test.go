@@ -0,0 +1,204 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// widgetV3 is the OpenAPI v3 document of a structural CRD
+const widgetV3 = `{
+  "openapi": "3.0.0",
+  "components": {"schemas": {
+    "com.example.v1.Widget": {
+      "type": "object",
+      "required": ["spec"],
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}], "default": {}},
+        "spec": {
+          "type": "object",
+          "required": ["size"],
+          "properties": {
+            "size": {"type": "integer"},
+            "port": {"x-kubernetes-int-or-string": true, "anyOf": [{"type": "integer"}, {"type": "string"}]},
+            "note": {"type": "string", "nullable": true},
+            "tags": {"type": "array", "items": {"type": "string"}},
+            "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+            "extra": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+          }
+        }
+      },
+      "x-kubernetes-group-version-kind": [{"group": "example.com", "kind": "Widget", "version": "v1"}]
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "type": "object",
+      "properties": {"name": {"type": "string"}}
+    }
+  }}
+}`
+
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+func widget(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec":       spec,
+		},
+	}
+}
+
+func TestOpenAPIV3Path(t *testing.T) {
+	if p := OpenAPIV3Path(schema.GroupVersion{Version: "v1"}); p != "api/v1" {
+		t.Errorf("Unexpected core path %q", p)
+	}
+	if p := OpenAPIV3Path(schema.GroupVersion{Group: "apps", Version: "v1"}); p != "apis/apps/v1" {
+		t.Errorf("Unexpected path %q", p)
+	}
+}
+
+func TestOpenAPIV3Validation(t *testing.T) {
+	res, err := openAPIV3Resources([]byte(widgetV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := res.LookupResource(widgetGVK)
+	if sc == nil {
+		t.Fatal("Widget not found in converted document")
+	}
+	s := &OpenAPISchema{schema: sc}
+
+	valid := widget(map[string]interface{}{
+		"size":   int64(3),
+		"port":   "http",
+		"note":   nil,
+		"tags":   []interface{}{"a"},
+		"labels": map[string]interface{}{"a": "b"},
+		"extra":  map[string]interface{}{"anything": []interface{}{int64(1)}},
+	})
+	if errs := s.Validate(valid); len(errs) != 0 {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	invalid := widget(map[string]interface{}{
+		"size":  "big",
+		"bogus": true,
+	})
+	invalid.Object["metadata"] = map[string]interface{}{"name": "foo", "nom": "bar"}
+	errs := s.Validate(invalid)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	text := strings.Join(msgs, "\n")
+	for _, expected := range []string{"spec.size): invalid type", `"bogus"`, `"nom"`} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected an error about %s, got %s", expected, text)
+		}
+	}
+}
+
+func TestMemcachedOpenAPIV3(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/openapi/v3":
+			fmt.Fprint(w, `{"paths": {"apis/example.com/v1": {"serverRelativeURL": "/openapi/v3/apis/example.com/v1?hash=abc"}}}`)
+		case "/openapi/v3/apis/example.com/v1":
+			if r.URL.Query().Get("hash") != "abc" {
+				t.Errorf("Document fetched without its hash: %s", r.URL)
+			}
+			fmt.Fprint(w, widgetV3)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	disco, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewMemcachedDiscoveryClient(disco, 0)
+
+	for i := 0; i < 2; i++ {
+		s, err := NewOpenAPISchemaFor(c, widgetGVK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := s.Validate(widget(map[string]interface{}{})); len(errs) != 1 {
+			t.Errorf("Expected a missing size, got %v", errs)
+		}
+	}
+	if requests["/openapi/v3"] != 1 || requests["/openapi/v3/apis/example.com/v1"] != 1 {
+		t.Errorf("Expected each document to be fetched once, got %v", requests)
+	}
+
+	if _, err := c.(OpenAPIV3Interface).OpenAPIV3Schema("apis/apps/v1"); !errors.IsNotFound(err) {
+		t.Errorf("Expected NotFound for a missing document, got %v", err)
+	}
+
+	c.Invalidate()
+	if _, err := c.(OpenAPIV3Interface).OpenAPIV3Schema("apis/example.com/v1"); err != nil {
+		t.Fatal(err)
+	}
+	if requests["/openapi/v3"] != 2 || requests["/openapi/v3/apis/example.com/v1"] != 2 {
+		t.Errorf("Invalidate didn't clear the documents: %v", requests)
+	}
+}
+
+func TestMemcachedOpenAPIV3Unsupported(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	disco, err := discovery.NewDiscoveryClientForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewMemcachedDiscoveryClient(disco, 0).(OpenAPIV3Interface)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.OpenAPIV3Schema("api/v1"); !errors.IsNotFound(err) {
+			t.Errorf("Expected NotFound, got %v", err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the missing index to be remembered, got %d requests", requests)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+)
+
+// DefaultDiscoveryConcurrency is the default number of concurrent
+// discovery requests issued by PrefetchResources.
+const DefaultDiscoveryConcurrency = 4
+
+// PrefetchResources warms the (typically memcached) disco with the
+// resource lists of every GroupVersion referenced by objs, issuing
+// at most concurrency requests at a time.  Failures are not fatal:
+// the affected GroupVersions are simply looked up again (and any
+// error reported) when first used.
+//
+// If timeout is positive, PrefetchResources returns once it has
+// elapsed, and GroupVersions not yet fetched are left to be looked
+// up when first used.  It returns the GroupVersions that were
+// fetched, and those that were deferred.
+func PrefetchResources(disco discovery.ServerResourcesInterface, objs []*unstructured.Unstructured, concurrency int, timeout time.Duration) (prefetched, deferred []string) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	gvs := sets.NewString()
+	for _, obj := range objs {
+		gvs.Insert(obj.GroupVersionKind().GroupVersion().String())
+	}
+
+	log.Debugf("Prefetching discovery information for %d GroupVersions", gvs.Len())
+
+	expired := make(chan struct{})
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { close(expired) })
+		defer timer.Stop()
+	}
+
+	var lock sync.Mutex
+	fetched := sets.NewString()
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gv := range work {
+				if _, err := disco.ServerResourcesForGroupVersion(gv); err != nil {
+					log.Debugf("Prefetching %s failed: %v", gv, err)
+				}
+				lock.Lock()
+				fetched.Insert(gv)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(work)
+		for _, gv := range gvs.List() {
+			select {
+			case work <- gv:
+			case <-expired:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-expired:
+		// Requests in flight can't be cancelled, but are
+		// left to finish (and fill the cache) in the
+		// background.
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	prefetched = fetched.List()
+	deferred = gvs.Difference(fetched).List()
+	if len(deferred) > 0 {
+		log.Infof("Discovery prefetch timed out after %s, deferring %s", timeout, strings.Join(deferred, ", "))
+	}
+	log.Debugf("Prefetched discovery information for %s", strings.Join(prefetched, ", "))
+	return prefetched, deferred
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	goyaml "github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ContainerResources are requests and limits, as in a container's
+// "resources" field.
+type ContainerResources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+// ResourceDefaults are the requests and limits given to containers
+// that don't set their own.
+type ResourceDefaults struct {
+	Default ContainerResources `json:"default"`
+	// Namespaces override Default for individual resources
+	// (eg: just "memory") in a namespace.
+	Namespaces map[string]ContainerResources `json:"namespaces,omitempty"`
+}
+
+// podSpecPaths locate the pod specs of each kind
+var podSpecPaths = map[schema.GroupKind][]string{
+	{Group: "", Kind: "Pod"}:                   {"spec"},
+	{Group: "", Kind: "PodTemplate"}:           {"template", "spec"},
+	{Group: "", Kind: "ReplicationController"}: {"spec", "template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:       {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:         {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "Deployment"}:  {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "ReplicaSet"}:  {"spec", "template", "spec"},
+	{Group: "extensions", Kind: "DaemonSet"}:   {"spec", "template", "spec"},
+	{Group: "batch", Kind: "Job"}:              {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:          {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ReadResourceDefaults reads a YAML or JSON file of default
+// container resources.
+func ReadResourceDefaults(path string) (*ResourceDefaults, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResourceDefaults(data)
+}
+
+// ParseResourceDefaults parses and validates default container
+// resources.
+func ParseResourceDefaults(data []byte) (*ResourceDefaults, error) {
+	var d ResourceDefaults
+	if err := goyaml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("Error parsing resource defaults: %v", err)
+	}
+	if err := d.Default.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid default resources: %v", err)
+	}
+	for ns := range d.Namespaces {
+		if err := d.forNamespace(ns).validate(); err != nil {
+			return nil, fmt.Errorf("Invalid resources for namespace %s: %v", ns, err)
+		}
+	}
+	return &d, nil
+}
+
+func (r ContainerResources) validate() error {
+	for _, m := range []map[string]string{r.Requests, r.Limits} {
+		for name, v := range m {
+			if _, err := resource.ParseQuantity(v); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	for name, req := range r.Requests {
+		if limit, ok := r.Limits[name]; ok && quantityLess(limit, req) {
+			return fmt.Errorf("%s request %s is greater than its limit %s", name, req, limit)
+		}
+	}
+	return nil
+}
+
+// forNamespace returns the defaults for containers in namespace.
+func (d *ResourceDefaults) forNamespace(namespace string) ContainerResources {
+	ns, ok := d.Namespaces[namespace]
+	if !ok {
+		return d.Default
+	}
+	return ContainerResources{
+		Requests: mergeStringMap(mergeStringMap(nil, d.Default.Requests, false), ns.Requests, true),
+		Limits:   mergeStringMap(mergeStringMap(nil, d.Default.Limits, false), ns.Limits, true),
+	}
+}
+
+// Apply sets default requests and limits on the containers of obj
+// that don't set their own.  Objects without a namespace are
+// assumed to be in defaultNs.
+func (d *ResourceDefaults) Apply(obj *unstructured.Unstructured, defaultNs string) error {
+	path, ok := podSpecPaths[obj.GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil
+	}
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = defaultNs
+	}
+	defaults := d.forNamespace(namespace)
+
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, found, err := unstructured.NestedSlice(obj.Object, append(path, field)...)
+		if err != nil {
+			return err
+		} else if !found {
+			continue
+		}
+		for _, c := range containers {
+			c, ok := c.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("Invalid %s in %s", field, obj.GetName())
+			}
+			if err := defaults.applyTo(c); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, containers, append(path, field)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r ContainerResources) applyTo(container map[string]interface{}) error {
+	// Quantities may be strings or numbers in config
+	requests, _, err := unstructured.NestedMap(container, "resources", "requests")
+	if err != nil {
+		return err
+	}
+	limits, _, err := unstructured.NestedMap(container, "resources", "limits")
+	if err != nil {
+		return err
+	}
+	if requests == nil {
+		requests = map[string]interface{}{}
+	}
+	if limits == nil {
+		limits = map[string]interface{}{}
+	}
+
+	changed := false
+	for name, v := range r.Requests {
+		_, hasRequest := requests[name]
+		// The server defaults a missing request to the limit
+		_, hasLimit := limits[name]
+		if !hasRequest && !hasLimit {
+			requests[name] = v
+			changed = true
+		}
+	}
+	for name, v := range r.Limits {
+		if _, ok := limits[name]; ok {
+			continue
+		}
+		if req, ok := requests[name]; ok && quantityLess(v, fmt.Sprint(req)) {
+			// Never limit below an explicit request
+			continue
+		}
+		limits[name] = v
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	if len(requests) > 0 {
+		if err := unstructured.SetNestedMap(container, requests, "resources", "requests"); err != nil {
+			return err
+		}
+	}
+	if len(limits) > 0 {
+		if err := unstructured.SetNestedMap(container, limits, "resources", "limits"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quantityLess returns true if quantity a is less than b.  Invalid
+// quantities are never less.
+func quantityLess(a, b string) bool {
+	qa, err := resource.ParseQuantity(a)
+	if err != nil {
+		return false
+	}
+	qb, err := resource.ParseQuantity(b)
+	if err != nil {
+		return false
+	}
+	return qa.Cmp(qb) < 0
+}
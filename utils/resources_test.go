@@ -0,0 +1,153 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseResourceDefaults(t *testing.T) {
+	for _, bad := range []string{
+		`default: {requests: {cpu: lots}}`,
+		`default: {requests: {memory: 1Gi}, limits: {memory: 512Mi}}`,
+		`namespaces: {batch: {limits: {memory: 1Mi}}}
+default: {requests: {memory: 1Gi}}`,
+	} {
+		if _, err := ParseResourceDefaults([]byte(bad)); err == nil {
+			t.Errorf("ParseResourceDefaults(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestResourceDefaultsApply(t *testing.T) {
+	defaults, err := ParseResourceDefaults([]byte(`
+default:
+  requests: {cpu: 100m, memory: 128Mi}
+  limits: {memory: 256Mi}
+namespaces:
+  batch:
+    limits: {memory: 1Gi}
+`))
+	if err != nil {
+		t.Fatalf("ParseResourceDefaults failed: %v", err)
+	}
+
+	container := func(resources map[string]interface{}) interface{} {
+		c := map[string]interface{}{"name": "c", "image": "foo"}
+		if resources != nil {
+			c["resources"] = resources
+		}
+		return c
+	}
+	deployment := func(namespace string, containers ...interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": "web"},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": containers},
+				},
+			},
+		}}
+		obj.SetNamespace(namespace)
+		return obj
+	}
+	containersOf := func(obj *unstructured.Unstructured) []interface{} {
+		c, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		return c
+	}
+
+	tests := []struct {
+		namespace string
+		in        map[string]interface{}
+		out       map[string]interface{}
+	}{
+		{
+			in: nil,
+			out: map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+				"limits":   map[string]interface{}{"memory": "256Mi"},
+			},
+		},
+		{
+			// Explicit values are left alone, and a
+			// default limit is never below a request
+			in: map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": int64(2), "memory": "512Mi"},
+			},
+			out: map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": int64(2), "memory": "512Mi"},
+			},
+		},
+		{
+			// A limit implies the same request
+			in: map[string]interface{}{
+				"limits": map[string]interface{}{"cpu": "1", "memory": "64Mi"},
+			},
+			out: map[string]interface{}{
+				"limits": map[string]interface{}{"cpu": "1", "memory": "64Mi"},
+			},
+		},
+		{
+			namespace: "batch",
+			in:        nil,
+			out: map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+				"limits":   map[string]interface{}{"memory": "1Gi"},
+			},
+		},
+	}
+	for i, test := range tests {
+		obj := deployment(test.namespace, container(test.in))
+		if err := defaults.Apply(obj, "default"); err != nil {
+			t.Errorf("%d: Apply failed: %v", i, err)
+			continue
+		}
+		expected := []interface{}{container(test.out)}
+		if c := containersOf(obj); !reflect.DeepEqual(c, expected) {
+			t.Errorf("%d: Got %v, expected %v", i, c, expected)
+		}
+	}
+
+	// The default namespace is used for objects without one
+	obj := deployment("", container(nil))
+	if err := defaults.Apply(obj, "batch"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	limits, _, _ := unstructured.NestedMap(containersOf(obj)[0].(map[string]interface{}), "resources", "limits")
+	if limits["memory"] != "1Gi" {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+
+	// Other kinds are left alone
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "cm"},
+		"spec":       map[string]interface{}{"containers": []interface{}{container(nil)}},
+	}}
+	orig := cm.DeepCopy()
+	if err := defaults.Apply(cm, "default"); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(cm, orig) {
+		t.Errorf("ConfigMap was changed: %v", cm)
+	}
+}
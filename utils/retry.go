@@ -0,0 +1,88 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/discovery"
+)
+
+// DefaultDiscoveryRetries is how many times a discovery request is
+// retried after a transient error, by default.
+const DefaultDiscoveryRetries = 4
+
+// The delay before the first retry, which doubles for each one
+// after, and the longest delay (including any Retry-After).
+// Variables for tests.
+var (
+	discoveryRetryDelay    = 500 * time.Millisecond
+	maxDiscoveryRetryDelay = 30 * time.Second
+)
+
+// SetDiscoveryRetries sets how many times discovery requests made by
+// c (from NewMemcachedDiscoveryClient or NewCachedDiscoveryClient)
+// are retried after a transient error.  Zero disables retries.
+func SetDiscoveryRetries(c discovery.CachedDiscoveryInterface, retries int) {
+	if mc, ok := c.(*memcachedDiscoveryClient); ok {
+		mc.lock.Lock()
+		mc.retries = retries
+		mc.lock.Unlock()
+	}
+}
+
+// isTransient is true for errors that may go away if the request is
+// repeated: overload, a server or gateway that is briefly
+// unavailable, or a dropped connection.
+func isTransient(err error) bool {
+	if status, ok := err.(errors.APIStatus); ok {
+		switch status.Status().Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
+// withRetries calls f until it succeeds or fails permanently, with
+// up to retries retries after transient errors.  The delay between
+// attempts doubles each time, unless the server gives a Retry-After.
+func withRetries(desc string, retries int, f func() error) error {
+	delay := discoveryRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return err
+		}
+
+		wait := delay
+		if secs, ok := errors.SuggestsClientDelay(err); ok && secs > 0 {
+			wait = time.Duration(secs) * time.Second
+		}
+		if wait > maxDiscoveryRetryDelay {
+			wait = maxDiscoveryRetryDelay
+		}
+		log.Debugf("Retrying %s in %s after error: %v", desc, wait, err)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
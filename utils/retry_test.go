@@ -0,0 +1,145 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+)
+
+// flakyDiscovery fails each request with the next of errs, then
+// passes it on.
+type flakyDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	errs  []error
+	calls int
+}
+
+func (d *flakyDiscovery) fail() error {
+	d.calls++
+	if len(d.errs) == 0 {
+		return nil
+	}
+	err := d.errs[0]
+	d.errs = d.errs[1:]
+	return err
+}
+
+func (d *flakyDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return d.FakeDiscovery.ServerGroups()
+}
+
+func (d *flakyDiscovery) ServerResourcesForGroupVersion(gv string) (*metav1.APIResourceList, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return d.FakeDiscovery.ServerResourcesForGroupVersion(gv)
+}
+
+func (d *flakyDiscovery) OpenAPISchema() (*openapi_v2.Document, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return &openapi_v2.Document{}, nil
+}
+
+func unavailable() error {
+	return errors.NewGenericServerResponse(http.StatusServiceUnavailable, "get", schema.GroupResource{}, "", "the server is currently unable to handle the request", 0, true)
+}
+
+func TestIsTransient(t *testing.T) {
+	reset := &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+	for _, test := range []struct {
+		err       error
+		transient bool
+	}{
+		{unavailable(), true},
+		{errors.NewTooManyRequests("slow down", 1), true},
+		{errors.NewInternalError(fmt.Errorf("oops")), true},
+		{reset, true},
+		{errors.NewNotFound(schema.GroupResource{}, "v2"), false},
+		{errors.NewUnauthorized("who are you"), false},
+		{errors.NewForbidden(schema.GroupResource{}, "", fmt.Errorf("no")), false},
+		{fmt.Errorf("bad document"), false},
+	} {
+		if isTransient(test.err) != test.transient {
+			t.Errorf("isTransient(%v) should be %v", test.err, test.transient)
+		}
+	}
+}
+
+func TestMemcachedRetries(t *testing.T) {
+	defer func(d time.Duration) { discoveryRetryDelay = d }(discoveryRetryDelay)
+	discoveryRetryDelay = time.Millisecond
+
+	flaky := &flakyDiscovery{FakeDiscovery: newFakeDiscovery()}
+	c := NewMemcachedDiscoveryClient(flaky, 0)
+
+	flaky.errs = []error{unavailable(), unavailable()}
+	if _, err := c.ServerResourcesForGroupVersion("v1"); err != nil {
+		t.Errorf("ServerResourcesForGroupVersion failed despite retries: %v", err)
+	}
+	if flaky.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", flaky.calls)
+	}
+
+	flaky.calls = 0
+	flaky.errs = []error{unavailable(), errors.NewTooManyRequests("slow down", 0)}
+	if _, err := c.ServerGroups(); err != nil {
+		t.Errorf("ServerGroups failed despite retries: %v", err)
+	}
+	if _, err := c.OpenAPISchema(); err != nil {
+		t.Errorf("OpenAPISchema failed: %v", err)
+	}
+	if flaky.calls != 4 {
+		t.Errorf("Expected 4 attempts, got %d", flaky.calls)
+	}
+
+	// Permanent errors aren't retried
+	flaky.calls = 0
+	flaky.errs = []error{errors.NewUnauthorized("who are you"), nil}
+	if _, err := c.ServerResourcesForGroupVersion("apps/v1"); !errors.IsUnauthorized(err) {
+		t.Errorf("Expected Unauthorized, got %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Errorf("Permanent error was retried: %d attempts", flaky.calls)
+	}
+
+	// Nor are transient ones beyond the budget
+	SetDiscoveryRetries(c, 1)
+	flaky.calls = 0
+	flaky.errs = []error{unavailable(), unavailable(), unavailable()}
+	if _, err := c.ServerResourcesForGroupVersion("apps/v1"); !errors.IsServiceUnavailable(err) {
+		t.Errorf("Expected ServiceUnavailable, got %v", err)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("Expected 2 attempts, got %d", flaky.calls)
+	}
+}
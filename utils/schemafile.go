@@ -0,0 +1,105 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// ReadOpenAPIDocument reads an OpenAPI (v2) document saved from a
+// server, either as JSON (eg: `kubectl get --raw /openapi/v2`) or in
+// the protobuf form kept in the discovery cache.
+func ReadOpenAPIDocument(path string) (*openapi_v2.Document, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		info, err := compiler.ReadInfoFromBytes(path, b)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+		}
+		doc, err := openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading OpenAPI document %s: %v", path, err)
+		}
+		return doc, nil
+	}
+
+	var doc openapi_v2.Document
+	if err := proto.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("Error reading OpenAPI document %s: %v", path, err)
+	}
+	return &doc, nil
+}
+
+// NewOfflineDiscoveryClient creates a DiscoveryClient that serves
+// only doc, without a server.  Every other request fails.  The
+// parsed document is cached, as for a server's.
+func NewOfflineDiscoveryClient(doc *openapi_v2.Document) discovery.CachedDiscoveryInterface {
+	return newMemcachedDiscoveryClient(offlineDiscoveryClient{doc: doc}, 0)
+}
+
+type offlineDiscoveryClient struct {
+	doc *openapi_v2.Document
+}
+
+var errOffline = fmt.Errorf("API discovery is not available offline")
+
+func (c offlineDiscoveryClient) RESTClient() rest.Interface {
+	return nil
+}
+
+func (c offlineDiscoveryClient) ServerGroups() (*metav1.APIGroupList, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) ServerResources() ([]*metav1.APIResourceList, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) ServerVersion() (*version.Info, error) {
+	return nil, errOffline
+}
+
+func (c offlineDiscoveryClient) OpenAPISchema() (*openapi_v2.Document, error) {
+	return c.doc, nil
+}
+
+var _ discovery.DiscoveryInterface = offlineDiscoveryClient{}
@@ -0,0 +1,81 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const widgetSchema = `{
+  "swagger": "2.0",
+  "info": {"title": "Kubernetes", "version": "v1.10.0"},
+  "paths": {},
+  "definitions": {
+    "com.example.v1.Widget": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "size": {"type": "integer"}
+      },
+      "x-kubernetes-group-version-kind": [
+        {"group": "example.com", "version": "v1", "kind": "Widget"}
+      ]
+    }
+  }
+}
+`
+
+func TestReadOpenAPIDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemafile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "openapi.json")
+	if err := ioutil.WriteFile(path, []byte(widgetSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		gvk  schema.GroupVersionKind
+	}{
+		{path, schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}},
+		{filepath.FromSlash("../testdata/schema.pb"), schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+	}
+	for _, test := range tests {
+		doc, err := ReadOpenAPIDocument(test.path)
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", test.path, err)
+		}
+		disco := NewOfflineDiscoveryClient(doc)
+		if _, err := NewOpenAPISchemaFor(disco, test.gvk); err != nil {
+			t.Errorf("No schema for %s in %s: %v", test.gvk, test.path, err)
+		}
+		if _, err := disco.ServerResourcesForGroupVersion("v1"); err == nil {
+			t.Errorf("Offline discovery unexpectedly succeeded")
+		}
+	}
+
+	if _, err := ReadOpenAPIDocument(filepath.FromSlash("../testdata/test.yaml")); err == nil {
+		t.Errorf("Expected an error reading a non-OpenAPI file")
+	}
+}
@@ -27,7 +27,7 @@ import (
 
 var (
 	gkTpr = schema.GroupKind{Group: "extensions", Kind: "ThirdPartyResource"}
-	gkCrd = schema.GroupKind{Group: "apiextensions", Kind: "CustomResourceDefinition"}
+	gkCrd = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
 )
 
 // a podSpecVisitor traverses a schema tree and records whether the schema
@@ -121,6 +121,27 @@ func DependencyOrder(disco ServerResourcesOpenAPISchema, list []*unstructured.Un
 	return &mappedSort{sortKeys: sortKeys, items: list}, nil
 }
 
+// DependencyTiers splits list, already sorted by DependencyOrder,
+// into runs of objects in the same dependency tier.  Objects in a
+// tier have no known dependencies on each other, so may be created
+// in any order (or concurrently).
+func DependencyTiers(disco ServerResourcesOpenAPISchema, list []*unstructured.Unstructured) ([][]*unstructured.Unstructured, error) {
+	var tiers [][]*unstructured.Unstructured
+	last := 0
+	for _, item := range list {
+		tier, err := depTier(disco, item.GetObjectKind())
+		if err != nil {
+			return nil, err
+		}
+		if len(tiers) == 0 || tier != last {
+			tiers = append(tiers, nil)
+			last = tier
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], item)
+	}
+	return tiers, nil
+}
+
 type mappedSort struct {
 	sortKeys []int
 	items    []*unstructured.Unstructured
@@ -127,7 +127,7 @@ func TestDepSort(t *testing.T) {
 		newObj("v1", "ConfigMap"),
 		newObj("v1", "Namespace"),
 		newObj("bogus/v1", "UnknownKind"),
-		newObj("apiextensions/v1beta1", "CustomResourceDefinition"),
+		newObj("apiextensions.k8s.io/v1beta1", "CustomResourceDefinition"),
 	}
 
 	sorter, err := DependencyOrder(disco, objs)
@@ -149,6 +149,18 @@ func TestDepSort(t *testing.T) {
 	if objs[4].GetKind() != "ReplicationController" {
 		t.Error("RC should be sorted after other objects")
 	}
+
+	tiers, err := DependencyTiers(disco, objs)
+	if err != nil {
+		t.Fatalf("DependencyTiers error: %v", err)
+	}
+	sizes := []int{}
+	for _, tier := range tiers {
+		sizes = append(sizes, len(tier))
+	}
+	if !reflect.DeepEqual(sizes, []int{1, 1, 2, 1}) {
+		t.Errorf("Unexpected tier sizes %v", sizes)
+	}
 }
 
 func TestAlphaSort(t *testing.T) {